@@ -0,0 +1,228 @@
+package catalog
+
+import (
+	"ZeroStore/storageEngine"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultBtreeDegree = 4
+
+// rows re-encrypted per hold of a table's lock
+const reEncryptBatch = 1000
+
+const (
+	FormatCSV       = "csv"
+	FormatJSONLines = "jsonl"
+	FormatColumnar  = "zcol"
+)
+
+var (
+	ErrTableNotFound = errors.New("table not registered")
+	ErrInvalidKey    = errors.New("invalid key")
+)
+
+type schema struct {
+	open    func(path string) (Table, error)
+	restore func(backup, path string, until time.Time) (int, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]schema{}
+)
+
+func Register[K comparable, V any](name string, compare func(a, b K) int, opts ...storageEngine.Option) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry[name] = schema{
+		open: func(path string) (Table, error) {
+			return openTable[K, V](name, path, compare, opts...)
+		},
+		restore: func(backup, path string, until time.Time) (int, error) {
+			res := storageEngine.Restore[K, V](compare, backup, path, defaultBtreeDegree, until, opts...)
+			return res.Value, res.Err
+		},
+	}
+}
+
+type Database struct {
+	Dir    string
+	mu     sync.Mutex
+	tables map[string]Table
+	// writeMu is shared by the tables linked by foreign keys
+	writeMu sync.Mutex
+	linked  map[ForeignKey]bool
+}
+
+func Open(dir string) (*Database, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Database{Dir: dir, tables: make(map[string]Table), linked: make(map[ForeignKey]bool)}, nil
+}
+
+func (db *Database) Tables() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (db *Database) Table(name string) (Table, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.open(name)
+}
+
+// open also opens every table linked to name by a foreign key, so the
+// constraints hold from the first write.
+func (db *Database) open(name string) (Table, error) {
+	if t, ok := db.tables[name]; ok {
+		return t, nil
+	}
+
+	registryMu.RLock()
+	s, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTableNotFound, name)
+	}
+
+	t, err := s.open(db.path(name))
+	if err != nil {
+		return nil, err
+	}
+	db.tables[name] = t
+	if err := db.link(name); err != nil {
+		delete(db.tables, name)
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+func (db *Database) link(name string) error {
+	for _, fk := range foreignKeysOf(name) {
+		if db.linked[fk] {
+			continue
+		}
+		if fk.Table == fk.References {
+			return fmt.Errorf("foreign key on %s: a table cannot reference itself", fk.Table)
+		}
+		child, err := db.open(fk.Table)
+		if err != nil {
+			return err
+		}
+		parent, err := db.open(fk.References)
+		if err != nil {
+			return err
+		}
+		// opening the other end may have linked fk already
+		if db.linked[fk] {
+			continue
+		}
+
+		c, p := child.(constrained), parent.(constrained)
+		if err := c.referenceParent(fk, p); err != nil {
+			return err
+		}
+		p.referencedBy(fk, c)
+		c.serialise(&db.writeMu)
+		p.serialise(&db.writeMu)
+		db.linked[fk] = true
+	}
+	return nil
+}
+
+func (db *Database) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var firstErr error
+	for name, t := range db.tables {
+		if err := t.Close(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("closing %s: %w", name, err)
+		}
+		delete(db.tables, name)
+	}
+	clear(db.linked)
+	return firstErr
+}
+
+// Backup copies every table that exists on disk into dir. Each table is
+// snapshotted on its own while writes continue.
+func (db *Database) Backup(dir string) ([]storageEngine.BackupManifest, error) {
+	var manifests []storageEngine.BackupManifest
+	for _, name := range db.Tables() {
+		if _, err := os.Stat(db.path(name) + "_data.bin"); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		t, err := db.Table(name)
+		if err != nil {
+			return manifests, err
+		}
+		m, err := t.Backup(dir)
+		if err != nil {
+			return manifests, fmt.Errorf("backing up %s: %w", name, err)
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, nil
+}
+
+// Restore replaces the tables backed up in dir and replays their logged
+// mutations up to until, or all of them when until is zero. Open tables
+// are closed first. It returns the number of replayed mutations per table.
+func (db *Database) Restore(dir string, until time.Time) (map[string]int, error) {
+	if err := db.Close(); err != nil {
+		return nil, err
+	}
+
+	replayed := map[string]int{}
+	for _, name := range db.Tables() {
+		backup := filepath.Join(dir, name)
+		if _, err := os.Stat(backup + "_backup.json"); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		registryMu.RLock()
+		s := registry[name]
+		registryMu.RUnlock()
+
+		n, err := s.restore(backup, db.path(name), until)
+		if err != nil {
+			return replayed, fmt.Errorf("restoring %s: %w", name, err)
+		}
+		replayed[name] = n
+	}
+	return replayed, nil
+}
+
+func FormatFromPath(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".jsonl", ".ndjson":
+		return FormatJSONLines, nil
+	case ".zcol":
+		return FormatColumnar, nil
+	}
+	return "", fmt.Errorf("cannot tell the format of %s; use .csv, .jsonl, .ndjson or .zcol", path)
+}
+
+func (db *Database) path(name string) string {
+	return db.Dir + string(os.PathSeparator) + name
+}
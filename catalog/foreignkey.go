@@ -0,0 +1,215 @@
+package catalog
+
+import (
+	"ZeroStore/helper"
+	"ZeroStore/storageEngine"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var ErrForeignKey = errors.New("foreign key violation")
+
+type OnDelete int
+
+const (
+	// Restrict refuses to delete a row that other rows still reference
+	Restrict OnDelete = iota
+	// Cascade deletes the referencing rows along with the row
+	Cascade
+)
+
+// ForeignKey declares that Column of every row in Table holds the key of a
+// row in References.
+type ForeignKey struct {
+	Table      string
+	Column     string
+	References string
+	OnDelete   OnDelete
+}
+
+var foreignKeys []ForeignKey
+
+// RegisterForeignKey declares fk for every Database. It is enforced on
+// writes made through the catalog once both tables are opened. Rows of the
+// two tables must only be written through the catalog: the checks take the
+// engine locks of both tables in opposite orders for inserts and deletes,
+// and only the write lock the catalog shares between linked tables keeps
+// them from deadlocking.
+func RegisterForeignKey(fk ForeignKey) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	foreignKeys = append(foreignKeys, fk)
+}
+
+func foreignKeysOf(name string) []ForeignKey {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var fks []ForeignKey
+	for _, fk := range foreignKeys {
+		if fk.Table == name || fk.References == name {
+			fks = append(fks, fk)
+		}
+	}
+	return fks
+}
+
+// constrained is implemented by every table; the methods wire a foreign key
+// into the engine hooks of its two ends.
+type constrained interface {
+	exists(key interface{}) (bool, error)
+	referencing(column string, value interface{}) ([]interface{}, error)
+	deleteReferencing(keys []interface{}) error
+	referenceParent(fk ForeignKey, parent constrained) error
+	referencedBy(fk ForeignKey, child constrained)
+	checkDelete(key interface{}) error
+	serialise(mu *sync.Mutex)
+}
+
+func (t *table[K, V]) exists(key interface{}) (bool, error) {
+	k, err := ParseKey[K](key)
+	if err != nil {
+		return false, err
+	}
+	res := t.dt.Search(k)
+	if errors.Is(res.Err, storageEngine.ErrKeyNotFound) {
+		return false, nil
+	}
+	return res.Err == nil, res.Err
+}
+
+// referencing looks up the rows whose column holds value in the secondary
+// index referenceParent created.
+func (t *table[K, V]) referencing(column string, value interface{}) ([]interface{}, error) {
+	field, _ := reflect.TypeOf((*V)(nil)).Elem().FieldByName(column)
+	converted, err := helper.ConvertValue(value, field.Type)
+	if err != nil {
+		return nil, err
+	}
+	res := t.dt.Lookup(column, converted.Interface())
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	keys := make([]interface{}, len(res.Value))
+	for i, k := range res.Value {
+		keys[i] = k
+	}
+	return keys, nil
+}
+
+func (t *table[K, V]) deleteReferencing(keys []interface{}) error {
+	for _, key := range keys {
+		if res := t.dt.Delete(key.(K)); res.Err != nil {
+			return res.Err
+		}
+	}
+	return t.Flush()
+}
+
+// referenceParent makes inserts and updates of t fail unless fk.Column
+// names an existing row of parent. The check reads parent while holding
+// t's engine lock, the reverse of the order referencedBy takes them in, so
+// both must run under the shared lock set by serialise.
+func (t *table[K, V]) referenceParent(fk ForeignKey, parent constrained) error {
+	vType := reflect.TypeOf((*V)(nil)).Elem()
+	if vType.Kind() != reflect.Struct {
+		return fmt.Errorf("foreign key on %s: rows are not structs", fk.Table)
+	}
+	if _, ok := vType.FieldByName(fk.Column); !ok {
+		return fmt.Errorf("foreign key on %s: field %s not found in struct", fk.Table, fk.Column)
+	}
+
+	column := func(data V) any {
+		value, _ := helper.GetFieldValue(data, fk.Column)
+		return value
+	}
+	if res := t.dt.CreateIndex(fk.Column, column); res.Err != nil {
+		return res.Err
+	}
+
+	check := func(data V) error {
+		value := column(data)
+		ok, err := parent.exists(value)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s.%s %v has no row in %s", ErrForeignKey, fk.Table, fk.Column, value, fk.References)
+		}
+		return nil
+	}
+	t.dt.BeforeInsert(func(key K, data V) (V, error) {
+		return data, check(data)
+	})
+	t.dt.BeforeUpdate(func(key K, old, data V) (V, error) {
+		if column(old) == column(data) {
+			return data, nil
+		}
+		return data, check(data)
+	})
+	return nil
+}
+
+type reference struct {
+	fk    ForeignKey
+	child constrained
+}
+
+// referencedBy applies fk.OnDelete when a row of t that child references
+// is deleted. Every restriction down the cascade is checked, and the rows
+// to delete looked up, before the first referencing row is removed, so a
+// Restrict anywhere in the cascade deletes nothing. The deletes themselves
+// are not atomic: should one fail on I/O, the rows removed before it stay
+// removed and the row being deleted stays. The hook writes child while
+// holding t's engine lock; see referenceParent.
+func (t *table[K, V]) referencedBy(fk ForeignKey, child constrained) {
+	if len(t.references) == 0 {
+		t.dt.BeforeDelete(func(key K, data V) error {
+			if err := t.checkDelete(key); err != nil {
+				return err
+			}
+			children := make([][]interface{}, len(t.references))
+			for i, ref := range t.references {
+				keys, err := ref.child.referencing(ref.fk.Column, key)
+				if err != nil {
+					return err
+				}
+				children[i] = keys
+			}
+			for i, ref := range t.references {
+				if err := ref.child.deleteReferencing(children[i]); err != nil {
+					return fmt.Errorf("cascading delete of %s %v into %s: %w", ref.fk.References, key, ref.fk.Table, err)
+				}
+			}
+			return nil
+		})
+	}
+	t.references = append(t.references, reference{fk, child})
+}
+
+func (t *table[K, V]) checkDelete(key interface{}) error {
+	for _, ref := range t.references {
+		keys, err := ref.child.referencing(ref.fk.Column, key)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			continue
+		}
+		if ref.fk.OnDelete != Cascade {
+			return fmt.Errorf("%w: %d rows of %s still reference %s %v", ErrForeignKey, len(keys), ref.fk.Table, ref.fk.References, key)
+		}
+		for _, k := range keys {
+			if err := ref.child.checkDelete(k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (t *table[K, V]) serialise(mu *sync.Mutex) {
+	t.mu = mu
+}
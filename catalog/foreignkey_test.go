@@ -0,0 +1,160 @@
+package catalog
+
+import (
+	"ZeroStore/keys"
+	"ZeroStore/storageEngine"
+	"errors"
+	"testing"
+	"time"
+)
+
+type fkAuthor struct {
+	Name string
+}
+
+type fkPost struct {
+	AuthorID int
+	Title    string
+}
+
+type fkComment struct {
+	PostID int
+	Text   string
+}
+
+func init() {
+	Register[int, fkAuthor]("fk_authors", keys.Ordered[int])
+	Register[int, fkPost]("fk_posts", keys.Ordered[int])
+	Register[int, fkComment]("fk_comments", keys.Ordered[int])
+	RegisterForeignKey(ForeignKey{Table: "fk_posts", Column: "AuthorID", References: "fk_authors", OnDelete: Cascade})
+	RegisterForeignKey(ForeignKey{Table: "fk_comments", Column: "PostID", References: "fk_posts", OnDelete: Restrict})
+}
+
+func openFKTables(t *testing.T) (authors, posts, comments Table) {
+	t.Helper()
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, p := range []struct {
+		name string
+		t    *Table
+	}{{"fk_authors", &authors}, {"fk_posts", &posts}, {"fk_comments", &comments}} {
+		if *p.t, err = db.Table(p.name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return authors, posts, comments
+}
+
+func mustInsert(t *testing.T, tbl Table, key int, fields map[string]interface{}) {
+	t.Helper()
+	if err := tbl.Insert(key, fields); err != nil {
+		t.Fatalf("insert %s %d: %v", tbl.Name(), key, err)
+	}
+}
+
+func wantKeys(t *testing.T, tbl Table, want ...int) {
+	t.Helper()
+	var got []int
+	for res := range tbl.Scan() {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		got = append(got, res.Value.Key.(int))
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%s holds %v, want %v", tbl.Name(), got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s holds %v, want %v", tbl.Name(), got, want)
+		}
+	}
+}
+
+func TestCascadeDelete(t *testing.T) {
+	authors, posts, _ := openFKTables(t)
+	mustInsert(t, authors, 1, map[string]interface{}{"Name": "ada"})
+	mustInsert(t, authors, 2, map[string]interface{}{"Name": "bob"})
+	mustInsert(t, posts, 10, map[string]interface{}{"AuthorID": 1, "Title": "a"})
+	mustInsert(t, posts, 11, map[string]interface{}{"AuthorID": 1, "Title": "b"})
+	mustInsert(t, posts, 20, map[string]interface{}{"AuthorID": 2, "Title": "c"})
+
+	if err := posts.Insert(30, map[string]interface{}{"AuthorID": 3}); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("insert with a missing author = %v, want ErrForeignKey", err)
+	}
+	if err := authors.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	wantKeys(t, authors, 2)
+	wantKeys(t, posts, 20)
+}
+
+func TestRestrictBelowCascadeDeletesNothing(t *testing.T) {
+	authors, posts, comments := openFKTables(t)
+	mustInsert(t, authors, 1, map[string]interface{}{"Name": "ada"})
+	mustInsert(t, posts, 10, map[string]interface{}{"AuthorID": 1})
+	mustInsert(t, posts, 11, map[string]interface{}{"AuthorID": 1})
+	mustInsert(t, comments, 100, map[string]interface{}{"PostID": 11, "Text": "hi"})
+
+	if err := authors.Delete(1); !errors.Is(err, ErrForeignKey) {
+		t.Fatalf("delete with a restricted grandchild = %v, want ErrForeignKey", err)
+	}
+	wantKeys(t, authors, 1)
+	wantKeys(t, posts, 10, 11)
+	wantKeys(t, comments, 100)
+
+	if err := comments.Delete(100); err != nil {
+		t.Fatal(err)
+	}
+	if err := authors.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	wantKeys(t, authors)
+	wantKeys(t, posts)
+}
+
+func TestReapedRowsCascade(t *testing.T) {
+	authors, posts, comments := openFKTables(t)
+	tbl := authors.(*table[int, fkAuthor])
+	dt := tbl.dt
+	// the reaper writes both ends of the foreign key, so it runs under the
+	// lock the catalog writes them under
+	reap := func() storageEngine.Result[int] {
+		tbl.mu.Lock()
+		defer tbl.mu.Unlock()
+		return dt.ReapExpired(10)
+	}
+	ttl := 200 * time.Millisecond
+	expires := time.Now().Add(ttl)
+	for key := 1; key <= 2; key++ {
+		if res := dt.InsertWithTTL(key, fkAuthor{}, ttl); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	mustInsert(t, authors, 3, map[string]interface{}{"Name": "cy"})
+	mustInsert(t, posts, 10, map[string]interface{}{"AuthorID": 1})
+	mustInsert(t, posts, 20, map[string]interface{}{"AuthorID": 2})
+	mustInsert(t, posts, 30, map[string]interface{}{"AuthorID": 3})
+	mustInsert(t, comments, 100, map[string]interface{}{"PostID": 20})
+	time.Sleep(time.Until(expires))
+
+	// author 2 is kept by the comment on its post
+	res := reap()
+	if !errors.Is(res.Err, ErrForeignKey) || res.Value != 1 {
+		t.Fatalf("ReapExpired = %+v, want 1 row reaped and ErrForeignKey", res)
+	}
+	wantKeys(t, posts, 20, 30)
+	wantKeys(t, comments, 100)
+
+	if err := comments.Delete(100); err != nil {
+		t.Fatal(err)
+	}
+	if res := reap(); res.Err != nil || res.Value != 1 {
+		t.Fatalf("second ReapExpired = %+v, want 1", res)
+	}
+	wantKeys(t, authors, 3)
+	wantKeys(t, posts, 30)
+}
@@ -0,0 +1,508 @@
+package catalog
+
+import (
+	"ZeroStore/helper"
+	"ZeroStore/queryEngine"
+	"ZeroStore/storageEngine"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sync"
+)
+
+const KeyColumn = queryEngine.KeyField
+
+type Row struct {
+	Key     interface{}
+	Columns []string
+	Values  []interface{}
+}
+
+func (r Row) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i := -1; i < len(r.Columns); i++ {
+		name, value := KeyColumn, r.Key
+		if i >= 0 {
+			name, value = r.Columns[i], r.Values[i]
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type Table interface {
+	Name() string
+	Columns() []string
+	Get(key interface{}) (Row, error)
+	Put(key interface{}, data []byte) error
+	Insert(key interface{}, fields map[string]interface{}) error
+	InsertAuto(data []byte) (interface{}, error)
+	Delete(key interface{}) error
+	OpenBlob(key interface{}) (io.ReadCloser, int64, error)
+	CreateBlob(key interface{}) (BlobWriter, error)
+	DeleteBlob(key interface{}) error
+	UpdateWhere(conds []queryEngine.Condition, fields map[string]interface{}) (int, error)
+	DeleteWhere(conds []queryEngine.Condition) (int, error)
+	Scan() <-chan storageEngine.Result[Row]
+	// ScanContext is Scan that stops, closing the channel, once ctx is done
+	ScanContext(ctx context.Context) <-chan storageEngine.Result[Row]
+	Query(q queryEngine.Query) (<-chan storageEngine.Result[Row], error)
+	// QueryContext is Query that stops, closing the channel, once ctx is done
+	QueryContext(ctx context.Context, q queryEngine.Query) (<-chan storageEngine.Result[Row], error)
+	Explain(q queryEngine.Query) (string, error)
+	Import(format string, r io.Reader, keyColumn string) (storageEngine.ImportReport, error)
+	Export(format string, w io.Writer) (int, error)
+	Compact() error
+	UpgradeRows() (int, error)
+	ReEncrypt() (int, error)
+	Backup(dir string) (storageEngine.BackupManifest, error)
+	Stats() (storageEngine.TableStats, error)
+	Flush() error
+	Close() error
+}
+
+// BlobWriter streams a blob into a table. Close stores it and Abort drops it.
+type BlobWriter interface {
+	io.WriteCloser
+	Abort() error
+}
+
+type table[K comparable, V any] struct {
+	name string
+	dt   *storageEngine.DataTable[K, V]
+	// serialises read-modify-write sequences such as Put; tables linked by
+	// a foreign key share one so a cascade never races their writes
+	mu *sync.Mutex
+	// foreign keys pointing at this table
+	references []reference
+}
+
+func openTable[K comparable, V any](name, path string, compare func(a, b K) int, opts ...storageEngine.Option) (Table, error) {
+	dt, err := storageEngine.NewDataTable[K, V](compare, path, defaultBtreeDegree, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(dt.IndexFile.Name())
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > 0 {
+		if res := dt.LoadIndex(dt.IndexFile.Name()); res.Err != nil {
+			return nil, res.Err
+		}
+	}
+
+	return &table[K, V]{name: name, dt: dt, mu: new(sync.Mutex)}, nil
+}
+
+func (t *table[K, V]) Name() string {
+	return t.name
+}
+
+func (t *table[K, V]) Columns() []string {
+	return t.dt.Columns
+}
+
+func (t *table[K, V]) Get(key interface{}) (Row, error) {
+	k, err := ParseKey[K](key)
+	if err != nil {
+		return Row{}, err
+	}
+	res := t.dt.Search(k)
+	if res.Err != nil {
+		return Row{}, res.Err
+	}
+	return t.row(res.Value, nil)
+}
+
+func (t *table[K, V]) Put(key interface{}, data []byte) error {
+	k, err := ParseKey[K](key)
+	if err != nil {
+		return err
+	}
+
+	var v V
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if res := t.dt.Upsert(k, v); res.Err != nil {
+		return res.Err
+	}
+	return t.Flush()
+}
+
+// Insert stores a row built from fields. A nil key is taken from the field
+// tagged zerostore:"pk", or generated when that field is unset too.
+func (t *table[K, V]) Insert(key interface{}, fields map[string]interface{}) error {
+	var v V
+	v, err := setFields(v, fields)
+	if err != nil {
+		return err
+	}
+
+	var k, zero K
+	if key == nil {
+		if k, err = t.dt.KeyOf(v); err != nil || k == zero {
+			_, err := t.insertAuto(v)
+			return err
+		}
+	} else if k, err = ParseKey[K](key); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if res := t.dt.Insert(k, v); res.Err != nil {
+		return res.Err
+	}
+	return t.Flush()
+}
+
+// InsertAuto stores the JSON row under a generated key and returns the key.
+func (t *table[K, V]) InsertAuto(data []byte) (interface{}, error) {
+	var v V
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return t.insertAuto(v)
+}
+
+func (t *table[K, V]) insertAuto(v V) (interface{}, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	res := t.dt.InsertAuto(v)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return res.Value, t.Flush()
+}
+
+func (t *table[K, V]) UpdateWhere(conds []queryEngine.Condition, fields map[string]interface{}) (int, error) {
+	var zero V
+	if _, err := setFields(zero, fields); err != nil {
+		return 0, err
+	}
+
+	var applyErr error
+	update := func(data V) V {
+		updated, err := setFields(data, fields)
+		if err != nil {
+			applyErr = err
+			return data
+		}
+		return updated
+	}
+
+	return t.modifyWhere(conds, func(qb *queryEngine.QueryBuilder[K, V]) {
+		qb.UpdateWithFunc(update)
+	}, &applyErr)
+}
+
+func (t *table[K, V]) DeleteWhere(conds []queryEngine.Condition) (int, error) {
+	return t.modifyWhere(conds, func(qb *queryEngine.QueryBuilder[K, V]) {
+		qb.Delete()
+	}, new(error))
+}
+
+func (t *table[K, V]) modifyWhere(conds []queryEngine.Condition, op func(*queryEngine.QueryBuilder[K, V]), opErr *error) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	qb := queryEngine.NewQueryBuilder(t.dt).As(t.name)
+	keys := queryEngine.Execute[K, V, []K](qb.WhereConditions(conds...))
+	if keys.Err != nil {
+		return 0, keys.Err
+	}
+	if len(keys.Value) == 0 {
+		return 0, nil
+	}
+
+	qb.GetFromKeys(keys.Value)
+	op(qb)
+	if res := queryEngine.Execute[K, V, any](qb); res.Err != nil {
+		return 0, res.Err
+	}
+	if *opErr != nil {
+		return 0, *opErr
+	}
+	return len(keys.Value), t.Flush()
+}
+
+func (t *table[K, V]) Delete(key interface{}) error {
+	k, err := ParseKey[K](key)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if res := t.dt.Delete(k); res.Err != nil {
+		return res.Err
+	}
+	return t.Flush()
+}
+
+// OpenBlob streams the blob stored under key and reports its size.
+func (t *table[K, V]) OpenBlob(key interface{}) (io.ReadCloser, int64, error) {
+	k, err := ParseKey[K](key)
+	if err != nil {
+		return nil, 0, err
+	}
+	res := t.dt.OpenBlob(k)
+	if res.Err != nil {
+		return nil, 0, res.Err
+	}
+	return res.Value, res.Value.Size(), nil
+}
+
+func (t *table[K, V]) CreateBlob(key interface{}) (BlobWriter, error) {
+	k, err := ParseKey[K](key)
+	if err != nil {
+		return nil, err
+	}
+	res := t.dt.CreateBlob(k)
+	return res.Value, res.Err
+}
+
+func (t *table[K, V]) DeleteBlob(key interface{}) error {
+	k, err := ParseKey[K](key)
+	if err != nil {
+		return err
+	}
+	return t.dt.DeleteBlob(k).Err
+}
+
+func (t *table[K, V]) Scan() <-chan storageEngine.Result[Row] {
+	return t.ScanContext(context.Background())
+}
+
+func (t *table[K, V]) ScanContext(ctx context.Context) <-chan storageEngine.Result[Row] {
+	out := make(chan storageEngine.Result[Row])
+	go func() {
+		defer close(out)
+		rowsChan := t.dt.GetAllContext(ctx)
+		defer func() {
+			for range rowsChan {
+			}
+		}()
+
+		for res := range rowsChan {
+			if res.Err != nil {
+				send(ctx, out, storageEngine.Result[Row]{Err: res.Err})
+				return
+			}
+			row, err := t.row(res.Value, nil)
+			if !send(ctx, out, storageEngine.NewResult(row, err)) {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func (t *table[K, V]) Query(q queryEngine.Query) (<-chan storageEngine.Result[Row], error) {
+	return t.QueryContext(context.Background(), q)
+}
+
+func (t *table[K, V]) QueryContext(ctx context.Context, q queryEngine.Query) (<-chan storageEngine.Result[Row], error) {
+	for _, col := range q.Select {
+		if col != KeyColumn && !t.hasColumn(col) {
+			return nil, fmt.Errorf("field %s not found in struct", col)
+		}
+	}
+	res := t.queryBuilder(q).StreamContext(ctx)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+
+	out := make(chan storageEngine.Result[Row])
+	go func() {
+		defer close(out)
+		rowsChan := res.Value
+		// drain the plan on early exit so its goroutines can finish; once
+		// ctx is done it stops reading the table, so this is quick
+		defer func() {
+			for range rowsChan {
+			}
+		}()
+
+		for res := range rowsChan {
+			if res.Err != nil {
+				send(ctx, out, storageEngine.Result[Row]{Err: res.Err})
+				return
+			}
+			row, err := t.row(res.Value, q.Select)
+			if !send(ctx, out, storageEngine.NewResult(row, err)) {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// send passes res on unless ctx is done first.
+func send(ctx context.Context, out chan<- storageEngine.Result[Row], res storageEngine.Result[Row]) bool {
+	select {
+	case out <- res:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Explain describes how Query would run q.
+func (t *table[K, V]) Explain(q queryEngine.Query) (string, error) {
+	res := t.queryBuilder(q).Explain()
+	return res.Value, res.Err
+}
+
+func (t *table[K, V]) queryBuilder(q queryEngine.Query) *queryEngine.QueryBuilder[K, V] {
+	return queryEngine.NewQueryBuilder(t.dt).As(t.name).WhereConditions(q.Where...).Limit(q.Limit)
+}
+
+func (t *table[K, V]) Import(format string, r io.Reader, keyColumn string) (storageEngine.ImportReport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var res storageEngine.Result[storageEngine.ImportReport]
+	switch format {
+	case FormatCSV:
+		res = t.dt.ImportCSV(r, keyColumn)
+	case FormatJSONLines:
+		res = t.dt.ImportJSONLines(r, keyColumn)
+	case FormatColumnar:
+		res = t.dt.ImportColumnar(r)
+	default:
+		return storageEngine.ImportReport{}, fmt.Errorf("unknown format %q", format)
+	}
+	return res.Value, res.Err
+}
+
+func (t *table[K, V]) Export(format string, w io.Writer) (int, error) {
+	var res storageEngine.Result[int]
+	switch format {
+	case FormatCSV:
+		res = t.dt.ExportCSV(w)
+	case FormatJSONLines:
+		res = t.dt.ExportJSONLines(w)
+	case FormatColumnar:
+		res = t.dt.ExportColumnar(w)
+	default:
+		return 0, fmt.Errorf("unknown format %q", format)
+	}
+	return res.Value, res.Err
+}
+
+func (t *table[K, V]) Compact() error {
+	return t.dt.Compact().Err
+}
+
+func (t *table[K, V]) UpgradeRows() (int, error) {
+	res := t.dt.UpgradeRows()
+	return res.Value, res.Err
+}
+
+// ReEncrypt rewrites every row under the table's current key.
+func (t *table[K, V]) ReEncrypt() (int, error) {
+	res := t.dt.StartReEncryption(reEncryptBatch)()
+	return res.Value, res.Err
+}
+
+func (t *table[K, V]) Backup(dir string) (storageEngine.BackupManifest, error) {
+	res := t.dt.Backup(dir)
+	return res.Value, res.Err
+}
+
+func (t *table[K, V]) Stats() (storageEngine.TableStats, error) {
+	res := t.dt.Stats()
+	return res.Value, res.Err
+}
+
+func (t *table[K, V]) Flush() error {
+	return t.dt.SaveIndex().Err
+}
+
+func (t *table[K, V]) Close() error {
+	if err := t.Flush(); err != nil {
+		return err
+	}
+	return t.dt.Close().Err
+}
+
+func (t *table[K, V]) hasColumn(name string) bool {
+	for _, col := range t.dt.Columns {
+		if col == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *table[K, V]) row(dr storageEngine.DataRow[K, V], columns []string) (Row, error) {
+	if len(columns) == 0 {
+		columns = t.dt.Columns
+	}
+
+	row := Row{Key: dr.PrimaryKey}
+	for _, col := range columns {
+		if col == KeyColumn {
+			continue
+		}
+		value, err := helper.GetFieldValue(dr.Data, col)
+		if err != nil {
+			return Row{}, err
+		}
+		row.Columns = append(row.Columns, col)
+		row.Values = append(row.Values, value)
+	}
+	return row, nil
+}
+
+func setFields[V any](v V, fields map[string]interface{}) (V, error) {
+	for name, value := range fields {
+		if name == KeyColumn {
+			return v, fmt.Errorf("%s cannot be changed", KeyColumn)
+		}
+		if err := helper.SetFieldValue(&v, name, value); err != nil {
+			return v, err
+		}
+	}
+	return v, nil
+}
+
+func ParseKey[K comparable](key interface{}) (K, error) {
+	var k K
+	if v, ok := key.(K); ok {
+		return v, nil
+	}
+
+	converted, err := helper.ConvertValue(key, reflect.TypeOf(k))
+	if err != nil {
+		return k, fmt.Errorf("%w %v: %v", ErrInvalidKey, key, err)
+	}
+	return converted.Interface().(K), nil
+}
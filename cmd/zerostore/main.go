@@ -0,0 +1,63 @@
+package main
+
+import (
+	"ZeroStore/catalog"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: zerostore [-db dir] [-json] <command> [args]
+
+commands:
+  tables                     list registered tables
+  get <table> <key>          print one row
+  put <table> <key> <json>   insert or replace a row
+  delete <table> <key>       delete a row
+  scan <table>               print every row
+  query <table> <query>      e.g. "where ID < 6 select Name,Email limit 3"
+  explain <table> <query>    print the plan query would run
+  import <table> <file> [key-column]
+                             load .csv, .jsonl/.ndjson or .zcol rows; the key
+                             column defaults to _key
+  export <table> <file>      write every row in the format named by the extension
+  compact <table>            rewrite the data file without dead rows
+  upgrade <table>            rewrite rows stored in an older schema version
+  reencrypt <table>          rewrite rows under the last key in ZEROSTORE_KEYS
+  stats <table>              print file and free list statistics
+  serve <addr>               serve the REST API, e.g. serve :8080
+  resp <addr>                serve the "kv" table to Redis clients, e.g. resp :6379
+  backup <dir>               copy every table into dir while writes continue
+  restore <dir> [time]       restore from dir, replaying logged changes up to an RFC3339 time
+
+Run without a command to start the interactive shell. Set ZEROSTORE_KEYS to
+comma-separated hex AES keys, oldest first, to encrypt the users table.
+`
+
+func main() {
+	dir := flag.String("db", ".", "database directory")
+	asJSON := flag.Bool("json", false, "print rows as JSON instead of tables")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	db, err := catalog.Open(*dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	sh := &shell{db: db, out: os.Stdout, json: *asJSON}
+	if flag.NArg() == 0 {
+		err = sh.repl(os.Stdin)
+	} else {
+		err = sh.run(flag.Args())
+	}
+
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"ZeroStore/resp"
+	"ZeroStore/storageEngine"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+const kvTable = "kv"
+
+func serveRESP(dir, addr string, out io.Writer) error {
+	dt, err := storageEngine.NewDataTable[string, []byte](strings.Compare, filepath.Join(dir, kvTable), 4)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(dt.IndexFile.Name()); err == nil && info.Size() > 0 {
+		if res := dt.LoadIndex(dt.IndexFile.Name()); res.Err != nil {
+			return res.Err
+		}
+	}
+
+	srv := resp.NewServer(dt)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	go func() {
+		<-stop
+		srv.Close()
+	}()
+
+	fmt.Fprintf(out, "serving %s on %s\n", dt.DataFile.Name(), addr)
+	if err := srv.ListenAndServe(addr); err != nil {
+		return err
+	}
+	if err := srv.Close(); err != nil {
+		return err
+	}
+	return dt.Close().Err
+}
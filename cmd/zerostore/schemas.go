@@ -0,0 +1,60 @@
+package main
+
+import (
+	"ZeroStore/catalog"
+	"ZeroStore/helper"
+	"ZeroStore/keys"
+	"ZeroStore/storageEngine"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// rowCacheBytes bounds the row cache of each table the server keeps open.
+const rowCacheBytes = 8 << 20
+
+// bloomRate is the false positive rate of each table's Bloom filters.
+const bloomRate = 0.01
+
+func init() {
+	userOpts := []storageEngine.Option{storageEngine.WithMutationLog(), storageEngine.WithRowCache(rowCacheBytes),
+		storageEngine.WithBloomFilter(bloomRate)}
+	if ring, err := keyRing(os.Getenv("ZEROSTORE_KEYS")); err != nil {
+		fmt.Fprintln(os.Stderr, "ZEROSTORE_KEYS:", err)
+		os.Exit(1)
+	} else if ring != nil {
+		userOpts = append(userOpts, storageEngine.WithEncryption(ring))
+	}
+
+	catalog.Register[int, helper.User]("users", keys.Ordered[int], userOpts...)
+	catalog.Register[int, helper.Post]("posts", keys.Ordered[int], storageEngine.WithMutationLog(),
+		storageEngine.WithCompression(storageEngine.CompressS2, storageEngine.DefaultCompressionThreshold),
+		storageEngine.WithRowCache(rowCacheBytes), storageEngine.WithBloomFilter(bloomRate))
+	catalog.RegisterForeignKey(catalog.ForeignKey{Table: "posts", Column: "UserID", References: "users", OnDelete: catalog.Cascade})
+}
+
+// keyRing parses comma-separated hex keys, oldest first; the last one
+// encrypts new data.
+func keyRing(env string) (*storageEngine.KeyRing, error) {
+	if env == "" {
+		return nil, nil
+	}
+	var ring [][]byte
+	for _, s := range strings.Split(env, ",") {
+		// an empty entry is a retired key that keeps the later ids stable
+		if s = strings.TrimSpace(s); s == "" {
+			ring = append(ring, nil)
+			continue
+		}
+		key, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return nil, fmt.Errorf("key of %d bytes, want 16, 24 or 32", n)
+		}
+		ring = append(ring, key)
+	}
+	return storageEngine.NewKeyRing(ring...), nil
+}
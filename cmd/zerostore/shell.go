@@ -0,0 +1,452 @@
+package main
+
+import (
+	"ZeroStore/catalog"
+	"ZeroStore/queryEngine"
+	"ZeroStore/server"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const historyFile = ".zerostore_history"
+
+type shell struct {
+	db      *catalog.Database
+	out     io.Writer
+	json    bool
+	history []string
+}
+
+// arity is the minimum and maximum number of arguments each command takes
+// after its name. Extra words are folded into the last argument so JSON and
+// queries can contain spaces; the shell passes that argument as typed, see
+// splitLine.
+var arity = map[string][2]int{
+	"tables":    {0, 0},
+	"get":       {2, 2},
+	"put":       {3, 3},
+	"delete":    {2, 2},
+	"scan":      {1, 1},
+	"query":     {1, 2},
+	"explain":   {1, 2},
+	"compact":   {1, 1},
+	"upgrade":   {1, 1},
+	"reencrypt": {1, 1},
+	"stats":     {1, 1},
+	"import":    {2, 3},
+	"export":    {2, 2},
+	"serve":     {1, 1},
+	"resp":      {1, 1},
+	"backup":    {1, 1},
+	"restore":   {1, 2},
+}
+
+func (sh *shell) run(args []string) (err error) {
+	cmd := args[0]
+	n, ok := arity[cmd]
+	if !ok {
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	args = args[1:]
+	if max := n[1]; len(args) > max && max > 0 {
+		args = append(args[:max-1], strings.Join(args[max-1:], " "))
+	}
+	if len(args) < n[0] || len(args) > n[1] {
+		if n[0] == n[1] {
+			return fmt.Errorf("%s expects %d argument(s)", cmd, n[0])
+		}
+		return fmt.Errorf("%s expects %d to %d arguments", cmd, n[0], n[1])
+	}
+
+	if cmd == "serve" {
+		fmt.Fprintf(sh.out, "serving %s on %s\n", sh.db.Dir, args[0])
+		return server.New(sh.db).ListenAndServe(args[0])
+	}
+
+	if cmd == "resp" {
+		return serveRESP(sh.db.Dir, args[0], sh.out)
+	}
+
+	if cmd == "backup" {
+		manifests, err := sh.db.Backup(args[0])
+		for _, m := range manifests {
+			fmt.Fprintf(sh.out, "%s: %d bytes at seq %d\n", m.Table, m.DataSize, m.Seq)
+		}
+		return err
+	}
+
+	if cmd == "restore" {
+		var until time.Time
+		if len(args) > 1 {
+			if until, err = time.Parse(time.RFC3339, args[1]); err != nil {
+				return err
+			}
+		}
+		replayed, err := sh.db.Restore(args[0], until)
+		for _, name := range sh.db.Tables() {
+			if n, ok := replayed[name]; ok {
+				fmt.Fprintf(sh.out, "%s: restored, %d mutations replayed\n", name, n)
+			}
+		}
+		return err
+	}
+
+	if cmd == "tables" {
+		for _, name := range sh.db.Tables() {
+			fmt.Fprintln(sh.out, name)
+		}
+		return nil
+	}
+
+	t, err := sh.db.Table(args[0])
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "get":
+		row, err := t.Get(args[1])
+		if err != nil {
+			return err
+		}
+		if sh.json {
+			return sh.printJSON(row)
+		}
+		return sh.print(t.Columns(), []catalog.Row{row})
+	case "put":
+		return t.Put(args[1], []byte(args[2]))
+	case "delete":
+		return t.Delete(args[1])
+	case "scan":
+		var rows []catalog.Row
+		for res := range t.Scan() {
+			if res.Err != nil {
+				return res.Err
+			}
+			rows = append(rows, res.Value)
+		}
+		return sh.print(t.Columns(), rows)
+	case "query":
+		var q queryEngine.Query
+		if len(args) > 1 {
+			if q, err = queryEngine.ParseQuery(args[1]); err != nil {
+				return err
+			}
+		}
+		rowsChan, err := t.Query(q)
+		if err != nil {
+			return err
+		}
+		var rows []catalog.Row
+		for res := range rowsChan {
+			if res.Err != nil {
+				return res.Err
+			}
+			rows = append(rows, res.Value)
+		}
+		columns := q.Select
+		if len(columns) == 0 {
+			columns = t.Columns()
+		}
+		return sh.print(columns, rows)
+	case "explain":
+		var q queryEngine.Query
+		if len(args) > 1 {
+			if q, err = queryEngine.ParseQuery(args[1]); err != nil {
+				return err
+			}
+		}
+		plan, err := t.Explain(q)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(sh.out, plan)
+		return nil
+	case "import":
+		return sh.importFile(t, args[1:])
+	case "export":
+		return sh.exportFile(t, args[1])
+	case "compact":
+		return t.Compact()
+	case "upgrade":
+		n, err := t.UpgradeRows()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(sh.out, "upgraded %d rows\n", n)
+		return nil
+	case "reencrypt":
+		n, err := t.ReEncrypt()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(sh.out, "re-encrypted %d rows\n", n)
+		return nil
+	case "stats":
+		stats, err := t.Stats()
+		if err != nil {
+			return err
+		}
+		if sh.json {
+			return sh.printJSON(stats)
+		}
+		w := tabwriter.NewWriter(sh.out, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "rows\t%d\n", stats.Rows)
+		fmt.Fprintf(w, "data file\t%d bytes\n", stats.DataFileSize)
+		fmt.Fprintf(w, "index file\t%d bytes\n", stats.IndexFileSize)
+		fmt.Fprintf(w, "free list\t%d nodes, %d bytes\n", stats.FreeNodes, stats.FreeBytes)
+		fmt.Fprintf(w, "row cache\t%d hits, %d misses, %d evictions, %d bytes\n", stats.CacheHits, stats.CacheMisses, stats.CacheEvictions, stats.CacheBytes)
+		fmt.Fprintf(w, "bloom filter\t%d lookups rejected\n", stats.BloomRejects)
+		return w.Flush()
+	}
+	return nil
+}
+
+func (sh *shell) importFile(t catalog.Table, args []string) error {
+	format, err := catalog.FormatFromPath(args[0])
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	keyColumn := ""
+	if len(args) > 1 {
+		keyColumn = args[1]
+	}
+	report, err := t.Import(format, f, keyColumn)
+	for _, lineErr := range report.Errors {
+		fmt.Fprintf(sh.out, "%s: %v\n", args[0], lineErr)
+	}
+	fmt.Fprintf(sh.out, "imported %d rows, %d errors\n", report.Imported, len(report.Errors))
+	return err
+}
+
+func (sh *shell) exportFile(t catalog.Table, path string) error {
+	format, err := catalog.FormatFromPath(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	n, err := t.Export(format, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(sh.out, "exported %d rows\n", n)
+	return nil
+}
+
+func (sh *shell) repl(in io.Reader) error {
+	sh.loadHistory()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for {
+		fmt.Fprint(sh.out, "zerostore> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(sh.out)
+			return scanner.Err()
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "!") {
+			recalled, err := sh.recall(line[1:])
+			if err != nil {
+				fmt.Fprintln(sh.out, "error:", err)
+				continue
+			}
+			line = recalled
+			fmt.Fprintln(sh.out, line)
+		}
+
+		fields, err := splitLine(line)
+		if err != nil {
+			fmt.Fprintln(sh.out, "error:", err)
+			continue
+		}
+		switch fields[0] {
+		case "exit", "quit":
+			return nil
+		case "help":
+			fmt.Fprint(sh.out, usage)
+			fmt.Fprintln(sh.out, "  history                    list previous commands; !n or !! re-runs one")
+			fmt.Fprintln(sh.out, "  format table|json          switch output format")
+			fmt.Fprintln(sh.out, "  exit                       leave the shell")
+			continue
+		case "history":
+			for i, h := range sh.history {
+				fmt.Fprintf(sh.out, "%4d  %s\n", i+1, h)
+			}
+			continue
+		}
+
+		sh.addHistory(line)
+
+		if fields[0] == "format" && len(fields) == 2 {
+			sh.json = fields[1] == "json"
+			continue
+		}
+		if err := sh.run(fields); err != nil {
+			fmt.Fprintln(sh.out, "error:", err)
+		}
+	}
+}
+
+// splitLine splits a shell line into the command and its arguments. Words
+// may be quoted with '...' or "..." to hold spaces, and a backslash escapes
+// the next character inside double quotes. The last argument a command takes
+// is the rest of the line as typed, so JSON and queries keep their quotes
+// and spacing, unless the rest is one quoted word.
+func splitLine(line string) ([]string, error) {
+	name, rest, err := nextWord(line)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{name}
+	last := arity[name][1]
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		if len(args) == last {
+			if rest[0] == '\'' || rest[0] == '"' {
+				word, after, err := nextWord(rest)
+				if err != nil {
+					return nil, err
+				}
+				if strings.TrimSpace(after) == "" {
+					rest = word
+				}
+			}
+			return append(args, rest), nil
+		}
+		var word string
+		if word, rest, err = nextWord(rest); err != nil {
+			return nil, err
+		}
+		args = append(args, word)
+	}
+	return args, nil
+}
+
+// nextWord reads the word at the start of s, which has no leading space,
+// and returns it unquoted along with what follows it.
+func nextWord(s string) (word, rest string, err error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			return b.String(), s[i:], nil
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return "", "", fmt.Errorf("unterminated ' quote")
+			}
+			b.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			for i++; ; i++ {
+				if i >= len(s) {
+					return "", "", fmt.Errorf("unterminated \" quote")
+				}
+				if s[i] == '"' {
+					break
+				}
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), "", nil
+}
+
+func (sh *shell) recall(ref string) (string, error) {
+	if len(sh.history) == 0 {
+		return "", fmt.Errorf("history is empty")
+	}
+	if ref == "!" {
+		return sh.history[len(sh.history)-1], nil
+	}
+	n, err := strconv.Atoi(ref)
+	if err != nil || n < 1 || n > len(sh.history) {
+		return "", fmt.Errorf("no history entry %q", ref)
+	}
+	return sh.history[n-1], nil
+}
+
+func (sh *shell) loadHistory() {
+	data, err := os.ReadFile(filepath.Join(sh.db.Dir, historyFile))
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			sh.history = append(sh.history, line)
+		}
+	}
+}
+
+func (sh *shell) addHistory(line string) {
+	sh.history = append(sh.history, line)
+
+	f, err := os.OpenFile(filepath.Join(sh.db.Dir, historyFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+func (sh *shell) print(columns []string, rows []catalog.Row) error {
+	if sh.json {
+		return sh.printJSON(rows)
+	}
+
+	w := tabwriter.NewWriter(sh.out, 0, 4, 2, ' ', 0)
+	fmt.Fprint(w, catalog.KeyColumn)
+	for _, col := range columns {
+		if col != catalog.KeyColumn {
+			fmt.Fprintf(w, "\t%s", col)
+		}
+	}
+	fmt.Fprintln(w)
+
+	for _, row := range rows {
+		fmt.Fprint(w, row.Key)
+		for _, v := range row.Values {
+			fmt.Fprintf(w, "\t%v", v)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "(%d rows)\n", len(rows))
+	return w.Flush()
+}
+
+func (sh *shell) printJSON(v interface{}) error {
+	enc := json.NewEncoder(sh.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
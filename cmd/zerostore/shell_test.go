@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"tables", []string{"tables"}},
+		{"get users 7", []string{"get", "users", "7"}},
+		{`get kv "two  words"`, []string{"get", "kv", "two  words"}},
+		{`get kv 'it''s'`, []string{"get", "kv", "its"}},
+		{`get kv "say \"hi\""`, []string{"get", "kv", `say "hi"`}},
+		{`delete "my table" a\b`, []string{"delete", "my table", `a\b`}},
+		{`put users 1 {"Name": "Ada  Lovelace", "Age": 36}`, []string{"put", "users", "1", `{"Name": "Ada  Lovelace", "Age": 36}`}},
+		{`put users 1 '{"Name": "Ada"}'`, []string{"put", "users", "1", `{"Name": "Ada"}`}},
+		{`put users 1 {"Name":"it's"}`, []string{"put", "users", "1", `{"Name":"it's"}`}},
+		{`query users where Name = "Ada  L" limit 2`, []string{"query", "users", `where Name = "Ada  L" limit 2`}},
+		{`query users "where ID < 6"`, []string{"query", "users", "where ID < 6"}},
+		{"query   users", []string{"query", "users"}},
+		{"import users a.csv  Email", []string{"import", "users", "a.csv", "Email"}},
+		{"format json", []string{"format", "json"}},
+	}
+	for _, tt := range tests {
+		got, err := splitLine(tt.line)
+		if err != nil {
+			t.Errorf("splitLine(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	for _, line := range []string{`get kv "open`, `get 'open kv`} {
+		if _, err := splitLine(line); err == nil {
+			t.Errorf("splitLine(%q) accepted an unterminated quote", line)
+		}
+	}
+}
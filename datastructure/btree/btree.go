@@ -3,6 +3,7 @@ package btree
 import (
 	"encoding/gob"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 )
@@ -37,6 +38,67 @@ func (bt *BTree[K, V]) GetAll() []KVPair[K, V] {
 	return bt.getAll(bt.root)
 }
 
+// Range returns the pairs with start <= key < end in key order, skipping
+// subtrees that lie outside the bounds.
+func (bt *BTree[K, V]) Range(start, end K) []KVPair[K, V] {
+	var result []KVPair[K, V]
+	bt.rangeNode(bt.root, start, end, &result)
+	return result
+}
+
+func (bt *BTree[K, V]) rangeNode(node *BTreeNode[K, V], start, end K, result *[]KVPair[K, V]) {
+	if node == nil {
+		return
+	}
+	for i, key := range node.Keys {
+		afterStart := bt.compare(key, start) >= 0
+		if !node.IsLeaf && afterStart {
+			bt.rangeNode(node.Children[i], start, end, result)
+		}
+		if bt.compare(key, end) >= 0 {
+			return
+		}
+		if afterStart {
+			*result = append(*result, KVPair[K, V]{Key: key, Value: node.Values[i]})
+		}
+	}
+	if !node.IsLeaf {
+		bt.rangeNode(node.Children[len(node.Keys)], start, end, result)
+	}
+}
+
+// From returns up to limit pairs with key >= start in key order, visiting
+// only the nodes on the way to them.
+func (bt *BTree[K, V]) From(start K, limit int) []KVPair[K, V] {
+	var result []KVPair[K, V]
+	if limit > 0 {
+		bt.fromNode(bt.root, start, limit, &result)
+	}
+	return result
+}
+
+// fromNode reports whether result is full.
+func (bt *BTree[K, V]) fromNode(node *BTreeNode[K, V], start K, limit int, result *[]KVPair[K, V]) bool {
+	if node == nil {
+		return false
+	}
+	for i, key := range node.Keys {
+		if bt.compare(key, start) < 0 {
+			continue
+		}
+		if !node.IsLeaf && bt.fromNode(node.Children[i], start, limit, result) {
+			return true
+		}
+		if *result = append(*result, KVPair[K, V]{Key: key, Value: node.Values[i]}); len(*result) == limit {
+			return true
+		}
+	}
+	if !node.IsLeaf {
+		return bt.fromNode(node.Children[len(node.Keys)], start, limit, result)
+	}
+	return false
+}
+
 func (bt *BTree[K, V]) getAll(node *BTreeNode[K, V]) []KVPair[K, V] {
 	var result []KVPair[K, V]
 
@@ -60,6 +122,37 @@ func (bt *BTree[K, V]) getAll(node *BTreeNode[K, V]) []KVPair[K, V] {
 	return result
 }
 
+func (bt *BTree[K, V]) Len() int {
+	return bt.len(bt.root)
+}
+
+func (bt *BTree[K, V]) len(node *BTreeNode[K, V]) int {
+	if node == nil {
+		return 0
+	}
+	n := len(node.Keys)
+	for _, child := range node.Children {
+		n += bt.len(child)
+	}
+	return n
+}
+
+// Max returns the largest key, or false when the tree is empty.
+func (bt *BTree[K, V]) Max() (K, bool) {
+	var max K
+	found := false
+	for node := bt.root; node != nil; {
+		if len(node.Keys) > 0 {
+			max, found = node.Keys[len(node.Keys)-1], true
+		}
+		if node.IsLeaf || len(node.Children) == 0 {
+			break
+		}
+		node = node.Children[len(node.Children)-1]
+	}
+	return max, found
+}
+
 func (bt *BTree[K, V]) Insert(key K, value V) {
 	if bt.root == nil {
 		bt.root = &BTreeNode[K, V]{IsLeaf: true}
@@ -189,16 +282,21 @@ func (bt *BTree[K, V]) delete(node *BTreeNode[K, V], key K) (V, bool) {
 			node.Values = append(node.Values[:idx], node.Values[idx+1:]...)
 			return deletedValue, true
 		} else {
+			// the key is replaced by its predecessor or successor, whose own
+			// deletion below returns that key's value rather than this one
+			deletedValue := node.Values[idx]
 			if len(node.Children[idx].Keys) >= t {
 				predKey, predVal := bt.getPred(node, idx)
 				node.Keys[idx] = predKey
 				node.Values[idx] = predVal
-				return bt.delete(node.Children[idx], predKey)
+				bt.delete(node.Children[idx], predKey)
+				return deletedValue, true
 			} else if len(node.Children[idx+1].Keys) >= t {
 				succKey, succVal := bt.getSucc(node, idx)
 				node.Keys[idx] = succKey
 				node.Values[idx] = succVal
-				return bt.delete(node.Children[idx+1], succKey)
+				bt.delete(node.Children[idx+1], succKey)
+				return deletedValue, true
 			} else {
 				bt.merge(node, idx)
 				return bt.delete(node.Children[idx], key)
@@ -313,6 +411,63 @@ func (bt *BTree[K, V]) borrowFromNext(node *BTreeNode[K, V], idx int) {
 	sibling.Values = sibling.Values[1:]
 }
 
+// BulkLoad replaces the tree with one built bottom-up from pairs, which must
+// already be sorted by key. Nodes are filled close to 2t-1 keys and every
+// non-root node keeps at least t-1, so later inserts and deletes behave as
+// they would on a tree built by Insert.
+func (bt *BTree[K, V]) BulkLoad(pairs []KVPair[K, V]) {
+	bt.root = nil
+	if len(pairs) == 0 {
+		return
+	}
+
+	maxKeys := 2*bt.t - 1
+	keys := make([]K, len(pairs))
+	values := make([]V, len(pairs))
+	for i, p := range pairs {
+		keys[i], values[i] = p.Key, p.Value
+	}
+
+	var children []*BTreeNode[K, V]
+	for len(keys) > maxKeys {
+		// the fewest nodes that hold the keys left after taking one
+		// separator between each pair: ceil((n+1)/(maxKeys+1)), at least 2
+		// here. Spread evenly, each then gets between t-1 and 2t-1 keys.
+		nodeCount := (len(keys) + 1 + maxKeys) / (maxKeys + 1)
+		perNode := len(keys) - (nodeCount - 1)
+
+		var upKeys []K
+		var upValues []V
+		nodes := make([]*BTreeNode[K, V], 0, nodeCount)
+		pos, childPos := 0, 0
+		for i := 0; i < nodeCount; i++ {
+			size := perNode / nodeCount
+			if i < perNode%nodeCount {
+				size++
+			}
+
+			node := &BTreeNode[K, V]{IsLeaf: children == nil}
+			node.Keys = append([]K(nil), keys[pos:pos+size]...)
+			node.Values = append([]V(nil), values[pos:pos+size]...)
+			if children != nil {
+				node.Children = append([]*BTreeNode[K, V](nil), children[childPos:childPos+size+1]...)
+				childPos += size + 1
+			}
+			nodes = append(nodes, node)
+			pos += size
+
+			if i < nodeCount-1 {
+				upKeys = append(upKeys, keys[pos])
+				upValues = append(upValues, values[pos])
+				pos++
+			}
+		}
+		keys, values, children = upKeys, upValues, nodes
+	}
+
+	bt.root = &BTreeNode[K, V]{IsLeaf: children == nil, Keys: keys, Values: values, Children: children}
+}
+
 func (bt *BTree[K, V]) Clear() {
 	bt.root = nil
 }
@@ -345,8 +500,12 @@ func (bt *BTree[K, V]) prettyPrint(node *BTreeNode[K, V], level int) {
 
 func (bt *BTree[K, V]) Save(file *os.File) error {
 	defer file.Close()
+	return bt.SaveTo(file)
+}
 
-	encoder := gob.NewEncoder(file)
+// SaveTo writes the tree to w in the format Load reads.
+func (bt *BTree[K, V]) SaveTo(w io.Writer) error {
+	encoder := gob.NewEncoder(w)
 
 	var saveNode func(node *BTreeNode[K, V]) error
 	saveNode = func(node *BTreeNode[K, V]) error {
@@ -379,8 +538,12 @@ func (bt *BTree[K, V]) Save(file *os.File) error {
 
 func (bt *BTree[K, V]) Load(file *os.File) error {
 	defer file.Close()
+	return bt.LoadFrom(file)
+}
 
-	decoder := gob.NewDecoder(file)
+// LoadFrom replaces the tree with one written by SaveTo.
+func (bt *BTree[K, V]) LoadFrom(r io.Reader) error {
+	decoder := gob.NewDecoder(r)
 
 	var loadNode func() (*BTreeNode[K, V], error)
 	loadNode = func() (*BTreeNode[K, V], error) {
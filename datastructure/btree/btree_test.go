@@ -0,0 +1,133 @@
+package btree
+
+import (
+	"cmp"
+	"testing"
+)
+
+// checkNode walks the subtree under node, failing if a node other than the
+// root holds fewer than t-1 or more than 2t-1 keys, if keys are out of
+// order, or if leaves sit at different depths. It returns the leaf depth.
+func checkNode(t *testing.T, bt *BTree[int, int], node *BTreeNode[int, int], root bool, lo, hi *int) int {
+	t.Helper()
+	n := len(node.Keys)
+	if n > 2*bt.t-1 {
+		t.Fatalf("node has %d keys, more than %d", n, 2*bt.t-1)
+	}
+	if !root && n < bt.t-1 {
+		t.Fatalf("node has %d keys, fewer than %d", n, bt.t-1)
+	}
+	if root && n == 0 {
+		t.Fatalf("root has no keys")
+	}
+	if len(node.Values) != n {
+		t.Fatalf("node has %d keys but %d values", n, len(node.Values))
+	}
+	for i, k := range node.Keys {
+		if (i > 0 && node.Keys[i-1] >= k) || (lo != nil && k <= *lo) || (hi != nil && k >= *hi) {
+			t.Fatalf("key %d out of order in %v", k, node.Keys)
+		}
+	}
+	if node.IsLeaf {
+		if len(node.Children) != 0 {
+			t.Fatalf("leaf has %d children", len(node.Children))
+		}
+		return 0
+	}
+	if len(node.Children) != n+1 {
+		t.Fatalf("node has %d keys but %d children", n, len(node.Children))
+	}
+	depth := -1
+	for i, child := range node.Children {
+		clo, chi := lo, hi
+		if i > 0 {
+			clo = &node.Keys[i-1]
+		}
+		if i < n {
+			chi = &node.Keys[i]
+		}
+		d := checkNode(t, bt, child, false, clo, chi)
+		if depth >= 0 && d != depth {
+			t.Fatalf("leaves at depths %d and %d", depth, d+1)
+		}
+		depth = d
+	}
+	return depth + 1
+}
+
+func checkTree(t *testing.T, bt *BTree[int, int], want int) {
+	t.Helper()
+	if bt.root != nil {
+		checkNode(t, bt, bt.root, true, nil, nil)
+	}
+	if got := bt.Len(); got != want {
+		t.Fatalf("Len() = %d, want %d", got, want)
+	}
+}
+
+func TestBulkLoadNodeBounds(t *testing.T) {
+	for degree := 2; degree <= 5; degree++ {
+		for n := 0; n <= 400; n++ {
+			bt := NewBTree[int, int](degree, cmp.Compare[int])
+			pairs := make([]KVPair[int, int], n)
+			for i := range pairs {
+				pairs[i] = KVPair[int, int]{Key: 2 * i, Value: i}
+			}
+			bt.BulkLoad(pairs)
+			checkTree(t, bt, n)
+
+			for i := 0; i < n; i++ {
+				if v, ok := bt.Search(2 * i); !ok || v != i {
+					t.Fatalf("t=%d n=%d: Search(%d) = %d, %v", degree, n, 2*i, v, ok)
+				}
+			}
+
+			// inserts must keep splitting nodes as on a tree built by Insert
+			for i := 0; i < n; i++ {
+				bt.Insert(2*i+1, i)
+			}
+			checkTree(t, bt, 2*n)
+		}
+	}
+}
+
+func TestBulkLoadThenDelete(t *testing.T) {
+	bt := NewBTree[int, int](4, cmp.Compare[int])
+	pairs := make([]KVPair[int, int], 1000)
+	for i := range pairs {
+		pairs[i] = KVPair[int, int]{Key: i, Value: i}
+	}
+	bt.BulkLoad(pairs)
+	for i := 0; i < 1000; i += 3 {
+		if _, ok := bt.Delete(i); !ok {
+			t.Fatalf("Delete(%d) found nothing", i)
+		}
+	}
+	checkTree(t, bt, 1000-334)
+}
+
+func TestFrom(t *testing.T) {
+	bt := NewBTree[int, int](3, cmp.Compare[int])
+	for i := 0; i < 200; i += 2 {
+		bt.Insert(i, i)
+	}
+	for _, start := range []int{-5, 0, 1, 57, 198, 199} {
+		for _, limit := range []int{0, 1, 7, 500} {
+			var want []int
+			for k := max(start, 0); k < 200 && len(want) < limit; k++ {
+				if k%2 == 0 {
+					want = append(want, k)
+				}
+			}
+			got := bt.From(start, limit)
+			if len(got) != len(want) {
+				t.Fatalf("From(%d, %d) returned %d pairs, want %d", start, limit, len(got), len(want))
+			}
+			for i, p := range got {
+				if p.Key != want[i] || p.Value != want[i] {
+					t.Fatalf("From(%d, %d)[%d] = %v, want %d", start, limit, i, p, want[i])
+				}
+			}
+		}
+	}
+}
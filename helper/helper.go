@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strconv"
+	"strings"
 )
 
 func FileExists(filename string) bool {
@@ -39,3 +41,137 @@ func GetFieldNames[V any]() ([]string, error) {
 
 	return fieldNames, nil
 }
+
+func CompareValues(a, b interface{}) (int, error) {
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			switch {
+			case af < bf:
+				return -1, nil
+			case af > bf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+
+	switch av := a.(type) {
+	case string:
+		return strings.Compare(av, fmt.Sprint(b)), nil
+	case bool:
+		bv, ok := b.(bool)
+		if !ok {
+			break
+		}
+		if av == bv {
+			return 0, nil
+		}
+		if !av {
+			return -1, nil
+		}
+		return 1, nil
+	}
+
+	if bs, ok := b.(string); ok {
+		return strings.Compare(fmt.Sprint(a), bs), nil
+	}
+
+	return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	val := reflect.ValueOf(v)
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), true
+	}
+	return 0, false
+}
+
+func GetFieldValue(v interface{}, name string) (interface{}, error) {
+	val := reflect.Indirect(reflect.ValueOf(v))
+	if val.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("provided Data type is not a struct")
+	}
+
+	field := val.FieldByName(name)
+	if !field.IsValid() {
+		return nil, fmt.Errorf("field %s not found in struct", name)
+	}
+	return field.Interface(), nil
+}
+
+func SetFieldValue(ptr interface{}, name string, value interface{}) error {
+	val := reflect.ValueOf(ptr)
+	if val.Kind() != reflect.Pointer || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("provided Data type is not a pointer to a struct")
+	}
+
+	field := val.Elem().FieldByName(name)
+	if !field.IsValid() {
+		return fmt.Errorf("field %s not found in struct", name)
+	}
+
+	converted, err := ConvertValue(value, field.Type())
+	if err != nil {
+		return fmt.Errorf("field %s: %w", name, err)
+	}
+	field.Set(converted)
+	return nil
+}
+
+func ConvertValue(value interface{}, t reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		return reflect.Zero(t), nil
+	}
+
+	src := reflect.ValueOf(value)
+	if src.Type().AssignableTo(t) {
+		return src, nil
+	}
+
+	if s, ok := value.(string); ok {
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(n).Convert(t), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(n).Convert(t), nil
+		case reflect.Float32, reflect.Float64:
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(f).Convert(t), nil
+		case reflect.Bool:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(b).Convert(t), nil
+		}
+	}
+
+	if t.Kind() == reflect.String {
+		return reflect.ValueOf(fmt.Sprint(value)).Convert(t), nil
+	}
+
+	if _, ok := toFloat(value); ok && src.CanConvert(t) {
+		if _, numeric := toFloat(reflect.Zero(t).Interface()); numeric {
+			return src.Convert(t), nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot convert %T to %s", value, t)
+}
@@ -8,15 +8,15 @@ import (
 )
 
 type User struct {
-	ID       int    `json:"id"`
+	ID       int    `json:"id" zerostore:"pk"`
 	Name     string `json:"name"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
 }
 
 type Post struct {
-	UserID int    `json:"userId"`
-	ID     int    `json:"id"`
+	UserID int    `json:"userId" zerostore:"index"`
+	ID     int    `json:"id" zerostore:"pk"`
 	Title  string `json:"title"`
 	Body   string `json:"body"`
 }
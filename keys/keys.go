@@ -0,0 +1,253 @@
+// Package keys provides comparators for DataTable keys and an order
+// preserving encoding that turns tuples of values into a single Key whose
+// byte order matches the order of the values.
+package keys
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidKey = errors.New("invalid encoded key")
+
+// Ordered compares any integer, float or string key type.
+func Ordered[T cmp.Ordered](a, b T) int {
+	return cmp.Compare(a, b)
+}
+
+func Time(a, b time.Time) int {
+	return a.Compare(b)
+}
+
+func UUID(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+// Key is an encoded tuple. Keys compare byte by byte, so a Key-keyed table
+// uses Compare and every tuple sorts element by element.
+type Key string
+
+func Compare(a, b Key) int {
+	return strings.Compare(string(a), string(b))
+}
+
+// type tags, which also order values of different types at one position
+const (
+	tagFalse byte = 0x10 + iota
+	tagTrue
+	tagInt
+	tagUint
+	tagFloat
+	tagTime
+	tagBytes
+	tagString
+	tagUUID
+)
+
+// Encode appends each value to the key. Supported are bools, signed and
+// unsigned integers (widened to 64 bits), floats, strings, []byte,
+// time.Time and uuid.UUID. A key encoded from a prefix of the values is a
+// byte prefix of the full key.
+func Encode(values ...any) (Key, error) {
+	var b []byte
+	for _, v := range values {
+		var err error
+		if b, err = appendValue(b, v); err != nil {
+			return "", err
+		}
+	}
+	return Key(b), nil
+}
+
+// MustEncode is Encode for values known to be supported.
+func MustEncode(values ...any) Key {
+	k, err := Encode(values...)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+func appendValue(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return append(b, tagTrue), nil
+		}
+		return append(b, tagFalse), nil
+	case int:
+		return appendInt(b, int64(v)), nil
+	case int8:
+		return appendInt(b, int64(v)), nil
+	case int16:
+		return appendInt(b, int64(v)), nil
+	case int32:
+		return appendInt(b, int64(v)), nil
+	case int64:
+		return appendInt(b, v), nil
+	case uint:
+		return appendUint(b, tagUint, uint64(v)), nil
+	case uint8:
+		return appendUint(b, tagUint, uint64(v)), nil
+	case uint16:
+		return appendUint(b, tagUint, uint64(v)), nil
+	case uint32:
+		return appendUint(b, tagUint, uint64(v)), nil
+	case uint64:
+		return appendUint(b, tagUint, v), nil
+	case float32:
+		return appendFloat(b, float64(v)), nil
+	case float64:
+		return appendFloat(b, v), nil
+	case string:
+		return appendBytes(append(b, tagString), []byte(v)), nil
+	case []byte:
+		return appendBytes(append(b, tagBytes), v), nil
+	case time.Time:
+		return appendUint(b, tagTime, uint64(v.UnixNano())^(1<<63)), nil
+	case uuid.UUID:
+		return append(append(b, tagUUID), v[:]...), nil
+	}
+	return nil, fmt.Errorf("keys: cannot encode %T", v)
+}
+
+// appendInt flips the sign bit so negative numbers sort first.
+func appendInt(b []byte, v int64) []byte {
+	return appendUint(b, tagInt, uint64(v)^(1<<63))
+}
+
+func appendUint(b []byte, tag byte, v uint64) []byte {
+	b = append(b, tag)
+	return binary.BigEndian.AppendUint64(b, v)
+}
+
+// appendFloat flips the sign bit of positive numbers and every bit of
+// negative ones, which makes the IEEE 754 bits sort numerically.
+func appendFloat(b []byte, v float64) []byte {
+	bits := math.Float64bits(v)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return appendUint(b, tagFloat, bits)
+}
+
+// appendBytes escapes 0x00 as 0x00 0xFF and ends the value with 0x00 0x01,
+// so a string sorts before every longer string it is a prefix of.
+func appendBytes(b, v []byte) []byte {
+	for _, c := range v {
+		if c == 0 {
+			b = append(b, 0, 0xFF)
+			continue
+		}
+		b = append(b, c)
+	}
+	return append(b, 0, 1)
+}
+
+// Decode returns the values of k: bools, int64, uint64, float64, string,
+// []byte, time.Time and uuid.UUID.
+func Decode(k Key) ([]any, error) {
+	var values []any
+	b := []byte(k)
+	for len(b) > 0 {
+		tag := b[0]
+		b = b[1:]
+		switch tag {
+		case tagFalse, tagTrue:
+			values = append(values, tag == tagTrue)
+		case tagInt, tagUint, tagFloat, tagTime:
+			if len(b) < 8 {
+				return nil, ErrInvalidKey
+			}
+			u := binary.BigEndian.Uint64(b)
+			b = b[8:]
+			switch tag {
+			case tagInt:
+				values = append(values, int64(u^(1<<63)))
+			case tagUint:
+				values = append(values, u)
+			case tagFloat:
+				if u&(1<<63) != 0 {
+					u &^= 1 << 63
+				} else {
+					u = ^u
+				}
+				values = append(values, math.Float64frombits(u))
+			case tagTime:
+				values = append(values, time.Unix(0, int64(u^(1<<63))).UTC())
+			}
+		case tagString, tagBytes:
+			var v []byte
+			var err error
+			if v, b, err = readBytes(b); err != nil {
+				return nil, err
+			}
+			if tag == tagString {
+				values = append(values, string(v))
+			} else {
+				values = append(values, v)
+			}
+		case tagUUID:
+			if len(b) < 16 {
+				return nil, ErrInvalidKey
+			}
+			values = append(values, uuid.UUID(b[:16]))
+			b = b[16:]
+		default:
+			return nil, fmt.Errorf("%w: unknown tag %#x", ErrInvalidKey, tag)
+		}
+	}
+	return values, nil
+}
+
+func readBytes(b []byte) (v, rest []byte, err error) {
+	for i := 0; i+1 < len(b); i++ {
+		if b[i] != 0 {
+			v = append(v, b[i])
+			continue
+		}
+		switch b[i+1] {
+		case 0xFF:
+			v = append(v, 0)
+			i++
+		case 1:
+			return v, b[i+2:], nil
+		default:
+			return nil, nil, ErrInvalidKey
+		}
+	}
+	return nil, nil, ErrInvalidKey
+}
+
+// PrefixRange returns the bounds of every key that starts with values, for
+// use with DataTable.Range: start is inclusive and end exclusive.
+func PrefixRange(values ...any) (start, end Key, err error) {
+	if start, err = Encode(values...); err != nil {
+		return "", "", err
+	}
+	return start, PrefixEnd(start), nil
+}
+
+// PrefixEnd returns the smallest key greater than every key starting with
+// prefix, or "" when there is none.
+func PrefixEnd(prefix Key) Key {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] != 0xFF {
+			end := append([]byte(nil), b[:i+1]...)
+			end[i]++
+			return Key(end)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package keys
+
+import (
+	"cmp"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// checkOrder fails unless every pair of values compares the same as its
+// encoding.
+func checkOrder[T any](t *testing.T, values []T, compare func(a, b T) int) {
+	t.Helper()
+	for _, a := range values {
+		for _, b := range values {
+			want := compare(a, b)
+			if got := Compare(MustEncode(a), MustEncode(b)); got != want {
+				t.Errorf("%#v vs %#v: encoded keys compare %d, values %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestEncodingSortsLikeValues(t *testing.T) {
+	checkOrder(t, []int64{math.MinInt64, -1 << 40, -256, -1, 0, 1, 255, 256, 1 << 40, math.MaxInt64}, cmp.Compare[int64])
+	checkOrder(t, []uint64{0, 1, 255, 256, 1 << 63, math.MaxUint64}, cmp.Compare[uint64])
+	// -0 is left out: it equals 0 but encodes below it
+	checkOrder(t, []float64{math.Inf(-1), -math.MaxFloat64, -1.5, -1, -math.SmallestNonzeroFloat64, 0,
+		math.SmallestNonzeroFloat64, 0.5, 1, 1e300, math.Inf(1)}, cmp.Compare[float64])
+	checkOrder(t, []string{"", "\x00", "\x00\x00", "\x00a", "a", "a\x00", "a\x00\x00", "a\x00b", "a\x01", "ab", "abc", "b", "\xff"},
+		cmp.Compare[string])
+	checkOrder(t, []bool{false, true}, func(a, b bool) int {
+		switch {
+		case a == b:
+			return 0
+		case a:
+			return 1
+		}
+		return -1
+	})
+	now := time.Now()
+	checkOrder(t, []time.Time{time.Unix(-1e9, 0), time.Unix(0, 0), now, now.Add(time.Nanosecond)}, Time)
+	checkOrder(t, []uuid.UUID{{}, uuid.MustParse("00000000-0000-0000-0000-000000000001"), {0x80}, uuid.Max}, UUID)
+}
+
+func TestTuplesSortElementByElement(t *testing.T) {
+	type tuple struct {
+		n int
+		s string
+	}
+	var tuples []tuple
+	for _, n := range []int{-2, -1, 0, 1} {
+		for _, s := range []string{"", "a", "a\x00", "ab", "b"} {
+			tuples = append(tuples, tuple{n, s})
+		}
+	}
+	for _, a := range tuples {
+		for _, b := range tuples {
+			want := cmp.Or(cmp.Compare(a.n, b.n), cmp.Compare(a.s, b.s))
+			if got := Compare(MustEncode(a.n, a.s), MustEncode(b.n, b.s)); got != want {
+				t.Errorf("%v vs %v: encoded keys compare %d, tuples %d", a, b, got, want)
+			}
+		}
+	}
+
+	// a shorter tuple sorts before every tuple it is a prefix of
+	if Compare(MustEncode("a"), MustEncode("a", math.MinInt64)) >= 0 {
+		t.Error("a tuple sorts after a longer one starting with it")
+	}
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	id := uuid.MustParse("0190a8a2-7b2e-7c3d-8f00-0123456789ab")
+	when := time.Unix(1700000000, 123).UTC()
+	values := []any{true, false, int64(-7), uint64(7), -2.5, "a\x00b", []byte{0, 1, 0xff}, when, id}
+	got, err := Decode(MustEncode(values...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, values) {
+		t.Fatalf("Decode = %#v, want %#v", got, values)
+	}
+	// narrower types come back widened
+	if got, _ := Decode(MustEncode(int8(-3), uint16(3), float32(0.5))); !reflect.DeepEqual(got, []any{int64(-3), uint64(3), 0.5}) {
+		t.Fatalf("Decode of narrow types = %#v", got)
+	}
+
+	if _, err := Encode(struct{}{}); err == nil {
+		t.Error("Encode accepted a struct")
+	}
+	for _, k := range []Key{"\x12\x00", "\x17abc", "\x17a\x00\x02", "\x01"} {
+		if _, err := Decode(k); err == nil {
+			t.Errorf("Decode(%q) accepted a malformed key", k)
+		}
+	}
+}
+
+func TestPrefixRange(t *testing.T) {
+	start, end, err := PrefixRange(int64(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inside := []Key{MustEncode(1), MustEncode(1, ""), MustEncode(1, "z"), MustEncode(1, math.MaxInt64)}
+	outside := []Key{MustEncode(0, "z"), MustEncode(2), MustEncode(2, "")}
+	for _, k := range inside {
+		if Compare(k, start) < 0 || Compare(k, end) >= 0 {
+			t.Errorf("%q is outside [%q, %q)", k, start, end)
+		}
+	}
+	for _, k := range outside {
+		if Compare(k, start) >= 0 && Compare(k, end) < 0 {
+			t.Errorf("%q is inside [%q, %q)", k, start, end)
+		}
+	}
+	if end := PrefixEnd("\xff\xff"); end != "" {
+		t.Errorf("PrefixEnd of all 0xFF = %q, want none", end)
+	}
+}
@@ -1,33 +1,79 @@
 package main
 
 import (
+	"ZeroStore/datastructure/btree"
 	"ZeroStore/helper"
+	"ZeroStore/keys"
 	"ZeroStore/queryEngine"
 	"ZeroStore/storageEngine"
 	"ZeroStore/test"
 	"fmt"
+	"os"
+	"path/filepath"
 )
 
 func storeTest() {
 	fmt.Println("running test on ZeroStore")
 
-	dt, _ := storageEngine.NewDataTable[int, test.Row](compare, "test/test", 4)
-	for i := 1; i < test.NumberOfRows; i++ {
-		a := test.GenerateRow(1024)
-		dt.Insert(i, a)
+	dt, _ := storageEngine.NewDataTable[int, test.Row](keys.Ordered[int], "test/test", 4,
+		storageEngine.WithCompression(storageEngine.CompressS2, storageEngine.DefaultCompressionThreshold))
+	rows := make(chan btree.KVPair[int, test.Row], 1024)
+	go func() {
+		defer close(rows)
+		for i := 1; i < test.NumberOfRows; i++ {
+			rows <- btree.KVPair[int, test.Row]{Key: i, Value: test.GenerateRow(1024)}
+		}
+	}()
+	if res := dt.BulkLoad(rows); res.Err != nil {
+		panic(res.Err)
 	}
-	dt.SaveIndex()
 
-	test.CalculateEfficiencyPercentage("test/test_data.bin", test.NumberOfRows, 1024)
+	stats := dt.CompressionStats()
+	if stats.Err != nil {
+		panic(stats.Err)
+	}
+	test.CalculateEfficiencyPercentage("test/test_data.bin", test.NumberOfRows, 1024, stats.Value)
 }
 
-func compare(a, b int) int {
-	if a > b {
-		return 1
-	} else if a == b {
-		return 0
-	} else {
-		return -1
+// cacheTest compares Zipf-distributed lookups with and without a row cache.
+func cacheTest() {
+	const numRows, lookups = 100000, 1000000
+	fmt.Println("running row cache test on ZeroStore")
+
+	for _, run := range []struct {
+		name  string
+		bytes int64
+	}{{"no cache", 0}, {"16MiB cache", 16 << 20}} {
+		dbName := "test/cache"
+		if run.bytes > 0 {
+			dbName += "_lru"
+		}
+		// start from empty files so both runs read the same layout
+		old, _ := filepath.Glob(dbName + "_*.bin")
+		for _, path := range old {
+			os.Remove(path)
+		}
+		dt, err := storageEngine.NewDataTable[int, test.Row](keys.Ordered[int], dbName, 4, storageEngine.WithRowCache(run.bytes))
+		if err != nil {
+			panic(err)
+		}
+		rows := make(chan btree.KVPair[int, test.Row], 1024)
+		go func() {
+			defer close(rows)
+			for i := 1; i < numRows; i++ {
+				rows <- btree.KVPair[int, test.Row]{Key: i, Value: test.GenerateRow(1024)}
+			}
+		}()
+		if res := dt.BulkLoad(rows); res.Err != nil {
+			panic(res.Err)
+		}
+
+		elapsed, stats, err := test.ZipfLookups(dt, numRows, lookups)
+		if err != nil {
+			panic(err)
+		}
+		test.PrintLookups(run.name, lookups, elapsed, stats)
+		dt.Close()
 	}
 }
 
@@ -40,7 +86,7 @@ func main() {
 	// var dt *storageEngine.DataTable[int, emp]
 	// var err error
 
-	// if dt, err = storageEngine.NewDataTable[int, emp](compare, "testing", 4, true); err != nil {
+	// if dt, err = storageEngine.NewDataTable[int, emp](keys.Ordered[int], "testing", 4, true); err != nil {
 	// 	panic(err)
 	// }
 
@@ -63,10 +109,10 @@ func main() {
 	var pt *storageEngine.DataTable[int, helper.Post]
 	var err error
 
-	if ut, err = storageEngine.NewDataTable[int, helper.User](compare, "users", 4); err != nil {
+	if ut, err = storageEngine.NewDataTable[int, helper.User](keys.Ordered[int], "users", 4); err != nil {
 		panic(err)
 	}
-	if pt, err = storageEngine.NewDataTable[int, helper.Post](compare, "posts", 4); err != nil {
+	if pt, err = storageEngine.NewDataTable[int, helper.Post](keys.Ordered[int], "posts", 4); err != nil {
 		panic(err)
 	}
 
@@ -0,0 +1,210 @@
+package queryEngine
+
+import (
+	"ZeroStore/helper"
+	"ZeroStore/storageEngine"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const KeyField = "_key"
+
+type Condition struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+type Query struct {
+	Where  []Condition `json:"where,omitempty"`
+	Select []string    `json:"select,omitempty"`
+	Limit  int         `json:"limit,omitempty"`
+}
+
+var operators = map[string]func(cmp int) bool{
+	"=":  func(cmp int) bool { return cmp == 0 },
+	"==": func(cmp int) bool { return cmp == 0 },
+	"!=": func(cmp int) bool { return cmp != 0 },
+	"<":  func(cmp int) bool { return cmp < 0 },
+	"<=": func(cmp int) bool { return cmp <= 0 },
+	">":  func(cmp int) bool { return cmp > 0 },
+	">=": func(cmp int) bool { return cmp >= 0 },
+}
+
+func (c Condition) Match(value interface{}) bool {
+	if strings.EqualFold(c.Op, "contains") {
+		return strings.Contains(fmt.Sprint(value), fmt.Sprint(c.Value))
+	}
+
+	match, ok := operators[c.Op]
+	if !ok {
+		return false
+	}
+	cmp, err := helper.CompareValues(value, c.Value)
+	if err != nil {
+		return false
+	}
+	return match(cmp)
+}
+
+func (c Condition) validate() error {
+	if _, ok := operators[c.Op]; !ok && !strings.EqualFold(c.Op, "contains") {
+		return fmt.Errorf("unknown operator %q", c.Op)
+	}
+	return nil
+}
+
+func Filter[K comparable, V any](conds []Condition) (func(storageEngine.DataRow[K, V]) bool, error) {
+	var v V
+	vType := reflect.TypeOf(v)
+
+	fields := make([][]int, len(conds))
+	for i, c := range conds {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+		if c.Field == KeyField {
+			continue
+		}
+		// only conditions on fields need a struct; _key works for any row
+		if vType == nil || vType.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("provided Data type is not a struct")
+		}
+		f, ok := vType.FieldByName(c.Field)
+		if !ok {
+			return nil, fmt.Errorf("field %s not found in struct", c.Field)
+		}
+		fields[i] = f.Index
+	}
+
+	return func(row storageEngine.DataRow[K, V]) bool {
+		data := reflect.ValueOf(row.Data)
+		for i, c := range conds {
+			var value interface{}
+			if fields[i] == nil {
+				value = row.PrimaryKey
+			} else {
+				value = data.FieldByIndex(fields[i]).Interface()
+			}
+			if !c.Match(value) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// ParseQuery reads the textual form used by the CLI, e.g.
+// `where ID < 6 and Name contains "Le" select Name,Email limit 3`.
+func ParseQuery(s string) (Query, error) {
+	var q Query
+	tokens, err := tokenize(s)
+	if err != nil {
+		return q, err
+	}
+
+	for i := 0; i < len(tokens); {
+		switch strings.ToLower(tokens[i]) {
+		case "where":
+			i++
+			for {
+				if i+2 >= len(tokens) {
+					return q, fmt.Errorf("incomplete condition in where clause")
+				}
+				q.Where = append(q.Where, Condition{Field: tokens[i], Op: strings.ToLower(tokens[i+1]), Value: literal(tokens[i+2])})
+				if err := q.Where[len(q.Where)-1].validate(); err != nil {
+					return q, err
+				}
+				i += 3
+				if i < len(tokens) && strings.EqualFold(tokens[i], "and") {
+					i++
+					continue
+				}
+				break
+			}
+		case "select":
+			i++
+			for i < len(tokens) {
+				if tokens[i] != "," && tokens[i] != "*" {
+					q.Select = append(q.Select, tokens[i])
+				}
+				if i+1 < len(tokens) && tokens[i+1] == "," {
+					i += 2
+					continue
+				}
+				i++
+				break
+			}
+		case "limit":
+			if i+1 >= len(tokens) {
+				return q, fmt.Errorf("limit requires a number")
+			}
+			n, err := strconv.Atoi(tokens[i+1])
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("invalid limit %q", tokens[i+1])
+			}
+			q.Limit = n
+			i += 2
+		default:
+			return q, fmt.Errorf("unexpected %q", tokens[i])
+		}
+	}
+	return q, nil
+}
+
+func tokenize(s string) ([]string, error) {
+	var tokens []string
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == ',':
+			tokens = append(tokens, ",")
+			i++
+		case r == '"' || r == '\'':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				j++
+			}
+			if j == len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			// keep the quotes so literal() can tell "5" apart from 5
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		case strings.ContainsRune("=!<>", r):
+			j := i + 1
+			for j < len(runes) && strings.ContainsRune("=!<>", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(",=!<>\"'", runes[j]) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func literal(tok string) interface{} {
+	if len(tok) >= 2 && (tok[0] == '"' || tok[0] == '\'') {
+		return tok[1 : len(tok)-1]
+	}
+	if f, err := strconv.ParseFloat(tok, 64); err == nil {
+		return f
+	}
+	if b, err := strconv.ParseBool(tok); err == nil {
+		return b
+	}
+	return tok
+}
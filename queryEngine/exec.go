@@ -0,0 +1,443 @@
+package queryEngine
+
+import (
+	"ZeroStore/helper"
+	"ZeroStore/storageEngine"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+type rowStream[K comparable, V any] <-chan storageEngine.Result[storageEngine.DataRow[K, V]]
+
+// stream runs the part of a plan that reads the builder's table. Rows flow
+// through the operators as they are read, and a limit cancels ctx once it
+// has its rows, which stops the scan or lookups below it.
+func (qb *QueryBuilder[K, V]) stream(ctx context.Context, n *PlanNode) rowStream[K, V] {
+	switch n.Op {
+	case OpScan:
+		return qb.dt.GetAllContext(ctx)
+	case OpKeyLookup:
+		keys, ok := n.keys.([]K)
+		if !ok {
+			keys = []K{n.keys.(K)}
+		}
+		return qb.lookup(ctx, keys, n.Conditions)
+	case OpIndexScan:
+		index, ok := qb.dt.(interface {
+			Lookup(name string, value any) storageEngine.Result[[]K]
+		})
+		if !ok {
+			return failed[K, V](fmt.Errorf("%w: %s", storageEngine.ErrIndexNotFound, n.Index))
+		}
+		res := index.Lookup(n.Index, n.value)
+		if res.Err != nil {
+			return failed[K, V](res.Err)
+		}
+		return qb.lookup(ctx, res.Value, n.Conditions)
+	case OpFilter:
+		return qb.filterRows(qb.stream(ctx, n.Inputs[0]), n)
+	case OpSort:
+		return sortRows(qb.stream(ctx, n.Inputs[0]), n.Fields[0], n.Desc)
+	case OpLimit:
+		ctx, cancel := context.WithCancel(ctx)
+		return limitRows(qb.stream(ctx, n.Inputs[0]), n.Limit, cancel)
+	case OpProject:
+		// the columns are picked as the rows leave the plan
+		return qb.stream(ctx, n.Inputs[0])
+	}
+	return failed[K, V](fmt.Errorf("cannot run %s over %s", n.Op, qb.tableName()))
+}
+
+func failed[K comparable, V any](err error) rowStream[K, V] {
+	out := make(chan storageEngine.Result[storageEngine.DataRow[K, V]], 1)
+	out <- storageEngine.Result[storageEngine.DataRow[K, V]]{Err: err}
+	close(out)
+	return out
+}
+
+// drain reads what is left of a stream so its goroutines can finish.
+func drain[T any](in <-chan storageEngine.Result[T]) {
+	for range in {
+	}
+}
+
+// lookup reads the rows of keys that exist and match conds.
+func (qb *QueryBuilder[K, V]) lookup(ctx context.Context, keys []K, conds []Condition) rowStream[K, V] {
+	match, err := Filter[K, V](conds)
+	if err != nil {
+		return failed[K, V](err)
+	}
+	out := make(chan storageEngine.Result[storageEngine.DataRow[K, V]])
+	go func() {
+		defer close(out)
+		for _, key := range keys {
+			if ctx.Err() != nil {
+				return
+			}
+			res := qb.dt.Search(key)
+			if errors.Is(res.Err, storageEngine.ErrKeyNotFound) {
+				continue
+			}
+			if res.Err != nil {
+				out <- res
+				return
+			}
+			if match(res.Value) {
+				out <- res
+			}
+		}
+	}()
+	return out
+}
+
+func (qb *QueryBuilder[K, V]) filterRows(in rowStream[K, V], n *PlanNode) rowStream[K, V] {
+	match, err := Filter[K, V](n.Conditions)
+	if err != nil {
+		go drain(in)
+		return failed[K, V](err)
+	}
+	pred, _ := n.pred.(func(storageEngine.DataRow[K, V]) bool)
+
+	out := make(chan storageEngine.Result[storageEngine.DataRow[K, V]])
+	go func() {
+		defer drain(in)
+		defer close(out)
+		for res := range in {
+			if res.Err != nil {
+				out <- res
+				return
+			}
+			if match(res.Value) && (pred == nil || pred(res.Value)) {
+				out <- res
+			}
+		}
+	}()
+	return out
+}
+
+func sortRows[K comparable, V any](in rowStream[K, V], field string, desc bool) rowStream[K, V] {
+	out := make(chan storageEngine.Result[storageEngine.DataRow[K, V]])
+	go func() {
+		defer drain(in)
+		defer close(out)
+		var rows []storageEngine.DataRow[K, V]
+		var values []any
+		for res := range in {
+			if res.Err != nil {
+				out <- res
+				return
+			}
+			rows = append(rows, res.Value)
+			if field == KeyField {
+				values = append(values, res.Value.PrimaryKey)
+			} else {
+				values = append(values, reflect.ValueOf(res.Value.Data).FieldByName(field).Interface())
+			}
+		}
+
+		order := make([]int, len(rows))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return less(values[order[i]], values[order[j]], desc)
+		})
+		for _, i := range order {
+			out <- storageEngine.Result[storageEngine.DataRow[K, V]]{Value: rows[i]}
+		}
+	}()
+	return out
+}
+
+// limitRows passes on the first limit rows, then cancels the stages below
+// and drains the little they still send.
+func limitRows[K comparable, V any](in rowStream[K, V], limit int, cancel context.CancelFunc) rowStream[K, V] {
+	out := make(chan storageEngine.Result[storageEngine.DataRow[K, V]])
+	go func() {
+		defer drain(in)
+		defer cancel()
+		defer close(out)
+		sent := 0
+		for res := range in {
+			out <- res
+			if sent++; res.Err != nil || sent == limit {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// less orders values for sorting, nil before anything else.
+func less(a, b any, desc bool) bool {
+	if a == nil || b == nil {
+		if desc {
+			return a != nil && b == nil
+		}
+		return a == nil && b != nil
+	}
+	cmp, err := helper.CompareValues(a, b)
+	if err != nil {
+		return false
+	}
+	if desc {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+func (qb *QueryBuilder[K, V]) records(n *PlanNode, prefix string) <-chan storageEngine.Result[Record] {
+	in := qb.stream(context.Background(), n)
+	out := make(chan storageEngine.Result[Record])
+	go func() {
+		defer drain(in)
+		defer close(out)
+		for res := range in {
+			if res.Err != nil {
+				out <- storageEngine.Result[Record]{Err: res.Err}
+				return
+			}
+			out <- storageEngine.Result[Record]{Value: record(res.Value, prefix)}
+		}
+	}()
+	return out
+}
+
+// record turns a row into a record holding its key and exported fields.
+func record[K comparable, V any](row storageEngine.DataRow[K, V], prefix string) Record {
+	column := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "." + name
+	}
+	rec := Record{column(KeyField): row.PrimaryKey}
+	data := reflect.ValueOf(row.Data)
+	if data.Kind() != reflect.Struct {
+		return rec
+	}
+	for i := 0; i < data.NumField(); i++ {
+		if f := data.Type().Field(i); f.IsExported() {
+			rec[column(f.Name)] = data.Field(i).Interface()
+		}
+	}
+	return rec
+}
+
+// run executes a plan, returning its rows as records. The parts of the plan
+// that read a table run there; joins, aggregates and whatever is above them
+// run here on records.
+func run(n *PlanNode, prefix string) ([]Record, error) {
+	if n.src != nil {
+		var recs []Record
+		for res := range n.src.records(n, prefix) {
+			if res.Err != nil {
+				return nil, res.Err
+			}
+			recs = append(recs, res.Value)
+		}
+		return recs, nil
+	}
+
+	if n.Op == OpJoin {
+		return hashJoin(n)
+	}
+	in, err := run(n.Inputs[0], prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Op {
+	case OpFilter:
+		var out []Record
+		for _, rec := range in {
+			if matchAll(n.Conditions, rec) {
+				out = append(out, rec)
+			}
+		}
+		return out, nil
+	case OpAggregate:
+		return aggregate(n, in)
+	case OpSort:
+		col := n.Fields[0]
+		sort.SliceStable(in, func(i, j int) bool {
+			return less(in[i][col], in[j][col], n.Desc)
+		})
+		return in, nil
+	case OpLimit:
+		return in[:min(n.Limit, len(in))], nil
+	case OpProject:
+		out := make([]Record, len(in))
+		for i, rec := range in {
+			out[i] = Record{}
+			for _, col := range n.Fields {
+				out[i][col] = rec[col]
+			}
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot run %s over records", n.Op)
+}
+
+func matchAll(conds []Condition, rec Record) bool {
+	for _, c := range conds {
+		if !c.Match(rec[c.Field]) {
+			return false
+		}
+	}
+	return true
+}
+
+// hashJoin loads the build input into a hash table by join column and
+// streams the other input past it.
+func hashJoin(n *PlanNode) ([]Record, error) {
+	var sides [2][]Record
+	for i, in := range n.Inputs {
+		recs, err := run(in, in.src.tableName())
+		if err != nil {
+			return nil, err
+		}
+		sides[i] = recs
+	}
+
+	build, probe := n.Build, 1-n.Build
+	hashed := map[any][]Record{}
+	for _, rec := range sides[build] {
+		if v := rec[n.Fields[build]]; v != nil {
+			k := hashKey(v)
+			hashed[k] = append(hashed[k], rec)
+		}
+	}
+
+	var out []Record
+	for _, rec := range sides[probe] {
+		v := rec[n.Fields[probe]]
+		if v == nil {
+			continue
+		}
+		for _, match := range hashed[hashKey(v)] {
+			joined := make(Record, len(rec)+len(match))
+			for col, value := range rec {
+				joined[col] = value
+			}
+			for col, value := range match {
+				joined[col] = value
+			}
+			out = append(out, joined)
+		}
+	}
+	return out, nil
+}
+
+// hashKey makes values that compare equal hash alike: numbers of any type
+// become float64, and values that cannot be map keys their text.
+func hashKey(v any) any {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	if !rv.Type().Comparable() {
+		return fmt.Sprintf("%T:%v", v, v)
+	}
+	return v
+}
+
+type aggState struct {
+	count    int
+	sum      float64
+	min, max any
+}
+
+func aggregate(n *PlanNode, in []Record) ([]Record, error) {
+	type group struct {
+		rec    Record
+		states []aggState
+	}
+	var groups []*group
+	byKey := map[string]*group{}
+	floatType := reflect.TypeOf(float64(0))
+
+	for _, rec := range in {
+		key := make([]any, len(n.Fields))
+		for i, col := range n.Fields {
+			key[i] = hashKey(rec[col])
+		}
+		id := fmt.Sprintf("%#v", key)
+		g, ok := byKey[id]
+		if !ok {
+			g = &group{rec: Record{}, states: make([]aggState, len(n.Aggregates))}
+			for _, col := range n.Fields {
+				g.rec[col] = rec[col]
+			}
+			byKey[id] = g
+			groups = append(groups, g)
+		}
+
+		for i, a := range n.Aggregates {
+			s := &g.states[i]
+			if a.Field == "" {
+				s.count++
+				continue
+			}
+			v := rec[a.Field]
+			if v == nil {
+				continue
+			}
+			s.count++
+			switch a.Func {
+			case "sum", "avg":
+				f, err := helper.ConvertValue(v, floatType)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", a.column(), err)
+				}
+				s.sum += f.Float()
+			case "min":
+				if s.min == nil || less(v, s.min, false) {
+					s.min = v
+				}
+			case "max":
+				if s.max == nil || less(v, s.max, true) {
+					s.max = v
+				}
+			}
+		}
+	}
+
+	// with no grouping there is one result even for no rows
+	if len(groups) == 0 && len(n.Fields) == 0 {
+		groups = append(groups, &group{rec: Record{}, states: make([]aggState, len(n.Aggregates))})
+	}
+
+	out := make([]Record, len(groups))
+	for i, g := range groups {
+		for j, a := range n.Aggregates {
+			s := g.states[j]
+			var value any
+			switch a.Func {
+			case "count":
+				value = s.count
+			case "sum":
+				value = s.sum
+			case "avg":
+				if s.count > 0 {
+					value = s.sum / float64(s.count)
+				}
+			case "min":
+				value = s.min
+			case "max":
+				value = s.max
+			}
+			g.rec[a.column()] = value
+		}
+		out[i] = g.rec
+	}
+	return out, nil
+}
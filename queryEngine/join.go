@@ -0,0 +1,151 @@
+package queryEngine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A JoinQuery pairs the rows of two tables whose join fields hold equal
+// values. The conditions, order and limit of each builder apply to its rows
+// before the join; those of the JoinQuery apply to the joined records, whose
+// columns are named table.Field after the names given to As.
+type JoinQuery struct {
+	sides [2]planSource
+	on    [2]string
+	conds []Condition
+	tail  tail
+}
+
+// Join joins the rows of left and right where leftField equals rightField.
+// Numbers of any type compare equal by value.
+func Join[K1 comparable, V1 any, K2 comparable, V2 any](left *QueryBuilder[K1, V1], right *QueryBuilder[K2, V2], leftField, rightField string) *JoinQuery {
+	return &JoinQuery{sides: [2]planSource{left, right}, on: [2]string{leftField, rightField}}
+}
+
+// Where adds conditions on the joined records. A field may be left
+// unqualified when only one table has it. Conditions on one table are
+// checked before the join.
+func (jq *JoinQuery) Where(conds ...Condition) *JoinQuery {
+	jq.conds = append(jq.conds, conds...)
+	return jq
+}
+
+func (jq *JoinQuery) OrderBy(field string, desc bool) *JoinQuery {
+	jq.tail.orderBy, jq.tail.desc = field, desc
+	return jq
+}
+
+func (jq *JoinQuery) Limit(n int) *JoinQuery {
+	jq.tail.limit = n
+	return jq
+}
+
+func (jq *JoinQuery) Project(fields ...string) *JoinQuery {
+	jq.tail.project = fields
+	return jq
+}
+
+func (jq *JoinQuery) GroupBy(fields ...string) *JoinQuery {
+	jq.tail.groupBy = fields
+	return jq
+}
+
+func (jq *JoinQuery) Aggregate(aggs ...Aggregation) *JoinQuery {
+	jq.tail.aggs = append(jq.tail.aggs, aggs...)
+	return jq
+}
+
+// Plan returns the optimized plan Run executes.
+func (jq *JoinQuery) Plan() Result[*PlanNode] {
+	n, err := jq.logical()
+	if err != nil {
+		return Result[*PlanNode]{Err: err}
+	}
+	return Result[*PlanNode]{Value: optimize(n)}
+}
+
+func (jq *JoinQuery) Explain() Result[string] {
+	plan := jq.Plan()
+	if plan.Err != nil {
+		return Result[string]{Err: plan.Err}
+	}
+	return Result[string]{Value: plan.Value.String()}
+}
+
+func (jq *JoinQuery) Run() Result[[]Record] {
+	plan := jq.Plan()
+	if plan.Err != nil {
+		return Result[[]Record]{Err: plan.Err}
+	}
+	return NewResult(run(plan.Value, ""))
+}
+
+func (jq *JoinQuery) logical() (*PlanNode, error) {
+	left, right := jq.sides[0].tableName(), jq.sides[1].tableName()
+	if left == right {
+		return nil, fmt.Errorf("both tables of the join are named %s; name them with As", left)
+	}
+
+	join := &PlanNode{Op: OpJoin}
+	for i, side := range jq.sides {
+		if !side.hasField(jq.on[i]) {
+			return nil, fmt.Errorf("field %s not found in %s", jq.on[i], side.tableName())
+		}
+		n, err := side.logical()
+		if err != nil {
+			return nil, err
+		}
+		if n.src == nil || n.Op == OpProject {
+			return nil, fmt.Errorf("%s cannot be grouped or projected before the join", side.tableName())
+		}
+		join.Inputs = append(join.Inputs, n)
+		join.Fields = append(join.Fields, side.tableName()+"."+jq.on[i])
+	}
+
+	var n *PlanNode = join
+	if len(jq.conds) > 0 {
+		conds := make([]Condition, len(jq.conds))
+		for i, c := range jq.conds {
+			if err := c.validate(); err != nil {
+				return nil, err
+			}
+			col, err := jq.resolve(c.Field)
+			if err != nil {
+				return nil, err
+			}
+			conds[i] = Condition{Field: col, Op: c.Op, Value: c.Value}
+		}
+		n = &PlanNode{Op: OpFilter, Conditions: conds, Inputs: []*PlanNode{join}}
+	}
+	return jq.tail.plan(n, jq.resolve)
+}
+
+// resolve qualifies field with the table it belongs to.
+func (jq *JoinQuery) resolve(field string) (string, error) {
+	if table, name, ok := strings.Cut(field, "."); ok {
+		for _, side := range jq.sides {
+			if side.tableName() != table {
+				continue
+			}
+			if !side.hasField(name) {
+				return "", fmt.Errorf("field %s not found in %s", name, table)
+			}
+			return field, nil
+		}
+		return "", fmt.Errorf("table %s is not in the join", table)
+	}
+
+	var found []string
+	for _, side := range jq.sides {
+		if side.hasField(field) {
+			found = append(found, side.tableName()+"."+field)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("field %s not found in the joined tables", field)
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("field %s is ambiguous: %s", field, strings.Join(found, " or "))
+}
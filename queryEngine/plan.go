@@ -0,0 +1,702 @@
+package queryEngine
+
+import (
+	"ZeroStore/helper"
+	"ZeroStore/storageEngine"
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// PlanOp names the operator of a plan node.
+type PlanOp string
+
+const (
+	OpScan      PlanOp = "Scan"
+	OpIndexScan PlanOp = "IndexScan"
+	OpKeyLookup PlanOp = "KeyLookup"
+	OpFilter    PlanOp = "Filter"
+	OpProject   PlanOp = "Project"
+	OpSort      PlanOp = "Sort"
+	OpLimit     PlanOp = "Limit"
+	OpJoin      PlanOp = "Join"
+	OpAggregate PlanOp = "Aggregate"
+)
+
+// A PlanNode is one operator of a query plan, reading the rows of its
+// Inputs. Rows is the planner's estimate of how many rows it yields.
+type PlanNode struct {
+	Op    PlanOp
+	Table string
+	// Index is the secondary index an IndexScan reads
+	Index string
+	// Keys is the number of keys a KeyLookup reads
+	Keys int
+	// Conditions are checked by a Filter, or by the IndexScan or KeyLookup
+	// that was chosen for them
+	Conditions []Condition
+	// Func marks a Filter that also runs a Where function
+	Func bool
+	// Fields are the columns of a Project, the sort column, the grouping
+	// columns of an Aggregate or the two columns a Join matches
+	Fields     []string
+	Desc       bool
+	Limit      int
+	Aggregates []Aggregation
+	// Build is the input a Join hashes, the smaller one
+	Build  int
+	Rows   int
+	Inputs []*PlanNode
+
+	// src is the builder reading the rows of the node; nodes above a join
+	// or aggregate work on records and have none
+	src planSource
+	// keys holds the []K of a KeyLookup, value the index value of an
+	// IndexScan and pred the Where function of a Filter
+	keys  any
+	value any
+	pred  any
+}
+
+// An Aggregation computes Func, one of count, sum, avg, min and max, over
+// Field for each group. A count without a Field counts rows.
+type Aggregation struct {
+	Func  string `json:"func"`
+	Field string `json:"field,omitempty"`
+}
+
+func (a Aggregation) column() string {
+	if a.Field == "" {
+		return a.Func
+	}
+	return a.Func + "(" + a.Field + ")"
+}
+
+// A Record is a row of a join, aggregate or projection, its values by
+// column. The columns of a join are qualified by table, e.g. "users.Name".
+type Record map[string]interface{}
+
+// planSource is implemented by every QueryBuilder, so that plans over
+// tables of different types can be built and run together.
+type planSource interface {
+	tableName() string
+	hasField(field string) bool
+	logical() (*PlanNode, error)
+	rowCount() int
+	indexStats() map[string]storageEngine.IndexStats
+	// keyValue and indexValue convert a condition value to the key type
+	// or the type of field, reporting false if it does not convert
+	keyValue(value any) (any, bool)
+	indexValue(field string, value any) (any, bool)
+	records(n *PlanNode, prefix string) <-chan storageEngine.Result[Record]
+}
+
+// tail holds the operators applied once the rows are read or joined.
+type tail struct {
+	orderBy string
+	desc    bool
+	limit   int
+	project []string
+	groupBy []string
+	aggs    []Aggregation
+}
+
+func (t tail) grouped() bool {
+	return len(t.groupBy) > 0 || len(t.aggs) > 0
+}
+
+var aggregateFuncs = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+// plan stacks Aggregate, Sort, Limit and Project on n. resolve maps a field
+// to its column, failing for fields that do not exist.
+func (t tail) plan(n *PlanNode, resolve func(field string) (string, error)) (*PlanNode, error) {
+	if t.grouped() {
+		agg := &PlanNode{Op: OpAggregate, Inputs: []*PlanNode{n}}
+		columns := map[string]bool{}
+		for _, field := range t.groupBy {
+			col, err := resolve(field)
+			if err != nil {
+				return nil, err
+			}
+			agg.Fields = append(agg.Fields, col)
+			columns[col] = true
+		}
+		for _, a := range t.aggs {
+			a.Func = strings.ToLower(a.Func)
+			if !aggregateFuncs[a.Func] {
+				return nil, fmt.Errorf("unknown aggregate %q", a.Func)
+			}
+			if a.Field != "" {
+				col, err := resolve(a.Field)
+				if err != nil {
+					return nil, err
+				}
+				a.Field = col
+			} else if a.Func != "count" {
+				return nil, fmt.Errorf("%s needs a field", a.Func)
+			}
+			agg.Aggregates = append(agg.Aggregates, a)
+			columns[a.column()] = true
+		}
+		n = agg
+
+		// the rows are groups from here on
+		base := resolve
+		resolve = func(field string) (string, error) {
+			if columns[field] {
+				return field, nil
+			}
+			if col, err := base(field); err == nil && columns[col] {
+				return col, nil
+			}
+			return "", fmt.Errorf("column %s is not grouped or aggregated", field)
+		}
+	}
+
+	if t.orderBy != "" {
+		col, err := resolve(t.orderBy)
+		if err != nil {
+			return nil, err
+		}
+		n = &PlanNode{Op: OpSort, Fields: []string{col}, Desc: t.desc, Inputs: []*PlanNode{n}, src: n.src}
+	}
+	if t.limit > 0 {
+		n = &PlanNode{Op: OpLimit, Limit: t.limit, Inputs: []*PlanNode{n}, src: n.src}
+	}
+	if len(t.project) > 0 {
+		p := &PlanNode{Op: OpProject, Inputs: []*PlanNode{n}}
+		for _, field := range t.project {
+			col, err := resolve(field)
+			if err != nil {
+				return nil, err
+			}
+			p.Fields = append(p.Fields, col)
+		}
+		n = p
+	}
+	return n, nil
+}
+
+// logical builds the plan the builder describes, before optimization: the
+// rows are read, filtered, then aggregated, sorted, limited and projected.
+// Only naming a field needs V to be a struct; func filters, limits and _key
+// work on any row.
+func (qb *QueryBuilder[K, V]) logical() (*PlanNode, error) {
+	var v V
+	isStruct := reflect.TypeOf(v) != nil && reflect.TypeOf(v).Kind() == reflect.Struct
+	resolve := func(field string) (string, error) {
+		if field != KeyField && !isStruct {
+			return "", fmt.Errorf("provided Data type is not a struct")
+		}
+		if !qb.hasField(field) {
+			return "", fmt.Errorf("field %s not found in struct", field)
+		}
+		return field, nil
+	}
+
+	n := &PlanNode{Op: OpScan, Table: qb.tableName(), src: qb}
+	if qb.keys != nil {
+		n = &PlanNode{Op: OpKeyLookup, Table: qb.tableName(), Keys: len(qb.keys), keys: qb.keys, src: qb}
+	}
+	if len(qb.conds) > 0 || qb.filter != nil {
+		for _, c := range qb.conds {
+			if err := c.validate(); err != nil {
+				return nil, err
+			}
+			if _, err := resolve(c.Field); err != nil {
+				return nil, err
+			}
+		}
+		n = &PlanNode{Op: OpFilter, Conditions: qb.conds, Func: qb.filter != nil, Inputs: []*PlanNode{n}, src: qb}
+		if qb.filter != nil {
+			n.pred = qb.filter
+		}
+	}
+
+	t := qb.tail
+	if qb.resultType != nil && len(t.project) == 0 {
+		rt := reflect.TypeOf(qb.resultType)
+		if rt.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("resultType must be a struct type")
+		}
+		for i := 0; i < rt.NumField(); i++ {
+			t.project = append(t.project, rt.Field(i).Name)
+		}
+	}
+	return t.plan(n, resolve)
+}
+
+// Plan returns the optimized plan Execute runs for the builder.
+func (qb *QueryBuilder[K, V]) Plan() Result[*PlanNode] {
+	n, err := qb.logical()
+	if err != nil {
+		return Result[*PlanNode]{Err: err}
+	}
+	return Result[*PlanNode]{Value: optimize(n)}
+}
+
+// Explain describes the plan Execute runs for the builder, one operator per
+// line with the number of rows it is expected to yield.
+func (qb *QueryBuilder[K, V]) Explain() Result[string] {
+	plan := qb.Plan()
+	if plan.Err != nil {
+		return Result[string]{Err: plan.Err}
+	}
+	return Result[string]{Value: plan.Value.String()}
+}
+
+// Stream runs the plan, sending the rows as they are found. Queries that
+// group rows are run by Execute with a []Record result instead.
+func (qb *QueryBuilder[K, V]) Stream() Result[<-chan storageEngine.Result[storageEngine.DataRow[K, V]]] {
+	return qb.StreamContext(context.Background())
+}
+
+// StreamContext is Stream that stops reading the table once ctx is done.
+// The channel must still be read to the end, which then comes quickly.
+func (qb *QueryBuilder[K, V]) StreamContext(ctx context.Context) Result[<-chan storageEngine.Result[storageEngine.DataRow[K, V]]] {
+	plan := qb.Plan()
+	if plan.Err != nil {
+		return Result[<-chan storageEngine.Result[storageEngine.DataRow[K, V]]]{Err: plan.Err}
+	}
+	n := plan.Value
+	if n.Op == OpProject {
+		n = n.Inputs[0]
+	}
+	if n.src == nil {
+		return Result[<-chan storageEngine.Result[storageEngine.DataRow[K, V]]]{Err: fmt.Errorf("grouped rows are returned as []Record")}
+	}
+	return Result[<-chan storageEngine.Result[storageEngine.DataRow[K, V]]]{Value: qb.stream(ctx, n)}
+}
+
+// planned reports whether Execute runs the builder through the planner. A
+// lone func filter is answered by the table's Where, as before there was a
+// planner.
+func (qb *QueryBuilder[K, V]) planned() bool {
+	if qb.filterOnly() {
+		return false
+	}
+	return qb.filter != nil || len(qb.conds) > 0 || qb.tail.orderBy != "" || qb.tail.limit > 0 || qb.tail.grouped()
+}
+
+func (qb *QueryBuilder[K, V]) filterOnly() bool {
+	return qb.filter != nil && qb.keys == nil && len(qb.conds) == 0 && qb.tail.orderBy == "" && qb.tail.limit == 0 && !qb.tail.grouped()
+}
+
+func (qb *QueryBuilder[K, V]) planRows() ([]storageEngine.DataRow[K, V], error) {
+	res := qb.Stream()
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	var rows []storageEngine.DataRow[K, V]
+	for row := range res.Value {
+		if row.Err != nil {
+			go drain(res.Value)
+			return nil, row.Err
+		}
+		rows = append(rows, row.Value)
+	}
+	return rows, nil
+}
+
+func (qb *QueryBuilder[K, V]) tableName() string {
+	if qb.name == "" {
+		return "table"
+	}
+	return qb.name
+}
+
+func (qb *QueryBuilder[K, V]) hasField(field string) bool {
+	if field == KeyField {
+		return true
+	}
+	var v V
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Struct {
+		return false
+	}
+	f, ok := t.FieldByName(field)
+	return ok && f.IsExported()
+}
+
+// rowCount and indexStats use the statistics a table keeps, if any.
+func (qb *QueryBuilder[K, V]) rowCount() int {
+	if t, ok := qb.dt.(interface{ Len() int }); ok {
+		return t.Len()
+	}
+	return 0
+}
+
+func (qb *QueryBuilder[K, V]) indexStats() map[string]storageEngine.IndexStats {
+	if t, ok := qb.dt.(interface {
+		IndexStats() map[string]storageEngine.IndexStats
+	}); ok {
+		return t.IndexStats()
+	}
+	return nil
+}
+
+func (qb *QueryBuilder[K, V]) keyValue(value any) (any, bool) {
+	v, err := helper.ConvertValue(value, reflect.TypeOf((*K)(nil)).Elem())
+	if err != nil {
+		return nil, false
+	}
+	return v.Interface(), true
+}
+
+func (qb *QueryBuilder[K, V]) indexValue(field string, value any) (any, bool) {
+	var v V
+	f, ok := reflect.TypeOf(v).FieldByName(field)
+	if !ok {
+		return nil, false
+	}
+	cv, err := helper.ConvertValue(value, f.Type)
+	if err != nil || !cv.Type().Comparable() {
+		return nil, false
+	}
+	return cv.Convert(f.Type).Interface(), true
+}
+
+// optimize rewrites a logical plan with the planner's rules, in order:
+// predicates are pushed below sorts and joins, filters over a scan are
+// turned into key lookups or index scans where a condition allows, sorts
+// the scan order already satisfies are dropped, and the smaller input of a
+// join is picked to be hashed.
+func optimize(n *PlanNode) *PlanNode {
+	n = pushDown(n)
+	n = accessPath(n)
+	n = dropSorts(n)
+	estimate(n)
+	return n
+}
+
+func pushDown(n *PlanNode) *PlanNode {
+	for i, in := range n.Inputs {
+		n.Inputs[i] = pushDown(in)
+	}
+	if n.Op != OpFilter || n.Func {
+		return n
+	}
+
+	in := n.Inputs[0]
+	switch in.Op {
+	case OpSort:
+		// filtering first leaves fewer rows to sort
+		n.Inputs[0] = in.Inputs[0]
+		in.Inputs[0] = pushDown(n)
+		return in
+	case OpJoin:
+		var kept []Condition
+		for _, c := range n.Conditions {
+			side, field, ok := joinSide(in, c.Field)
+			if !ok {
+				kept = append(kept, c)
+				continue
+			}
+			pushed, ok := pushInto(in.Inputs[side], Condition{Field: field, Op: c.Op, Value: c.Value})
+			if !ok {
+				kept = append(kept, c)
+				continue
+			}
+			in.Inputs[side] = pushed
+		}
+		if len(kept) == 0 {
+			return in
+		}
+		n.Conditions = kept
+	}
+	return n
+}
+
+// joinSide finds the input of join that a qualified column belongs to.
+func joinSide(join *PlanNode, col string) (int, string, bool) {
+	table, field, ok := strings.Cut(col, ".")
+	if !ok {
+		return 0, "", false
+	}
+	for i, in := range join.Inputs {
+		if in.src != nil && in.src.tableName() == table {
+			return i, field, true
+		}
+	}
+	return 0, "", false
+}
+
+// pushInto adds c to the filter just above the rows read by n. It fails
+// when a limit is in the way, since filtering before it changes the result.
+func pushInto(n *PlanNode, c Condition) (*PlanNode, bool) {
+	switch n.Op {
+	case OpFilter:
+		n.Conditions = append(n.Conditions[:len(n.Conditions):len(n.Conditions)], c)
+		return n, true
+	case OpScan, OpKeyLookup:
+		return &PlanNode{Op: OpFilter, Conditions: []Condition{c}, Inputs: []*PlanNode{n}, src: n.src}, true
+	case OpSort:
+		in, ok := pushInto(n.Inputs[0], c)
+		n.Inputs[0] = in
+		return n, ok
+	}
+	return n, false
+}
+
+func accessPath(n *PlanNode) *PlanNode {
+	for i, in := range n.Inputs {
+		n.Inputs[i] = accessPath(in)
+	}
+	if n.Op != OpFilter || n.src == nil || n.Inputs[0].Op != OpScan {
+		return n
+	}
+
+	src := n.src
+	conds := n.Conditions
+	var access *PlanNode
+	chosen := -1
+
+	// a key equality beats any index
+	for i, c := range conds {
+		if c.Field != KeyField || !isEquality(c.Op) {
+			continue
+		}
+		if key, ok := src.keyValue(c.Value); ok {
+			access = &PlanNode{Op: OpKeyLookup, Table: src.tableName(), Keys: 1, keys: key, src: src}
+			chosen = i
+			break
+		}
+	}
+
+	// otherwise the most selective index on a field compared for equality;
+	// indexes declared in a schema are named after their field
+	if access == nil {
+		stats := src.indexStats()
+		best := math.MaxFloat64
+		for i, c := range conds {
+			s, ok := stats[c.Field]
+			if !ok || c.Field == KeyField || !isEquality(c.Op) {
+				continue
+			}
+			value, ok := src.indexValue(c.Field, c.Value)
+			if !ok {
+				continue
+			}
+			if rows := float64(s.Rows) / float64(max(s.Values, 1)); rows < best {
+				best = rows
+				access = &PlanNode{Op: OpIndexScan, Table: src.tableName(), Index: c.Field, value: value, src: src}
+				chosen = i
+			}
+		}
+	}
+
+	if access == nil {
+		return n
+	}
+	access.Conditions = []Condition{conds[chosen]}
+	rest := append(append([]Condition{}, conds[:chosen]...), conds[chosen+1:]...)
+	if len(rest) == 0 && !n.Func {
+		return access
+	}
+	n.Conditions = rest
+	n.Inputs[0] = access
+	return n
+}
+
+func isEquality(op string) bool {
+	return op == "=" || op == "=="
+}
+
+// dropSorts removes sorts by ascending key over a scan, whose rows already
+// come in key order.
+func dropSorts(n *PlanNode) *PlanNode {
+	for i, in := range n.Inputs {
+		n.Inputs[i] = dropSorts(in)
+	}
+	if n.Op != OpSort || n.src == nil || n.Desc || n.Fields[0] != KeyField {
+		return n
+	}
+	in := n.Inputs[0]
+	for in.Op == OpFilter {
+		in = in.Inputs[0]
+	}
+	if in.Op == OpScan || in.Op == OpIndexScan {
+		return n.Inputs[0]
+	}
+	return n
+}
+
+// Selectivities assumed for conditions on fields without statistics.
+const (
+	equalSelectivity    = 0.1
+	rangeSelectivity    = 1.0 / 3
+	containsSelectivity = 0.25
+	funcSelectivity     = 0.5
+	groupSelectivity    = 0.1
+)
+
+func estimate(n *PlanNode) int {
+	for _, in := range n.Inputs {
+		estimate(in)
+	}
+	var input int
+	if len(n.Inputs) > 0 {
+		input = n.Inputs[0].Rows
+	}
+
+	switch n.Op {
+	case OpScan:
+		n.Rows = n.src.rowCount()
+	case OpKeyLookup:
+		n.Rows = min(n.Keys, n.src.rowCount())
+	case OpIndexScan:
+		s := n.src.indexStats()[n.Index]
+		n.Rows = int(math.Ceil(float64(s.Rows) / float64(max(s.Values, 1))))
+	case OpFilter:
+		var stats map[string]storageEngine.IndexStats
+		if n.src != nil {
+			stats = n.src.indexStats()
+		}
+		rows := float64(input)
+		for _, c := range n.Conditions {
+			rows *= selectivity(c, stats)
+		}
+		if n.Func {
+			rows *= funcSelectivity
+		}
+		n.Rows = int(math.Ceil(rows))
+	case OpLimit:
+		n.Rows = min(n.Limit, input)
+	case OpAggregate:
+		n.Rows = min(input, 1)
+		if len(n.Fields) > 0 {
+			n.Rows = int(math.Ceil(float64(input) * groupSelectivity))
+			if groups, ok := groupCount(n); ok {
+				n.Rows = min(groups, input)
+			}
+		}
+	case OpJoin:
+		// rows match on values common to both sides: |L|·|R| / max(V(L), V(R))
+		l, r := n.Inputs[0], n.Inputs[1]
+		distinct := max(joinDistinct(l, n.Fields[0]), joinDistinct(r, n.Fields[1]), 1)
+		n.Rows = int(math.Ceil(float64(l.Rows) * float64(r.Rows) / float64(distinct)))
+		n.Build = 1
+		if l.Rows < r.Rows {
+			n.Build = 0
+		}
+	default:
+		n.Rows = input
+	}
+	return n.Rows
+}
+
+// groupCount is the number of groups when every grouping field is indexed.
+func groupCount(n *PlanNode) (int, bool) {
+	src := n.Inputs[0].src
+	if src == nil {
+		return 0, false
+	}
+	stats := src.indexStats()
+	groups := 1
+	for _, field := range n.Fields {
+		s, ok := stats[field]
+		if !ok {
+			return 0, false
+		}
+		groups *= max(s.Values, 1)
+	}
+	return groups, true
+}
+
+func selectivity(c Condition, stats map[string]storageEngine.IndexStats) float64 {
+	switch {
+	case isEquality(c.Op):
+		if s, ok := stats[c.Field]; ok && s.Values > 0 {
+			return 1 / float64(s.Values)
+		}
+		return equalSelectivity
+	case c.Op == "!=":
+		return 1 - equalSelectivity
+	case strings.EqualFold(c.Op, "contains"):
+		return containsSelectivity
+	}
+	return rangeSelectivity
+}
+
+// joinDistinct estimates the number of distinct values of col among the
+// rows of n: all of them for the key, the index size for an indexed field.
+func joinDistinct(n *PlanNode, col string) int {
+	_, field, _ := strings.Cut(col, ".")
+	if n.src != nil {
+		if field == KeyField {
+			return n.Rows
+		}
+		if s, ok := n.src.indexStats()[field]; ok {
+			return min(s.Values, n.Rows)
+		}
+	}
+	return n.Rows
+}
+
+// String renders the plan as an indented tree, one node per line.
+func (n *PlanNode) String() string {
+	var sb strings.Builder
+	n.explain(&sb, 0)
+	return sb.String()
+}
+
+func (n *PlanNode) explain(sb *strings.Builder, depth int) {
+	sb.WriteString(strings.Repeat("  ", depth))
+	sb.WriteString(string(n.Op))
+	switch n.Op {
+	case OpScan:
+		fmt.Fprintf(sb, " %s", n.Table)
+	case OpKeyLookup:
+		fmt.Fprintf(sb, " %s", n.Table)
+		if len(n.Conditions) > 0 {
+			fmt.Fprintf(sb, " where %s", conditions(n.Conditions, false))
+		} else {
+			fmt.Fprintf(sb, " %d keys", n.Keys)
+		}
+	case OpIndexScan:
+		fmt.Fprintf(sb, " %s using %s where %s", n.Table, n.Index, conditions(n.Conditions, false))
+	case OpFilter:
+		fmt.Fprintf(sb, " %s", conditions(n.Conditions, n.Func))
+	case OpProject:
+		fmt.Fprintf(sb, " %s", strings.Join(n.Fields, ", "))
+	case OpSort:
+		fmt.Fprintf(sb, " %s", n.Fields[0])
+		if n.Desc {
+			sb.WriteString(" desc")
+		}
+	case OpLimit:
+		fmt.Fprintf(sb, " %d", n.Limit)
+	case OpJoin:
+		fmt.Fprintf(sb, " %s = %s (hash %s)", n.Fields[0], n.Fields[1], n.Inputs[n.Build].src.tableName())
+	case OpAggregate:
+		columns := make([]string, len(n.Aggregates))
+		for i, a := range n.Aggregates {
+			columns[i] = a.column()
+		}
+		sb.WriteString(" " + strings.Join(columns, ", "))
+		if len(n.Fields) > 0 {
+			fmt.Fprintf(sb, " by %s", strings.Join(n.Fields, ", "))
+		}
+	}
+	fmt.Fprintf(sb, " (rows=%d)\n", n.Rows)
+	for _, in := range n.Inputs {
+		in.explain(sb, depth+1)
+	}
+}
+
+func conditions(conds []Condition, fn bool) string {
+	parts := make([]string, 0, len(conds)+1)
+	for _, c := range conds {
+		value := fmt.Sprint(c.Value)
+		if s, ok := c.Value.(string); ok {
+			value = fmt.Sprintf("%q", s)
+		}
+		parts = append(parts, fmt.Sprintf("%s %s %s", c.Field, c.Op, value))
+	}
+	if fn {
+		parts = append(parts, "<func>")
+	}
+	return strings.Join(parts, " and ")
+}
@@ -0,0 +1,155 @@
+package queryEngine
+
+import (
+	"ZeroStore/storageEngine"
+	"cmp"
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type planRow struct {
+	Name string
+	Role string `zerostore:"index"`
+	Age  int
+}
+
+// countingTable counts the rows its scans read and reports when the last
+// scan has finished.
+type countingTable struct {
+	*storageEngine.DataTable[int, planRow]
+	read     atomic.Int64
+	finished chan struct{}
+}
+
+func (ct *countingTable) GetAllContext(ctx context.Context) <-chan storageEngine.Result[storageEngine.DataRow[int, planRow]] {
+	in := ct.DataTable.GetAllContext(ctx)
+	out := make(chan storageEngine.Result[storageEngine.DataRow[int, planRow]])
+	go func() {
+		defer close(ct.finished)
+		defer close(out)
+		for res := range in {
+			ct.read.Add(1)
+			select {
+			case out <- res:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+func newPlanTable(t *testing.T, rows int) *storageEngine.DataTable[int, planRow] {
+	t.Helper()
+	dt, err := storageEngine.NewDataTable[int, planRow](cmp.Compare[int], filepath.Join(t.TempDir(), "plan"), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dt.Close() })
+	roles := []string{"dev", "ops", "qa", "pm"}
+	for i := 1; i <= rows; i++ {
+		if res := dt.Insert(i, planRow{Name: "row", Role: roles[i%len(roles)], Age: i % 50}); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	return dt
+}
+
+func TestLimitStopsScan(t *testing.T) {
+	const rows = 5000
+	ct := &countingTable{DataTable: newPlanTable(t, rows), finished: make(chan struct{})}
+
+	qb := NewQueryBuilder[int, planRow](ct).WhereConditions(Condition{Field: "Age", Op: ">", Value: 10}).Limit(5)
+	keys := Execute[int, planRow, []int](qb)
+	if keys.Err != nil {
+		t.Fatal(keys.Err)
+	}
+	if len(keys.Value) != 5 {
+		t.Fatalf("got %d keys, want 5", len(keys.Value))
+	}
+
+	select {
+	case <-ct.finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scan still running after the limit was reached")
+	}
+	if n := ct.read.Load(); n >= rows {
+		t.Fatalf("scan read %d of %d rows for a limit of 5", n, rows)
+	}
+	// the scan's snapshot is gone, so nothing blocks a compaction
+	if res := ct.Compact(); res.Err != nil {
+		t.Fatalf("Compact after a limited query: %v", res.Err)
+	}
+}
+
+func TestExplainPicksIndexScan(t *testing.T) {
+	dt := newPlanTable(t, 400)
+
+	qb := NewQueryBuilder[int, planRow](dt).As("people").
+		WhereConditions(Condition{Field: "Age", Op: "<", Value: 5}, Condition{Field: "Role", Op: "=", Value: "qa"})
+	plan := qb.Explain()
+	if plan.Err != nil {
+		t.Fatal(plan.Err)
+	}
+	explained := "Filter Age < 5 (rows=34)\n  IndexScan people using Role where Role = \"qa\" (rows=100)\n"
+	if plan.Value != explained {
+		t.Fatalf("plan:\n%s\nwant:\n%s", plan.Value, explained)
+	}
+
+	rows := Execute[int, planRow, []storageEngine.DataRow[int, planRow]](qb)
+	if rows.Err != nil {
+		t.Fatal(rows.Err)
+	}
+	for _, row := range rows.Value {
+		if row.Data.Role != "qa" || row.Data.Age >= 5 {
+			t.Fatalf("row %+v does not match", row)
+		}
+	}
+	want := 0
+	for i := 1; i <= 400; i++ {
+		if i%4 == 2 && i%50 < 5 {
+			want++
+		}
+	}
+	if len(rows.Value) != want {
+		t.Fatalf("got %d rows, want %d", len(rows.Value), want)
+	}
+}
+
+func TestFuncFilterOnNonStructTable(t *testing.T) {
+	dt, err := storageEngine.NewDataTable[string, []byte](strings.Compare, filepath.Join(t.TempDir(), "kv"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dt.Close()
+	for _, key := range []string{"a", "bb", "c", "dd", "eee"} {
+		if res := dt.Insert(key, []byte(key)); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	long := func(row storageEngine.DataRow[string, []byte]) bool { return len(row.Data) > 1 }
+
+	keys := Execute[string, []byte, []string](NewQueryBuilder[string, []byte](dt).Where(long))
+	if keys.Err != nil || !reflect.DeepEqual(keys.Value, []string{"bb", "dd", "eee"}) {
+		t.Fatalf("func filter = %+v, want [bb dd eee]", keys)
+	}
+	rows := Execute[string, []byte, []storageEngine.DataRow[string, []byte]](NewQueryBuilder[string, []byte](dt).Where(long))
+	if rows.Err != nil || len(rows.Value) != 3 || string(rows.Value[2].Data) != "eee" {
+		t.Fatalf("func filter rows = %+v", rows)
+	}
+	limited := Execute[string, []byte, []string](NewQueryBuilder[string, []byte](dt).Where(long).Limit(2))
+	if limited.Err != nil || !reflect.DeepEqual(limited.Value, []string{"bb", "dd"}) {
+		t.Fatalf("func filter with limit = %+v, want [bb dd]", limited)
+	}
+	byKey := Execute[string, []byte, []string](NewQueryBuilder[string, []byte](dt).WhereConditions(Condition{Field: KeyField, Op: ">=", Value: "c"}))
+	if byKey.Err != nil || !reflect.DeepEqual(byKey.Value, []string{"c", "dd", "eee"}) {
+		t.Fatalf("_key condition = %+v, want [c dd eee]", byKey)
+	}
+	if res := Execute[string, []byte, []string](NewQueryBuilder[string, []byte](dt).WhereConditions(Condition{Field: "Name", Op: "=", Value: "x"})); res.Err == nil {
+		t.Fatal("a field condition on a non-struct table was accepted")
+	}
+}
@@ -15,16 +15,36 @@ func NewResult[T any](value T, err error) Result[T] {
 }
 
 type QueryBuilder[K comparable, V any] struct {
-	dt         *storageEngine.DataTable[K, V]
+	dt         storageEngine.Table[K, V]
+	name       string
+	conds      []Condition
+	tail       tail
 	keys       []K
 	filter     func(storageEngine.DataRow[K, V]) bool
 	resultType interface{}
 	updateFunc func(data V) V
 	updateData *V
 	toDelete   bool
+	version    *uint64
+	writes     []write[K, V]
 }
 
-func NewQueryBuilder[K comparable, V any](dt *storageEngine.DataTable[K, V]) *QueryBuilder[K, V] {
+type writeMode int
+
+const (
+	insertMode writeMode = iota
+	upsertMode
+	insertIfAbsentMode
+)
+
+type write[K comparable, V any] struct {
+	key  K
+	data V
+	mode writeMode
+}
+
+// NewQueryBuilder builds queries against either storage engine.
+func NewQueryBuilder[K comparable, V any](dt storageEngine.Table[K, V]) *QueryBuilder[K, V] {
 	return &QueryBuilder[K, V]{dt: dt, toDelete: false}
 }
 
@@ -38,6 +58,47 @@ func (qb *QueryBuilder[K, V]) Where(filter func(storageEngine.DataRow[K, V]) boo
 	return qb
 }
 
+// As names the table in plans and in the columns of joins.
+func (qb *QueryBuilder[K, V]) As(name string) *QueryBuilder[K, V] {
+	qb.name = name
+	return qb
+}
+
+// WhereConditions adds conditions the planner can match against indexes,
+// unlike the function given to Where.
+func (qb *QueryBuilder[K, V]) WhereConditions(conds ...Condition) *QueryBuilder[K, V] {
+	qb.conds = append(qb.conds, conds...)
+	return qb
+}
+
+func (qb *QueryBuilder[K, V]) OrderBy(field string, desc bool) *QueryBuilder[K, V] {
+	qb.tail.orderBy, qb.tail.desc = field, desc
+	return qb
+}
+
+func (qb *QueryBuilder[K, V]) Limit(n int) *QueryBuilder[K, V] {
+	qb.tail.limit = n
+	return qb
+}
+
+// Project picks the columns of []Record results.
+func (qb *QueryBuilder[K, V]) Project(fields ...string) *QueryBuilder[K, V] {
+	qb.tail.project = fields
+	return qb
+}
+
+// GroupBy and Aggregate summarise the rows; the groups are returned by
+// Execute as []Record.
+func (qb *QueryBuilder[K, V]) GroupBy(fields ...string) *QueryBuilder[K, V] {
+	qb.tail.groupBy = fields
+	return qb
+}
+
+func (qb *QueryBuilder[K, V]) Aggregate(aggs ...Aggregation) *QueryBuilder[K, V] {
+	qb.tail.aggs = append(qb.tail.aggs, aggs...)
+	return qb
+}
+
 func (qb *QueryBuilder[K, V]) GetFromKeys(keys []K) *QueryBuilder[K, V] {
 	qb.keys = keys
 	return qb
@@ -58,13 +119,43 @@ func (qb *QueryBuilder[K, V]) Delete() *QueryBuilder[K, V] {
 	return qb
 }
 
+// Insert queues a row that Execute inserts, failing with
+// storageEngine.ErrKeyExists if the key is taken.
+func (qb *QueryBuilder[K, V]) Insert(key K, data V) *QueryBuilder[K, V] {
+	qb.writes = append(qb.writes, write[K, V]{key, data, insertMode})
+	return qb
+}
+
+// Upsert queues a row that Execute inserts or replaces.
+func (qb *QueryBuilder[K, V]) Upsert(key K, data V) *QueryBuilder[K, V] {
+	qb.writes = append(qb.writes, write[K, V]{key, data, upsertMode})
+	return qb
+}
+
+// InsertIfAbsent queues a row that Execute inserts only if the key is free.
+func (qb *QueryBuilder[K, V]) InsertIfAbsent(key K, data V) *QueryBuilder[K, V] {
+	qb.writes = append(qb.writes, write[K, V]{key, data, insertIfAbsentMode})
+	return qb
+}
+
+// IfVersion makes the following update or delete apply only to rows still
+// at version, failing with a *storageEngine.ConflictError otherwise.
+func (qb *QueryBuilder[K, V]) IfVersion(version uint64) *QueryBuilder[K, V] {
+	qb.version = &version
+	return qb
+}
+
 func (qb *QueryBuilder[K, V]) ClearQb() {
 	qb.toDelete = false
 	qb.filter = nil
+	qb.conds = nil
+	qb.tail = tail{}
 	qb.keys = nil
 	qb.resultType = nil
 	qb.updateData = nil
 	qb.updateFunc = nil
+	qb.version = nil
+	qb.writes = nil
 }
 
 func Execute[K comparable, V any, R any](qb *QueryBuilder[K, V]) Result[R] {
@@ -72,18 +163,56 @@ func Execute[K comparable, V any, R any](qb *QueryBuilder[K, V]) Result[R] {
 
 	defer qb.ClearQb()
 
-	// Apply filter and fetch keys
-	if qb.filter != nil {
+	// Queued inserts run on their own; with an int result Execute returns
+	// how many rows were written
+	if qb.writes != nil {
+		n, err := qb.executeWrites()
+		if err != nil {
+			return Result[R]{Err: err}
+		}
+		if _, ok := any(result).(int); ok {
+			return Result[R]{Value: any(n).(R)}
+		}
+		return Result[R]{}
+	}
+
+	// Records, and the rows of filtered, sorted or limited queries, come
+	// from the planner
+	if _, ok := any(result).([]Record); ok {
+		plan := qb.Plan()
+		if plan.Err != nil {
+			return Result[R]{Err: plan.Err}
+		}
+		recs, err := run(plan.Value, "")
+		if err != nil {
+			return Result[R]{Err: err}
+		}
+		return Result[R]{Value: any(recs).(R)}
+	}
+	if qb.filterOnly() {
 		res := qb.dt.Where(qb.filter)
 		if res.Err != nil {
 			return Result[R]{Err: res.Err}
 		}
 		qb.keys = res.Value
+		if _, ok := any(result).([]K); ok {
+			return Result[R]{Value: any(qb.keys).(R)}
+		}
+	} else if qb.planned() {
+		rows, err := qb.planRows()
+		if err != nil {
+			return Result[R]{Err: err}
+		}
+		qb.keys = nil
+		for _, row := range rows {
+			qb.keys = append(qb.keys, row.PrimaryKey)
+		}
 
-		// If the result type is []K, return the keys
 		switch any(result).(type) {
 		case []K:
 			return Result[R]{Value: any(qb.keys).(R)}
+		case []storageEngine.DataRow[K, V]:
+			return Result[R]{Value: any(rows).(R)}
 		}
 	}
 
@@ -128,6 +257,13 @@ func Execute[K comparable, V any, R any](qb *QueryBuilder[K, V]) Result[R] {
 		}
 	}
 
+	if qb.version != nil {
+		if err := qb.executeIfVersion(*qb.version); err != nil {
+			return Result[R]{Err: err}
+		}
+		return Result[R]{}
+	}
+
 	// Perform update with data
 	if qb.updateData != nil {
 		for _, key := range qb.keys {
@@ -160,3 +296,59 @@ func Execute[K comparable, V any, R any](qb *QueryBuilder[K, V]) Result[R] {
 
 	return Result[R]{}
 }
+
+func (qb *QueryBuilder[K, V]) executeIfVersion(version uint64) error {
+	for _, key := range qb.keys {
+		if qb.toDelete {
+			if res := qb.dt.CompareAndDelete(key, version); res.Err != nil {
+				return res.Err
+			}
+			continue
+		}
+
+		var data V
+		switch {
+		case qb.updateData != nil:
+			data = *qb.updateData
+		case qb.updateFunc != nil:
+			// the swap fails if the row changes after this read
+			row := qb.dt.Search(key)
+			if row.Err != nil {
+				return row.Err
+			}
+			data = qb.updateFunc(row.Value.Data)
+		default:
+			continue
+		}
+		if res := qb.dt.CompareAndSwap(key, version, data); res.Err != nil {
+			return res.Err
+		}
+	}
+	return nil
+}
+
+func (qb *QueryBuilder[K, V]) executeWrites() (int, error) {
+	n := 0
+	for _, w := range qb.writes {
+		switch w.mode {
+		case insertMode:
+			if res := qb.dt.Insert(w.key, w.data); res.Err != nil {
+				return n, res.Err
+			}
+		case upsertMode:
+			if res := qb.dt.Upsert(w.key, w.data); res.Err != nil {
+				return n, res.Err
+			}
+		case insertIfAbsentMode:
+			res := qb.dt.InsertIfAbsent(w.key, w.data)
+			if res.Err != nil {
+				return n, res.Err
+			}
+			if !res.Value {
+				continue
+			}
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,80 @@
+package resp
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var errBadPattern = errors.New("malformed pattern")
+
+// compileGlob turns a Redis glob into a regexp. As in Redis, * and ? match
+// any characters including /, [...] is a class that ^ negates and a-z
+// ranges fill, and \ makes the next character literal.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var re strings.Builder
+	re.WriteString(`(?s)^`)
+	chars := []rune(pattern)
+	for i := 0; i < len(chars); i++ {
+		switch c := chars[i]; c {
+		case '*':
+			re.WriteString(`.*`)
+		case '?':
+			re.WriteString(`.`)
+		case '\\':
+			if i++; i == len(chars) {
+				return nil, errBadPattern
+			}
+			re.WriteString(regexp.QuoteMeta(string(chars[i])))
+		case '[':
+			end, class, err := globClass(chars, i+1)
+			if err != nil {
+				return nil, err
+			}
+			re.WriteString(class)
+			i = end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString(`$`)
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, errBadPattern
+	}
+	return compiled, nil
+}
+
+// globClass converts the class starting after the [ at chars[start] and
+// returns the index of its closing ].
+func globClass(chars []rune, start int) (int, string, error) {
+	var class strings.Builder
+	class.WriteByte('[')
+	i := start
+	if i < len(chars) && chars[i] == '^' {
+		class.WriteByte('^')
+		i++
+	}
+	members := 0
+	for ; i < len(chars) && chars[i] != ']'; i++ {
+		c := chars[i]
+		if c == '\\' {
+			if i++; i == len(chars) {
+				return 0, "", errBadPattern
+			}
+			c = chars[i]
+		}
+		class.WriteString(regexp.QuoteMeta(string(c)))
+		if i+2 < len(chars) && chars[i+1] == '-' && chars[i+2] != ']' {
+			class.WriteByte('-')
+			class.WriteString(regexp.QuoteMeta(string(chars[i+2])))
+			i += 2
+		}
+		members++
+	}
+	if i == len(chars) || members == 0 {
+		return 0, "", errBadPattern
+	}
+	class.WriteByte(']')
+	return i, class.String(), nil
+}
@@ -0,0 +1,429 @@
+package resp
+
+import (
+	"ZeroStore/storageEngine"
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// indexFlushInterval is how often writes since the last save are flushed to
+// the index file; Close saves whatever is left.
+const indexFlushInterval = time.Second
+
+// maxCursors bounds the SCAN cursors remembered; a cursor older than the
+// last maxCursors handed out is rejected.
+const maxCursors = 1024
+
+type Server struct {
+	dt *storageEngine.DataTable[string, []byte]
+	// writes check-then-insert, so they are serialised across connections
+	mu    sync.Mutex
+	dirty bool
+	// flushErr is the last failed background save, reported to the next write
+	flushErr error
+	stop     chan struct{}
+	flushed  chan struct{}
+
+	// cursors maps each SCAN cursor to the key its next page starts at
+	cursorMu   sync.Mutex
+	cursors    map[uint64]string
+	lastCursor uint64
+
+	connMu    sync.Mutex
+	listener  net.Listener
+	conns     map[net.Conn]struct{}
+	closed    bool
+	connGroup sync.WaitGroup
+}
+
+func NewServer(dt *storageEngine.DataTable[string, []byte]) *Server {
+	s := &Server{
+		dt:      dt,
+		stop:    make(chan struct{}),
+		flushed: make(chan struct{}),
+		cursors: make(map[uint64]string),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	go s.flushLoop()
+	return s
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+func (s *Server) Serve(l net.Listener) error {
+	s.connMu.Lock()
+	if s.closed {
+		s.connMu.Unlock()
+		l.Close()
+		return net.ErrClosed
+	}
+	s.listener = l
+	s.connMu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.connMu.Lock()
+			closed := s.closed
+			s.connMu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		s.connMu.Lock()
+		s.conns[conn] = struct{}{}
+		s.connGroup.Add(1)
+		s.connMu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) Close() error {
+	s.connMu.Lock()
+	if !s.closed {
+		close(s.stop)
+	}
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.connMu.Unlock()
+
+	s.connGroup.Wait()
+	<-s.flushed
+	return s.flushIndex()
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.connMu.Lock()
+		delete(s.conns, conn)
+		s.connMu.Unlock()
+		s.connGroup.Done()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := writer{bufio.NewWriter(conn)}
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				w.error(err.Error())
+				w.Flush()
+			}
+			return
+		}
+
+		if len(args) > 0 {
+			if quit := s.dispatch(w, args); quit {
+				w.Flush()
+				return
+			}
+		}
+
+		// Pipelined clients send many commands before reading any replies,
+		// so replies are only flushed once the input runs dry.
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) dispatch(w writer, args [][]byte) bool {
+	name := strings.ToUpper(string(args[0]))
+	args = args[1:]
+
+	switch name {
+	case "PING":
+		if len(args) > 0 {
+			w.bulk(args[0])
+		} else {
+			w.simple("PONG")
+		}
+	case "ECHO":
+		if len(args) != 1 {
+			w.error(arityError(name))
+			break
+		}
+		w.bulk(args[0])
+	case "QUIT":
+		w.simple("OK")
+		return true
+	case "SELECT":
+		if len(args) != 1 || string(args[0]) != "0" {
+			w.error("ERR DB index is out of range")
+			break
+		}
+		w.simple("OK")
+	case "COMMAND":
+		w.array(0)
+	case "GET":
+		if len(args) != 1 {
+			w.error(arityError(name))
+			break
+		}
+		w.bulk(s.get(string(args[0])))
+	case "MGET":
+		if len(args) == 0 {
+			w.error(arityError(name))
+			break
+		}
+		w.array(len(args))
+		for _, key := range args {
+			w.bulk(s.get(string(key)))
+		}
+	case "SET":
+		if len(args) != 2 {
+			w.error("ERR syntax error")
+			break
+		}
+		if err := s.set([][]byte{args[0], args[1]}); err != nil {
+			w.error("ERR " + err.Error())
+			break
+		}
+		w.simple("OK")
+	case "MSET":
+		if len(args) == 0 || len(args)%2 != 0 {
+			w.error(arityError(name))
+			break
+		}
+		if err := s.set(args); err != nil {
+			w.error("ERR " + err.Error())
+			break
+		}
+		w.simple("OK")
+	case "DEL":
+		if len(args) == 0 {
+			w.error(arityError(name))
+			break
+		}
+		n, err := s.del(args)
+		if err != nil {
+			w.error("ERR " + err.Error())
+			break
+		}
+		w.integer(n)
+	case "EXISTS":
+		if len(args) == 0 {
+			w.error(arityError(name))
+			break
+		}
+		n := 0
+		for _, key := range args {
+			if s.dt.Search(string(key)).Err == nil {
+				n++
+			}
+		}
+		w.integer(n)
+	case "SCAN":
+		s.scan(w, args)
+	default:
+		w.error("ERR unknown command '" + strings.ToLower(name) + "'")
+	}
+	return false
+}
+
+func (s *Server) get(key string) []byte {
+	res := s.dt.Search(key)
+	if res.Err != nil {
+		return nil
+	}
+	// gob drops empty slices, so an empty value decodes as nil
+	if res.Value.Data == nil {
+		return []byte{}
+	}
+	return res.Value.Data
+}
+
+func (s *Server) set(pairs [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.takeFlushErr(); err != nil {
+		return err
+	}
+
+	for i := 0; i < len(pairs); i += 2 {
+		if res := s.dt.Upsert(string(pairs[i]), pairs[i+1]); res.Err != nil {
+			return res.Err
+		}
+		s.dirty = true
+	}
+	return nil
+}
+
+func (s *Server) del(keys [][]byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.takeFlushErr(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, key := range keys {
+		res := s.dt.Delete(string(key))
+		if errors.Is(res.Err, storageEngine.ErrKeyNotFound) {
+			continue
+		}
+		if res.Err != nil {
+			return n, res.Err
+		}
+		s.dirty = true
+		n++
+	}
+	return n, nil
+}
+
+// scan pages through the keys in order. Each cursor stands for the key the
+// next page starts at, so a page costs a walk down the index and no more,
+// and a key present for the whole iteration is returned exactly once.
+func (s *Server) scan(w writer, args [][]byte) {
+	if len(args) == 0 {
+		w.error(arityError("SCAN"))
+		return
+	}
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		w.error("ERR invalid cursor")
+		return
+	}
+	start := ""
+	if cursor != 0 {
+		s.cursorMu.Lock()
+		key, ok := s.cursors[cursor]
+		s.cursorMu.Unlock()
+		if !ok {
+			w.error("ERR invalid cursor")
+			return
+		}
+		start = key
+	}
+
+	var pattern *regexp.Regexp
+	count := 10
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			w.error("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			if pattern, err = compileGlob(string(args[i+1])); err != nil {
+				w.error("ERR invalid MATCH pattern: " + err.Error())
+				return
+			}
+		case "COUNT":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count < 1 {
+				w.error("ERR syntax error")
+				return
+			}
+		default:
+			w.error("ERR syntax error")
+			return
+		}
+	}
+
+	// the key after the page is where the next one starts
+	keys := s.dt.KeysFrom(start, count+1)
+	var next uint64
+	if len(keys) > count {
+		next = s.saveCursor(keys[count])
+		keys = keys[:count]
+	}
+
+	var matched []string
+	for _, key := range keys {
+		if pattern != nil && !pattern.MatchString(key) {
+			continue
+		}
+		matched = append(matched, key)
+	}
+
+	w.array(2)
+	w.bulk([]byte(strconv.FormatUint(next, 10)))
+	w.array(len(matched))
+	for _, key := range matched {
+		w.bulk([]byte(key))
+	}
+}
+
+func (s *Server) saveCursor(start string) uint64 {
+	s.cursorMu.Lock()
+	defer s.cursorMu.Unlock()
+
+	s.lastCursor++
+	s.cursors[s.lastCursor] = start
+	delete(s.cursors, s.lastCursor-maxCursors)
+	return s.lastCursor
+}
+
+// flushLoop saves the index every indexFlushInterval until Close, so a
+// burst of writes costs one save instead of one each.
+func (s *Server) flushLoop() {
+	defer close(s.flushed)
+	ticker := time.NewTicker(indexFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.flushIndex(); err != nil {
+				s.mu.Lock()
+				s.flushErr = err
+				s.mu.Unlock()
+			}
+		}
+	}
+}
+
+// takeFlushErr returns and clears the last failed save; s.mu must be held.
+func (s *Server) takeFlushErr() error {
+	err := s.flushErr
+	s.flushErr = nil
+	if err != nil {
+		return fmt.Errorf("saving the index: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) flushIndex() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	if res := s.dt.SaveIndex(); res.Err != nil {
+		return res.Err
+	}
+	s.dirty = false
+	return nil
+}
+
+func arityError(name string) string {
+	return "ERR wrong number of arguments for '" + strings.ToLower(name) + "' command"
+}
@@ -0,0 +1,290 @@
+package resp
+
+import (
+	"ZeroStore/storageEngine"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func openKV(t *testing.T, name string) *storageEngine.DataTable[string, []byte] {
+	t.Helper()
+	dt, err := storageEngine.NewDataTable[string, []byte](strings.Compare, name, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dt
+}
+
+// startServer serves dt on a loopback port and returns a connection to it.
+func startServer(t *testing.T, dt *storageEngine.DataTable[string, []byte]) (*Server, net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(dt)
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+	t.Cleanup(func() {
+		srv.Close()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+	})
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return srv, conn
+}
+
+// encode writes commands as RESP arrays of bulk strings.
+func encode(cmds ...[]string) string {
+	var b strings.Builder
+	for _, cmd := range cmds {
+		fmt.Fprintf(&b, "*%d\r\n", len(cmd))
+		for _, arg := range cmd {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	return b.String()
+}
+
+// readReply decodes one reply: simple strings and bulks as string, nil bulks
+// as nil, integers as int, errors as error and arrays as []any.
+func readReply(t *testing.T, r *bufio.Reader) any {
+	t.Helper()
+	line, err := readLine(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(line) == 0 {
+		t.Fatal("empty reply line")
+	}
+	body := string(line[1:])
+	switch line[0] {
+	case '+':
+		return body
+	case '-':
+		return errors.New(body)
+	case ':':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n < 0 {
+			return nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		items := make([]any, n)
+		for i := range items {
+			items[i] = readReply(t, r)
+		}
+		return items
+	}
+	t.Fatalf("unknown reply %q", line)
+	return nil
+}
+
+func TestPipelinedCommands(t *testing.T) {
+	dt := openKV(t, filepath.Join(t.TempDir(), "kv"))
+	defer dt.Close()
+	_, conn := startServer(t, dt)
+
+	if _, err := io.WriteString(conn, encode(
+		[]string{"SET", "a", "1"},
+		[]string{"SET", "b", "two words"},
+		[]string{"MSET", "c", "3", "d", ""},
+		[]string{"GET", "a"},
+		[]string{"GET", "b"},
+		[]string{"DEL", "b", "missing"},
+		[]string{"GET", "b"},
+		[]string{"GET", "d"},
+		[]string{"EXISTS", "a", "b", "c"},
+		[]string{"SCAN", "0", "MATCH", "[a-c]", "COUNT", "10"},
+		[]string{"GET"},
+	)); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(conn)
+	want := []any{
+		"OK", "OK", "OK",
+		"1", "two words",
+		1, nil, "",
+		2,
+		[]any{"0", []any{"a", "c"}},
+		errors.New(arityError("GET")),
+	}
+	for i, w := range want {
+		if got := readReply(t, r); !reflect.DeepEqual(got, w) {
+			t.Fatalf("reply %d = %#v, want %#v", i, got, w)
+		}
+	}
+}
+
+// scanAll follows SCAN cursors from 0 until the server returns 0 again.
+func scanAll(t *testing.T, conn net.Conn, r *bufio.Reader, count int) (keys []string, pages int) {
+	t.Helper()
+	cursor := "0"
+	for {
+		if _, err := io.WriteString(conn, encode([]string{"SCAN", cursor, "COUNT", strconv.Itoa(count)})); err != nil {
+			t.Fatal(err)
+		}
+		reply, ok := readReply(t, r).([]any)
+		if !ok || len(reply) != 2 {
+			t.Fatalf("SCAN reply = %#v", reply)
+		}
+		page := reply[1].([]any)
+		if len(page) > count {
+			t.Fatalf("SCAN page has %d keys, COUNT is %d", len(page), count)
+		}
+		for _, key := range page {
+			keys = append(keys, key.(string))
+		}
+		pages++
+		if cursor = reply[0].(string); cursor == "0" {
+			return keys, pages
+		}
+	}
+}
+
+func TestScanCursor(t *testing.T) {
+	dt := openKV(t, filepath.Join(t.TempDir(), "kv"))
+	defer dt.Close()
+	_, conn := startServer(t, dt)
+	r := bufio.NewReader(conn)
+
+	var set []string
+	var want []string
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		set = append(set, "SET", key, "v")
+		want = append(want, key)
+	}
+	var cmds [][]string
+	for i := 0; i < len(set); i += 3 {
+		cmds = append(cmds, set[i:i+3])
+	}
+	io.WriteString(conn, encode(cmds...))
+	for range cmds {
+		if got := readReply(t, r); got != "OK" {
+			t.Fatalf("SET = %#v", got)
+		}
+	}
+
+	keys, pages := scanAll(t, conn, r, 7)
+	if !sort.StringsAreSorted(keys) || !reflect.DeepEqual(keys, want) {
+		t.Fatalf("SCAN returned %v, want %v", keys, want)
+	}
+	if pages != 8 {
+		t.Fatalf("SCAN took %d pages, want 8", pages)
+	}
+
+	// a key deleted under the cursor does not lose the page after it
+	io.WriteString(conn, encode([]string{"SCAN", "0", "COUNT", "10"}))
+	cursor := readReply(t, r).([]any)[0].(string)
+	io.WriteString(conn, encode([]string{"DEL", "key10"}, []string{"SCAN", cursor, "COUNT", "1"}))
+	readReply(t, r)
+	if got := readReply(t, r).([]any)[1]; !reflect.DeepEqual(got, []any{"key11"}) {
+		t.Fatalf("page after a deleted start key = %#v", got)
+	}
+
+	io.WriteString(conn, encode([]string{"SCAN", "999999", "COUNT", "1"}))
+	if got, ok := readReply(t, r).(error); !ok || got.Error() != "ERR invalid cursor" {
+		t.Fatalf("unknown cursor = %#v", got)
+	}
+}
+
+func TestScanMatchGlob(t *testing.T) {
+	dt := openKV(t, filepath.Join(t.TempDir(), "kv"))
+	defer dt.Close()
+	_, conn := startServer(t, dt)
+	r := bufio.NewReader(conn)
+
+	for _, key := range []string{"users/1", "users/1/posts/2", "users/2", "orders/1", "user", "a*b", "a-b"} {
+		io.WriteString(conn, encode([]string{"SET", key, "v"}))
+		readReply(t, r)
+	}
+	tests := []struct {
+		pattern string
+		want    any
+	}{
+		// * and ? cross / as in Redis
+		{"users/*", []any{"users/1", "users/1/posts/2", "users/2"}},
+		{"*/posts/*", []any{"users/1/posts/2"}},
+		{"users?1", []any{"users/1"}},
+		{"?ser", []any{"user"}},
+		{"[^u]*", []any{"a*b", "a-b", "orders/1"}},
+		{"[n-p]*", []any{"orders/1"}},
+		{"a\\*b", []any{"a*b"}},
+		{"a[*-]b", []any{"a*b", "a-b"}},
+		{"users/[", errors.New("ERR invalid MATCH pattern: malformed pattern")},
+		{"users\\", errors.New("ERR invalid MATCH pattern: malformed pattern")},
+		{"[]", errors.New("ERR invalid MATCH pattern: malformed pattern")},
+		{"[z-a]", errors.New("ERR invalid MATCH pattern: malformed pattern")},
+	}
+	for _, tt := range tests {
+		io.WriteString(conn, encode([]string{"SCAN", "0", "MATCH", tt.pattern, "COUNT", "100"}))
+		got := readReply(t, r)
+		if reply, ok := got.([]any); ok {
+			got = reply[1]
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SCAN MATCH %q = %#v, want %#v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestCloseSavesIndex(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "kv")
+	dt := openKV(t, name)
+	srv, conn := startServer(t, dt)
+	r := bufio.NewReader(conn)
+
+	io.WriteString(conn, encode([]string{"SET", "kept", "yes"}, []string{"SET", "gone", "no"}, []string{"DEL", "gone"}))
+	for i := 0; i < 3; i++ {
+		readReply(t, r)
+	}
+	if err := srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if res := dt.Close(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	dt = openKV(t, name)
+	defer dt.Close()
+	if res := dt.LoadIndex(dt.IndexFile.Name()); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if keys := dt.Keys(); !reflect.DeepEqual(keys, []string{"kept"}) {
+		t.Fatalf("keys after reopening = %v, want [kept]", keys)
+	}
+}
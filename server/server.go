@@ -0,0 +1,261 @@
+package server
+
+import (
+	"ZeroStore/catalog"
+	"ZeroStore/queryEngine"
+	"ZeroStore/storageEngine"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const maxBodySize = 16 << 20
+
+type Server struct {
+	db  *catalog.Database
+	mux *http.ServeMux
+}
+
+func New(db *catalog.Database) *Server {
+	s := &Server{db: db, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /tables", s.listTables)
+	s.mux.HandleFunc("GET /tables/{name}/rows", s.scanRows)
+	s.mux.HandleFunc("GET /tables/{name}/rows/{key}", s.getRow)
+	s.mux.HandleFunc("POST /tables/{name}/rows", s.createRow)
+	s.mux.HandleFunc("PUT /tables/{name}/rows/{key}", s.putRow)
+	s.mux.HandleFunc("DELETE /tables/{name}/rows/{key}", s.deleteRow)
+	s.mux.HandleFunc("POST /tables/{name}/query", s.query)
+	s.mux.HandleFunc("GET /tables/{name}/blobs/{key}", s.getBlob)
+	s.mux.HandleFunc("PUT /tables/{name}/blobs/{key}", s.putBlob)
+	s.mux.HandleFunc("DELETE /tables/{name}/blobs/{key}", s.deleteBlob)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s)
+}
+
+func (s *Server) listTables(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.db.Tables())
+}
+
+func (s *Server) getRow(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.table(w, r)
+	if !ok {
+		return
+	}
+	row, err := t.Get(r.PathValue("key"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, row)
+}
+
+func (s *Server) putRow(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.table(w, r)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{err.Error()})
+		return
+	}
+	if err := t.Put(r.PathValue("key"), body); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createRow inserts the body under a generated key and returns the key.
+func (s *Server) createRow(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.table(w, r)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{err.Error()})
+		return
+	}
+	key, err := t.InsertAuto(body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{catalog.KeyColumn: key})
+}
+
+func (s *Server) deleteRow(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.table(w, r)
+	if !ok {
+		return
+	}
+	if err := t.Delete(r.PathValue("key")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getBlob(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.table(w, r)
+	if !ok {
+		return
+	}
+	blob, size, err := t.OpenBlob(r.PathValue("key"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer blob.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	io.Copy(w, blob)
+}
+
+// putBlob streams the body into the blob without holding it in memory.
+func (s *Server) putBlob(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.table(w, r)
+	if !ok {
+		return
+	}
+	blob, err := t.CreateBlob(r.PathValue("key"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if _, err := io.Copy(blob, r.Body); err != nil {
+		blob.Abort()
+		writeJSON(w, http.StatusBadRequest, errorBody{err.Error()})
+		return
+	}
+	if err := blob.Close(); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) deleteBlob(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.table(w, r)
+	if !ok {
+		return
+	}
+	if err := t.DeleteBlob(r.PathValue("key")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) scanRows(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.table(w, r)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	streamRows(w, t.ScanContext(ctx))
+}
+
+func (s *Server) query(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.table(w, r)
+	if !ok {
+		return
+	}
+
+	var q queryEngine.Query
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.UseNumber()
+	if err := dec.Decode(&q); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{err.Error()})
+		return
+	}
+	for i, c := range q.Where {
+		if n, ok := c.Value.(json.Number); ok {
+			f, _ := n.Float64()
+			q.Where[i].Value = f
+		}
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	rows, err := t.QueryContext(ctx, q)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{err.Error()})
+		return
+	}
+	streamRows(w, rows)
+}
+
+func (s *Server) table(w http.ResponseWriter, r *http.Request) (catalog.Table, bool) {
+	t, err := s.db.Table(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return nil, false
+	}
+	return t, true
+}
+
+// streamRows writes one JSON object per line as rows arrive. Once the first
+// row is out the status is fixed, so a later failure is reported as a final
+// {"error": ...} line instead. It returns as soon as a write fails; the
+// caller cancels the context rows was started with, which stops the scan
+// and releases its snapshot.
+func streamRows(w http.ResponseWriter, rows <-chan storageEngine.Result[catalog.Row]) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	for res := range rows {
+		if res.Err != nil {
+			enc.Encode(errorBody{res.Err.Error()})
+			return
+		}
+		if err := enc.Encode(res.Value); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, storageEngine.ErrKeyNotFound), errors.Is(err, catalog.ErrTableNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, catalog.ErrInvalidKey), errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		status = http.StatusBadRequest
+	case errors.Is(err, storageEngine.ErrKeyExists), errors.Is(err, storageEngine.ErrVersionConflict),
+		errors.Is(err, catalog.ErrForeignKey), errors.Is(err, storageEngine.ErrConstraint):
+		status = http.StatusConflict
+	case errors.Is(err, storageEngine.ErrNoAutoKey):
+		status = http.StatusMethodNotAllowed
+	}
+	writeJSON(w, status, errorBody{err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
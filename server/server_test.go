@@ -0,0 +1,240 @@
+package server
+
+import (
+	"ZeroStore/catalog"
+	"ZeroStore/keys"
+	"ZeroStore/storageEngine"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type person struct {
+	Name string `zerostore:"notnull"`
+	Age  int
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	catalog.Register[int, person]("people", keys.Ordered[int])
+	db, err := catalog.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(New(db))
+	t.Cleanup(func() {
+		srv.Close()
+		db.Close()
+	})
+	return srv
+}
+
+func do(t *testing.T, srv *httptest.Server, method, path, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(b)
+}
+
+func TestRowLifecycle(t *testing.T) {
+	srv := newTestServer(t)
+
+	if resp, body := do(t, srv, "PUT", "/tables/people/rows/7", `{"Name":"ada","Age":36}`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT = %d %s", resp.StatusCode, body)
+	}
+	resp, body := do(t, srv, "GET", "/tables/people/rows/7", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET = %d %s", resp.StatusCode, body)
+	}
+	var row map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &row); err != nil {
+		t.Fatal(err)
+	}
+	if row["_key"] != 7.0 || row["Name"] != "ada" || row["Age"] != 36.0 {
+		t.Fatalf("GET = %s", body)
+	}
+
+	if resp, body := do(t, srv, "PUT", "/tables/people/rows/7", `{"Name":"ada","Age":37}`); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT over an existing row = %d %s", resp.StatusCode, body)
+	}
+	if _, body := do(t, srv, "GET", "/tables/people/rows/7", ""); !strings.Contains(body, `"Age":37`) {
+		t.Fatalf("GET after update = %s", body)
+	}
+
+	resp, body = do(t, srv, "POST", "/tables/people/rows", `{"Name":"bob"}`)
+	if resp.StatusCode != http.StatusCreated || !strings.Contains(body, `"_key":`) {
+		t.Fatalf("POST = %d %s", resp.StatusCode, body)
+	}
+
+	if resp, body := do(t, srv, "DELETE", "/tables/people/rows/7", ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("DELETE = %d %s", resp.StatusCode, body)
+	}
+	if resp, _ := do(t, srv, "GET", "/tables/people/rows/7", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET after DELETE = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	srv := newTestServer(t)
+	do(t, srv, "PUT", "/tables/people/rows/1", `{"Name":"ada"}`)
+
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"GET", "/tables/nobody/rows/1", "", http.StatusNotFound},
+		{"GET", "/tables/people/rows/2", "", http.StatusNotFound},
+		{"DELETE", "/tables/people/rows/2", "", http.StatusNotFound},
+		{"GET", "/tables/people/rows/abc", "", http.StatusBadRequest},
+		{"PUT", "/tables/people/rows/2", `{"Name":`, http.StatusBadRequest},
+		{"PUT", "/tables/people/rows/2", `{"Age":"old"}`, http.StatusBadRequest},
+		{"PUT", "/tables/people/rows/2", `{"Age":3}`, http.StatusConflict},
+		{"POST", "/tables/people/query", `{"where":[`, http.StatusBadRequest},
+		{"POST", "/tables/people/query", `{"select":["Height"]}`, http.StatusBadRequest},
+		{"POST", "/tables/people/query", `{"where":[{"field":"Age","op":"~","value":1}]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, body := do(t, srv, tt.method, tt.path, tt.body)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s %s = %d %s, want %d", tt.method, tt.path, tt.body, resp.StatusCode, body, tt.status)
+			continue
+		}
+		var e errorBody
+		if err := json.Unmarshal([]byte(body), &e); err != nil || e.Error == "" {
+			t.Errorf("%s %s: body %q is not an error object", tt.method, tt.path, body)
+		}
+	}
+}
+
+// readLines reads an NDJSON response, checking its content type.
+func readLines(t *testing.T, resp *http.Response) []map[string]interface{} {
+	t.Helper()
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var lines []map[string]interface{}
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestScanAndQueryStreamNDJSON(t *testing.T) {
+	srv := newTestServer(t)
+	for age := 1; age <= 10; age++ {
+		key := strconv.Itoa(age)
+		if resp, body := do(t, srv, "PUT", "/tables/people/rows/"+key, `{"Name":"p","Age":`+key+`}`); resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("PUT = %d %s", resp.StatusCode, body)
+		}
+	}
+
+	resp, err := srv.Client().Get(srv.URL + "/tables/people/rows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := readLines(t, resp)
+	if len(rows) != 10 {
+		t.Fatalf("scan returned %d rows, want 10", len(rows))
+	}
+	for i, row := range rows {
+		if row["_key"] != float64(i+1) {
+			t.Fatalf("scan row %d = %v, want key %d", i, row, i+1)
+		}
+	}
+
+	resp, err = srv.Client().Post(srv.URL+"/tables/people/query", "application/json",
+		strings.NewReader(`{"where":[{"field":"Age","op":">","value":4}],"select":["Age"],"limit":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("query = %d", resp.StatusCode)
+	}
+	rows = readLines(t, resp)
+	if len(rows) != 3 {
+		t.Fatalf("query returned %d rows, want 3", len(rows))
+	}
+	for i, row := range rows {
+		if row["Age"] != float64(i+5) || row["Name"] != nil {
+			t.Fatalf("query row %d = %v", i, row)
+		}
+	}
+}
+
+// failingWriter is a client that went away: every write fails.
+type failingWriter struct {
+	header http.Header
+	writes int
+}
+
+func (w *failingWriter) Header() http.Header { return w.header }
+func (w *failingWriter) WriteHeader(int)     {}
+func (w *failingWriter) Write([]byte) (int, error) {
+	w.writes++
+	return 0, errors.New("connection reset")
+}
+
+func TestStreamStopsWhenClientGoesAway(t *testing.T) {
+	catalog.Register[int, person]("people", keys.Ordered[int])
+	db, err := catalog.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	people, err := db.Table("people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key := 1; key <= 500; key++ {
+		if err := people.Insert(key, map[string]interface{}{"Name": "p"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := New(db)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest("GET", "/tables/people/rows", nil),
+		httptest.NewRequest("POST", "/tables/people/query", strings.NewReader(`{"where":[{"field":"Age","op":"=","value":0}]}`)),
+	} {
+		w := &failingWriter{header: http.Header{}}
+		s.ServeHTTP(w, req)
+		if w.writes != 1 {
+			t.Fatalf("%s %s: %d writes after the first failed", req.Method, req.URL, w.writes-1)
+		}
+		// the scan's snapshot blocks Compact until it is released
+		deadline := time.Now().Add(5 * time.Second)
+		for err := people.Compact(); err != nil; err = people.Compact() {
+			if !errors.Is(err, storageEngine.ErrSnapshotActive) || time.Now().After(deadline) {
+				t.Fatalf("%s %s: Compact = %v, want the scan's snapshot released", req.Method, req.URL, err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package sqlDriver
+
+import (
+	"ZeroStore/catalog"
+	"ZeroStore/queryEngine"
+	"ZeroStore/storageEngine"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+)
+
+const DriverName = "zerostore"
+
+var errNoTransactions = errors.New("zerostore: transactions are not supported")
+
+func init() {
+	sql.Register(DriverName, &Driver{})
+}
+
+// Driver opens the directory named by the DSN. Tables come from
+// catalog.Register, so the program must register its schemas before
+// calling sql.Open.
+type Driver struct{}
+
+type sharedDB struct {
+	db   *catalog.Database
+	refs int
+}
+
+var (
+	openMu sync.Mutex
+	// every connection to a directory shares one Database so its tables are
+	// opened only once
+	openDBs = map[string]*sharedDB{}
+)
+
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	dir, err := filepath.Abs(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	openMu.Lock()
+	defer openMu.Unlock()
+
+	shared, ok := openDBs[dir]
+	if !ok {
+		db, err := catalog.Open(dir)
+		if err != nil {
+			return nil, err
+		}
+		shared = &sharedDB{db: db}
+		openDBs[dir] = shared
+	}
+	shared.refs++
+	return &conn{dir: dir, db: shared.db}, nil
+}
+
+type conn struct {
+	dir string
+	db  *catalog.Database
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	t, err := c.db.Table(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	return &stmtHandle{stmt: stmt, table: t}, nil
+}
+
+func (c *conn) Close() error {
+	openMu.Lock()
+	defer openMu.Unlock()
+
+	shared := openDBs[c.dir]
+	if shared == nil {
+		return nil
+	}
+	if shared.refs--; shared.refs > 0 {
+		return nil
+	}
+	delete(openDBs, c.dir)
+	return shared.db.Close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, errNoTransactions
+}
+
+type stmtHandle struct {
+	stmt  *statement
+	table catalog.Table
+}
+
+func (s *stmtHandle) Close() error {
+	return nil
+}
+
+func (s *stmtHandle) NumInput() int {
+	return s.stmt.numArgs
+}
+
+func (s *stmtHandle) Exec(args []driver.Value) (driver.Result, error) {
+	values := toInterfaces(args)
+	stmt := s.stmt
+
+	switch stmt.kind {
+	case insertStmt:
+		var key interface{}
+		fields := make(map[string]interface{}, len(stmt.columns))
+		for i, col := range stmt.columns {
+			if col == catalog.KeyColumn {
+				key = bind(stmt.values[i], values)
+				continue
+			}
+			fields[col] = bind(stmt.values[i], values)
+		}
+		if err := s.table.Insert(key, fields); err != nil {
+			return nil, err
+		}
+		return result(1), nil
+	case updateStmt:
+		fields := make(map[string]interface{}, len(stmt.set))
+		for _, a := range stmt.set {
+			fields[a.column] = bind(a.value, values)
+		}
+		n, err := s.table.UpdateWhere(stmt.conditions(values), fields)
+		return result(n), err
+	case deleteStmt:
+		n, err := s.table.DeleteWhere(stmt.conditions(values))
+		return result(n), err
+	}
+	return nil, fmt.Errorf("zerostore: use Query for SELECT")
+}
+
+func (s *stmtHandle) Query(args []driver.Value) (driver.Rows, error) {
+	if s.stmt.kind != selectStmt {
+		return nil, fmt.Errorf("zerostore: use Exec for statements that do not return rows")
+	}
+
+	columns := s.stmt.columns
+	if len(columns) == 0 {
+		columns = append([]string{catalog.KeyColumn}, s.table.Columns()...)
+	}
+
+	q := queryEngine.Query{Where: s.stmt.conditions(toInterfaces(args)), Select: columns, Limit: s.stmt.limit}
+	ch, err := s.table.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{columns: columns, ch: ch}, nil
+}
+
+type rows struct {
+	columns []string
+	ch      <-chan storageEngine.Result[catalog.Row]
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	for range r.ch {
+	}
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	res, ok := <-r.ch
+	if !ok {
+		return io.EOF
+	}
+	if res.Err != nil {
+		return res.Err
+	}
+
+	row := res.Value
+	i := 0
+	for n, col := range r.columns {
+		var v interface{}
+		if col == catalog.KeyColumn {
+			v = row.Key
+		} else {
+			v = row.Values[i]
+			i++
+		}
+		converted, err := driver.DefaultParameterConverter.ConvertValue(v)
+		if err != nil {
+			converted = fmt.Sprint(v)
+		}
+		dest[n] = converted
+	}
+	return nil
+}
+
+type result int64
+
+func (r result) LastInsertId() (int64, error) {
+	return 0, errors.New("zerostore: LastInsertId is not supported")
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+func toInterfaces(args []driver.Value) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, a := range args {
+		values[i] = a
+	}
+	return values
+}
@@ -0,0 +1,210 @@
+package sqlDriver
+
+import (
+	"ZeroStore/catalog"
+	"ZeroStore/keys"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type person struct {
+	Name string
+	Age  int
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  statement
+	}{
+		{
+			"SELECT _key, Name FROM people WHERE Age >= ? AND Name <> 'o''brien' LIMIT 5;",
+			statement{kind: selectStmt, table: "people", columns: []string{"_key", "Name"}, limit: 5, numArgs: 1,
+				where: []condition{{"Age", ">=", placeholder(0)}, {"Name", "!=", "o'brien"}}},
+		},
+		{
+			"select * from people",
+			statement{kind: selectStmt, table: "people"},
+		},
+		{
+			"INSERT INTO people (_key, Name, Age) VALUES (?, ?, 36)",
+			statement{kind: insertStmt, table: "people", columns: []string{"_key", "Name", "Age"}, numArgs: 2,
+				values: []interface{}{placeholder(0), placeholder(1), int64(36)}},
+		},
+		{
+			"UPDATE people SET Age = ?, Name = 'x' WHERE _key = ?",
+			statement{kind: updateStmt, table: "people", numArgs: 2,
+				set:   []assignment{{"Age", placeholder(0)}, {"Name", "x"}},
+				where: []condition{{"_key", "=", placeholder(1)}}},
+		},
+		{
+			"DELETE FROM people WHERE Age < 1.5 AND Name != NULL",
+			statement{kind: deleteStmt, table: "people",
+				where: []condition{{"Age", "<", 1.5}, {"Name", "!=", nil}}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parse(tt.query)
+		if err != nil {
+			t.Errorf("parse(%q): %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("parse(%q) = %+v, want %+v", tt.query, *got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct{ query, err string }{
+		{"DROP TABLE people", "unsupported statement"},
+		{"SELECT Name people", "expected FROM"},
+		{"SELECT * FROM people LIMIT -1", "invalid LIMIT"},
+		{"SELECT * FROM people LIMIT ten", "invalid LIMIT"},
+		{"SELECT * FROM people WHERE Age LIKE 3", "unsupported operator"},
+		{"SELECT * FROM people WHERE Age ~ 3", "unexpected character"},
+		{"SELECT * FROM people WHERE Age = abc", "invalid value"},
+		{"SELECT * FROM people WHERE Name = 'open", "unterminated string"},
+		{"SELECT * FROM people ORDER BY Name", "unexpected \"ORDER\""},
+		{"INSERT INTO people (_key, Name) VALUES (1)", "2 columns but 1 values"},
+		{"INSERT INTO people _key VALUES (1)", "expected ("},
+		{"UPDATE people SET Age 3", "expected ="},
+	}
+	for _, tt := range tests {
+		if _, err := parse(tt.query); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("parse(%q) = %v, want an error containing %q", tt.query, err, tt.err)
+		}
+	}
+}
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	catalog.Register[int, person]("people", keys.Ordered[int])
+	db, err := sql.Open(DriverName, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func affected(t *testing.T, res sql.Result, err error) int64 {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func names(t *testing.T, db *sql.DB, query string, args ...any) []string {
+	t.Helper()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var key int
+		var name string
+		if err := rows.Scan(&key, &name); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestDriverStatements(t *testing.T) {
+	db := openDB(t)
+	for i, name := range []string{"ada", "bob", "cy", "di", "ed"} {
+		res, err := db.Exec("INSERT INTO people (_key, Name, Age) VALUES (?, ?, ?)", i+1, name, 20+10*i)
+		if n := affected(t, res, err); n != 1 {
+			t.Fatalf("INSERT affected %d rows", n)
+		}
+	}
+
+	if got := names(t, db, "SELECT _key, Name FROM people WHERE Age >= ? LIMIT 2", 30); !reflect.DeepEqual(got, []string{"bob", "cy"}) {
+		t.Fatalf("SELECT with WHERE and LIMIT = %v", got)
+	}
+	if got := names(t, db, "SELECT _key, Name FROM people WHERE Age > 20 AND Name <> 'di'"); !reflect.DeepEqual(got, []string{"bob", "cy", "ed"}) {
+		t.Fatalf("SELECT with AND = %v", got)
+	}
+	rows, err := db.Query("SELECT * FROM people LIMIT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cols, _ := rows.Columns(); !reflect.DeepEqual(cols, []string{"_key", "Name", "Age"}) {
+		t.Fatalf("SELECT * columns = %v", cols)
+	}
+	rows.Close()
+
+	res, err := db.Exec("UPDATE people SET Name = ? WHERE Age < ?", "young", 40)
+	if n := affected(t, res, err); n != 2 {
+		t.Fatalf("UPDATE affected %d rows, want 2", n)
+	}
+	res, err = db.Exec("DELETE FROM people WHERE Name = 'young'")
+	if n := affected(t, res, err); n != 2 {
+		t.Fatalf("DELETE affected %d rows, want 2", n)
+	}
+	res, err = db.Exec("DELETE FROM people WHERE Name = 'nobody'")
+	if n := affected(t, res, err); n != 0 {
+		t.Fatalf("DELETE of nothing affected %d rows", n)
+	}
+	if got := names(t, db, "SELECT _key, Name FROM people"); !reflect.DeepEqual(got, []string{"cy", "di", "ed"}) {
+		t.Fatalf("rows left = %v", got)
+	}
+}
+
+func TestDriverErrors(t *testing.T) {
+	db := openDB(t)
+	tests := []struct {
+		query string
+		args  []any
+		err   string
+	}{
+		{"SELECT * FROM nobody", nil, "nobody"},
+		{"SELECT * FROM people WHERE", nil, "unsupported operator"},
+		{"SELECT * FROM people WHERE Age = ?", nil, "expected 1 arguments, got 0"},
+		{"SELECT * FROM people WHERE Height = 3", nil, "Height"},
+	}
+	for _, tt := range tests {
+		rows, err := db.Query(tt.query, tt.args...)
+		if err == nil {
+			for rows.Next() {
+			}
+			err = rows.Err()
+			rows.Close()
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Query(%q) = %v, want an error containing %q", tt.query, err, tt.err)
+		}
+	}
+
+	if _, err := db.Exec("SELECT * FROM people"); err == nil {
+		t.Error("Exec ran a SELECT")
+	}
+	if _, err := db.Query("DELETE FROM people"); err == nil {
+		t.Error("Query ran a DELETE")
+	}
+	if _, err := db.Begin(); err == nil {
+		t.Error("Begin started a transaction")
+	}
+	res, err := db.Exec("INSERT INTO people (_key, Name) VALUES (1, 'ada')")
+	affected(t, res, err)
+	if _, err := db.Exec("INSERT INTO people (_key, Name) VALUES (1, 'again')"); err == nil {
+		t.Error("INSERT of a duplicate key succeeded")
+	}
+	if _, err := res.LastInsertId(); err == nil {
+		t.Error("LastInsertId is not supported but returned no error")
+	}
+}
@@ -0,0 +1,339 @@
+package sqlDriver
+
+import (
+	"ZeroStore/queryEngine"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type statementKind int
+
+const (
+	selectStmt statementKind = iota
+	insertStmt
+	updateStmt
+	deleteStmt
+)
+
+// placeholder stands for the n-th ? in the statement until Exec/Query binds it.
+type placeholder int
+
+type condition struct {
+	column string
+	op     string
+	value  interface{}
+}
+
+type assignment struct {
+	column string
+	value  interface{}
+}
+
+type statement struct {
+	kind    statementKind
+	table   string
+	columns []string
+	values  []interface{}
+	set     []assignment
+	where   []condition
+	limit   int
+	numArgs int
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+	args   int
+}
+
+func parse(query string) (*statement, error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	var stmt *statement
+	switch strings.ToUpper(p.next()) {
+	case "SELECT":
+		stmt, err = p.parseSelect()
+	case "INSERT":
+		stmt, err = p.parseInsert()
+	case "UPDATE":
+		stmt, err = p.parseUpdate()
+	case "DELETE":
+		stmt, err = p.parseDelete()
+	default:
+		return nil, fmt.Errorf("zerostore: unsupported statement %q", query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek() == ";" {
+		p.next()
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("zerostore: unexpected %q", p.peek())
+	}
+	stmt.numArgs = p.args
+	return stmt, nil
+}
+
+func (p *parser) parseSelect() (*statement, error) {
+	stmt := &statement{kind: selectStmt}
+	for {
+		col := p.next()
+		if col == "" {
+			return nil, fmt.Errorf("zerostore: expected column list")
+		}
+		if col != "*" {
+			stmt.columns = append(stmt.columns, col)
+		}
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	stmt.table = p.next()
+
+	if err := p.parseWhere(stmt); err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(p.peek(), "LIMIT") {
+		p.next()
+		n, err := strconv.Atoi(p.next())
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("zerostore: invalid LIMIT")
+		}
+		stmt.limit = n
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseInsert() (*statement, error) {
+	stmt := &statement{kind: insertStmt}
+	if err := p.expect("INTO"); err != nil {
+		return nil, err
+	}
+	stmt.table = p.next()
+
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		stmt.columns = append(stmt.columns, p.next())
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if err := p.expect("VALUES"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		stmt.values = append(stmt.values, v)
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if len(stmt.columns) != len(stmt.values) {
+		return nil, fmt.Errorf("zerostore: %d columns but %d values", len(stmt.columns), len(stmt.values))
+	}
+	return stmt, nil
+}
+
+func (p *parser) parseUpdate() (*statement, error) {
+	stmt := &statement{kind: updateStmt, table: p.next()}
+	if err := p.expect("SET"); err != nil {
+		return nil, err
+	}
+	for {
+		col := p.next()
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		stmt.set = append(stmt.set, assignment{column: col, value: v})
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	return stmt, p.parseWhere(stmt)
+}
+
+func (p *parser) parseDelete() (*statement, error) {
+	stmt := &statement{kind: deleteStmt}
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	stmt.table = p.next()
+	return stmt, p.parseWhere(stmt)
+}
+
+func (p *parser) parseWhere(stmt *statement) error {
+	if !strings.EqualFold(p.peek(), "WHERE") {
+		return nil
+	}
+	p.next()
+
+	for {
+		col := p.next()
+		op := p.next()
+		if op == "<>" {
+			op = "!="
+		}
+		switch op {
+		case "=", "!=", "<", "<=", ">", ">=":
+		default:
+			return fmt.Errorf("zerostore: unsupported operator %q", op)
+		}
+		v, err := p.value()
+		if err != nil {
+			return err
+		}
+		stmt.where = append(stmt.where, condition{column: col, op: op, value: v})
+
+		if !strings.EqualFold(p.peek(), "AND") {
+			return nil
+		}
+		p.next()
+	}
+}
+
+func (p *parser) value() (interface{}, error) {
+	tok := p.next()
+	switch {
+	case tok == "?":
+		p.args++
+		return placeholder(p.args - 1), nil
+	case tok == "":
+		return nil, fmt.Errorf("zerostore: expected value")
+	case tok[0] == '\'':
+		return strings.ReplaceAll(tok[1:len(tok)-1], "''", "'"), nil
+	case strings.EqualFold(tok, "NULL"):
+		return nil, nil
+	case strings.EqualFold(tok, "TRUE"), strings.EqualFold(tok, "FALSE"):
+		return strings.EqualFold(tok, "TRUE"), nil
+	}
+	if n, err := strconv.ParseInt(tok, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(tok, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("zerostore: invalid value %q", tok)
+}
+
+func (p *parser) expect(want string) error {
+	if got := p.next(); !strings.EqualFold(got, want) {
+		return fmt.Errorf("zerostore: expected %s, got %q", want, got)
+	}
+	return nil
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	if tok != "" {
+		p.pos++
+	}
+	return tok
+}
+
+func lex(s string) ([]string, error) {
+	var tokens []string
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'':
+			// '' inside a string is an escaped quote
+			j := i + 1
+			for ; j < len(runes); j++ {
+				if runes[j] == '\'' {
+					if j+1 < len(runes) && runes[j+1] == '\'' {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("zerostore: unterminated string")
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		case strings.ContainsRune("<>!", r):
+			j := i + 1
+			if j < len(runes) && (runes[j] == '=' || r == '<' && runes[j] == '>') {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case strings.ContainsRune("(),=*?;", r):
+			tokens = append(tokens, string(r))
+			i++
+		default:
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || strings.ContainsRune("_.-+", runes[j])) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("zerostore: unexpected character %q", r)
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func bind(v interface{}, args []interface{}) interface{} {
+	if p, ok := v.(placeholder); ok {
+		return args[p]
+	}
+	return v
+}
+
+func (stmt *statement) conditions(args []interface{}) []queryEngine.Condition {
+	conds := make([]queryEngine.Condition, len(stmt.where))
+	for i, c := range stmt.where {
+		conds[i] = queryEngine.Condition{Field: c.column, Op: c.op, Value: bind(c.value, args)}
+	}
+	return conds
+}
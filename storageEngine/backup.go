@@ -0,0 +1,314 @@
+package storageEngine
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrBackupInProgress = errors.New("backup in progress")
+
+type BackupManifest struct {
+	Table    string
+	Time     time.Time
+	DataSize int64
+	// OverflowSize is the length of the overflow file copied
+	OverflowSize int64 `json:",omitempty"`
+	// Seq and SeqTime identify the last mutation contained in the snapshot;
+	// restore replays logged mutations after it
+	Seq     uint64
+	SeqTime int64
+}
+
+func backupManifestPath(name string) string {
+	return name + "_backup.json"
+}
+
+func (dt *DataTable[K, V]) name() string {
+	return strings.TrimSuffix(dt.DataFile.Name(), "_data.bin")
+}
+
+// Backup writes a consistent copy of the table into dir without blocking
+// writers for the duration of the copy. The index and free list are saved
+// under the lock and a snapshot is held while the data file is copied, so
+// the rows the saved index refers to are not overwritten.
+func (dt *DataTable[K, V]) Backup(dir string) Result[BackupManifest] {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Result[BackupManifest]{Err: err}
+	}
+	name := dt.name()
+	target := filepath.Join(dir, filepath.Base(name))
+
+	dt.mu.Lock()
+	manifest, err := dt.snapshot(target)
+	if err == nil {
+		dt.backups++
+		dt.pin()
+	}
+	dt.mu.Unlock()
+	if err != nil {
+		return Result[BackupManifest]{Err: err}
+	}
+
+	err = copyFile(target+"_data.bin", io.NewSectionReader(dt.DataFile, 0, manifest.DataSize))
+	if err == nil && manifest.OverflowSize > 0 {
+		// chunks referenced at the snapshot are parked until it is released
+		err = copyFile(overflowFilePath(target), io.NewSectionReader(dt.overflow.file, 0, manifest.OverflowSize))
+	}
+	if err == nil {
+		err = copyPath(schemaFilePath(target), schemaFilePath(name))
+	}
+	if err == nil && dt.options.mutationLog {
+		// a record torn by a concurrent append is dropped when the copy is read
+		err = copyPath(target+"_wal.bin", logFilePath(name))
+	}
+
+	dt.mu.Lock()
+	dt.backups--
+	if unpinErr := dt.unpin(manifest.Seq); err == nil {
+		err = unpinErr
+	}
+	dt.mu.Unlock()
+	if err != nil {
+		return Result[BackupManifest]{Err: err}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Result[BackupManifest]{Err: err}
+	}
+	if err := os.WriteFile(backupManifestPath(target), data, 0644); err != nil {
+		return Result[BackupManifest]{Err: err}
+	}
+	return Result[BackupManifest]{Value: manifest}
+}
+
+func (dt *DataTable[K, V]) snapshot(target string) (BackupManifest, error) {
+	info, err := dt.DataFile.Stat()
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	manifest := BackupManifest{
+		Table:    filepath.Base(dt.name()),
+		Time:     time.Now(),
+		DataSize: info.Size(),
+		Seq:      dt.seq,
+		SeqTime:  dt.seqTime,
+	}
+	if dt.overflow.file != nil {
+		if info, err = dt.overflow.file.Stat(); err != nil {
+			return BackupManifest{}, err
+		}
+		manifest.OverflowSize = info.Size()
+	}
+
+	indexFile, err := os.Create(target + "_index.bin")
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	defer indexFile.Close()
+	w, finish := dt.crypt.writer(indexFile)
+	if err := dt.IndexTable.SaveTo(w); err != nil {
+		return BackupManifest{}, err
+	}
+	if err := finish(); err != nil {
+		return BackupManifest{}, err
+	}
+	if err := dt.saveExpiries(indexFile.Name()); err != nil {
+		return BackupManifest{}, err
+	}
+	if err := dt.saveBloom(indexFile.Name()); err != nil {
+		return BackupManifest{}, err
+	}
+
+	blobsFile, err := os.Create(blobsFilePath(target))
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	defer blobsFile.Close()
+	if err := dt.writeOverflowMeta(blobsFile); err != nil {
+		return BackupManifest{}, err
+	}
+
+	freeFile, err := os.Create(target + "_free.bin")
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	defer freeFile.Close()
+	if len(dt.FreeList) > 0 {
+		w, finish := dt.crypt.writer(freeFile)
+		if err := gob.NewEncoder(w).Encode(dt.FreeList); err != nil {
+			return BackupManifest{}, err
+		}
+		if err := finish(); err != nil {
+			return BackupManifest{}, err
+		}
+	}
+	return manifest, nil
+}
+
+// Restore rebuilds the table dbName from the backup written under
+// backupName and rolls it forward with logged mutations up to and including
+// until; a zero until replays everything. The longer of the backup's copy
+// of the log and dbName's own log is used, as long as it continues the
+// history the backup was taken from. It returns the number of replayed
+// mutations.
+func Restore[K comparable, V any](compare func(a, b K) int, backupName, dbName string, btreeDegree int, until time.Time, opts ...Option) Result[int] {
+	data, err := os.ReadFile(backupManifestPath(backupName))
+	if err != nil {
+		return Result[int]{Err: err}
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return Result[int]{Err: err}
+	}
+
+	var options tableOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	crypt := newCrypter(options.keys)
+
+	var records []LogRecord[K, V]
+	for _, path := range []string{logFilePath(dbName), logFilePath(backupName)} {
+		var candidate []LogRecord[K, V]
+		continues := manifest.Seq == 0
+		err := readLog(path, crypt, func(r LogRecord[K, V]) error {
+			if r.Seq == manifest.Seq && r.Time == manifest.SeqTime {
+				continues = true
+			}
+			candidate = append(candidate, r)
+			return nil
+		})
+		if err != nil {
+			return Result[int]{Err: err}
+		}
+		if continues && len(candidate) > len(records) {
+			records = candidate
+		}
+	}
+
+	for _, suffix := range []string{"_data.bin", "_index.bin", "_free.bin", "_schema.json", "_overflow.bin", "_blobs.bin", "_bloom.bin", "_ttl.bin"} {
+		if err := copyPath(dbName+suffix, backupName+suffix); err != nil {
+			return Result[int]{Err: err}
+		}
+	}
+
+	// the table is opened without its log so replayed mutations are not
+	// logged twice; the log is rewritten below to match what was applied
+	withoutLog := func(o *tableOptions) { o.mutationLog = false }
+	dt, err := NewDataTable[K, V](compare, dbName, btreeDegree, append(opts, withoutLog)...)
+	if err != nil {
+		return Result[int]{Err: err}
+	}
+	defer dt.Close()
+	if info, err := os.Stat(dt.IndexFile.Name()); err != nil {
+		return Result[int]{Err: err}
+	} else if info.Size() > 0 {
+		if res := dt.LoadIndex(dt.IndexFile.Name()); res.Err != nil {
+			return Result[int]{Err: res.Err}
+		}
+	}
+
+	replayed := 0
+	kept := len(records)
+	for i, r := range records {
+		if r.Seq <= manifest.Seq {
+			continue
+		}
+		if !until.IsZero() && r.Time > until.UnixNano() {
+			kept = i
+			break
+		}
+		if err := dt.replay(r); err != nil {
+			return Result[int]{Err: err}
+		}
+		replayed++
+	}
+	if res := dt.SaveIndex(); res.Err != nil {
+		return Result[int]{Err: res.Err}
+	}
+
+	if err := os.Remove(logFilePath(dbName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Result[int]{Err: err}
+	}
+	if options.mutationLog {
+		if err := writeLog(logFilePath(dbName), records[:kept], crypt); err != nil {
+			return Result[int]{Err: err}
+		}
+	}
+	return Result[int]{Value: replayed}
+}
+
+func (dt *DataTable[K, V]) replay(r LogRecord[K, V]) error {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	switch r.Op {
+	case OpInsert:
+		row := newRow(r.Key, r.Data)
+		row.ExpiresAt = r.ExpiresAt
+		return dt.insertRow(row).Err
+	case OpUpdate:
+		res := dt.delete(r.Key)
+		if res.Err != nil {
+			return res.Err
+		}
+		return dt.replace(res.Value, r.Data).Err
+	case OpDelete:
+		return dt.delete(r.Key).Err
+	}
+	return nil
+}
+
+func writeLog[K comparable, V any](path string, records []LogRecord[K, V], crypt *crypter) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for _, r := range records {
+		frame, err := encodeLogRecord(r, crypt)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(frame); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
+
+func copyPath(dst, src string) error {
+	in, err := os.Open(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return copyFile(dst, strings.NewReader(""))
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return copyFile(dst, in)
+}
+
+func copyFile(dst string, src io.Reader) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,199 @@
+package storageEngine
+
+import (
+	"ZeroStore/keys"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// WithBloomFilter keeps a Bloom filter over the table's primary keys, and
+// one over the values of each secondary index, sized for falsePositiveRate.
+// Lookups of keys or values the filter has never seen return without
+// touching the index. The key filter is saved next to the index and rebuilt
+// by Compact, since deleted keys cannot be taken out of it.
+func WithBloomFilter(falsePositiveRate float64) Option {
+	return func(o *tableOptions) {
+		o.bloomRate = falsePositiveRate
+	}
+}
+
+// minBloomCapacity is the number of entries a new filter is sized for; a
+// filter that fills up is rebuilt at twice the size.
+const minBloomCapacity = 1024
+
+type bloomFilter struct {
+	Bits     []uint64
+	Hashes   uint32
+	Capacity int
+	Count    int
+	// Keys is the number of keys in the index the filter was saved with
+	Keys int
+}
+
+func newBloomFilter(capacity int, rate float64) *bloomFilter {
+	capacity = max(capacity, minBloomCapacity)
+	bits := math.Ceil(-float64(capacity) * math.Log(rate) / (math.Ln2 * math.Ln2))
+	hashes := max(1, int(math.Round(bits/float64(capacity)*math.Ln2)))
+	return &bloomFilter{
+		Bits:     make([]uint64, (int(bits)+63)/64),
+		Hashes:   uint32(hashes),
+		Capacity: capacity,
+	}
+}
+
+// bloomHash derives the two hashes the filter's probes are built from. It
+// must be stable across runs, since filters are saved.
+func bloomHash(v any) (uint64, uint64) {
+	// -0 equals 0 but encodes differently
+	switch f := v.(type) {
+	case float64:
+		if f == 0 {
+			v = float64(0)
+		}
+	case float32:
+		if f == 0 {
+			v = float32(0)
+		}
+	}
+	b, err := keys.Encode(v)
+	if err != nil {
+		b = keys.Key(fmt.Sprintf("%T:%#v", v, v))
+	}
+	h := fnv.New64a()
+	h.Write([]byte(b))
+	h1 := h.Sum64()
+	h.Write([]byte{0})
+	return h1, h.Sum64() | 1
+}
+
+// add records v and reports whether the filter is now over capacity.
+func (f *bloomFilter) add(v any) bool {
+	h1, h2 := bloomHash(v)
+	m := uint64(len(f.Bits)) * 64
+	for i := uint64(0); i < uint64(f.Hashes); i++ {
+		bit := (h1 + i*h2) % m
+		f.Bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.Count++
+	return f.Count > f.Capacity
+}
+
+func (f *bloomFilter) mayContain(v any) bool {
+	if f == nil {
+		return true
+	}
+	h1, h2 := bloomHash(v)
+	m := uint64(len(f.Bits)) * 64
+	for i := uint64(0); i < uint64(f.Hashes); i++ {
+		bit := (h1 + i*h2) % m
+		if f.Bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func bloomFilePath(indexPath string) string {
+	return strings.TrimSuffix(indexPath, "_index.bin") + "_bloom.bin"
+}
+
+// keyMayExist reports whether primaryKey can be in the table.
+func (dt *DataTable[K, V]) keyMayExist(primaryKey K) bool {
+	if dt.bloom.mayContain(primaryKey) {
+		return true
+	}
+	atomic.AddUint64(&dt.bloomRejects, 1)
+	return false
+}
+
+func (dt *DataTable[K, V]) bloomAdd(primaryKey K) {
+	if dt.bloom != nil && dt.bloom.add(primaryKey) {
+		dt.rebuildBloom(2 * dt.bloom.Capacity)
+	}
+}
+
+// rebuildBloom replaces the key filter with one built from the index.
+func (dt *DataTable[K, V]) rebuildBloom(capacity int) {
+	if dt.options.bloomRate <= 0 {
+		return
+	}
+	f := newBloomFilter(max(capacity, dt.IndexTable.Len()), dt.options.bloomRate)
+	for _, item := range dt.IndexTable.GetAll() {
+		f.add(item.Key)
+	}
+	dt.bloom = f
+}
+
+// saveBloom writes the key filter next to the index at indexPath.
+func (dt *DataTable[K, V]) saveBloom(indexPath string) error {
+	if dt.bloom == nil {
+		return nil
+	}
+	f, err := os.Create(bloomFilePath(indexPath))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dt.bloom.Keys = dt.IndexTable.Len()
+	w, finish := dt.crypt.writer(f)
+	if err := gob.NewEncoder(w).Encode(dt.bloom); err != nil {
+		return err
+	}
+	return finish()
+}
+
+// loadBloom reads the key filter saved with the index at indexPath, or
+// rebuilds it when there is none or it does not match the index.
+func (dt *DataTable[K, V]) loadBloom(indexPath string) error {
+	if dt.options.bloomRate <= 0 {
+		return nil
+	}
+	f, err := os.Open(bloomFilePath(indexPath))
+	if errors.Is(err, os.ErrNotExist) {
+		dt.rebuildBloom(0)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || info.Size() == 0 {
+		dt.rebuildBloom(0)
+		return err
+	}
+
+	r, err := dt.crypt.reader(f)
+	if err != nil {
+		return err
+	}
+	var saved bloomFilter
+	if err := gob.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+	if saved.Keys != dt.IndexTable.Len() || len(saved.Bits) == 0 {
+		dt.rebuildBloom(0)
+		return nil
+	}
+	dt.bloom = &saved
+	return nil
+}
+
+// filterAdd records value in a secondary index's filter, growing it from
+// the index when it fills up.
+func (idx *secondaryIndex[K, V]) filterAdd(value any) {
+	if idx.filter == nil || !idx.filter.add(value) {
+		return
+	}
+	f := newBloomFilter(2*idx.filter.Capacity, idx.rate)
+	for v := range idx.keys {
+		f.add(v)
+	}
+	idx.filter = f
+}
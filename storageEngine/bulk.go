@@ -0,0 +1,301 @@
+package storageEngine
+
+import (
+	"ZeroStore/datastructure/btree"
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+var ErrTableNotEmpty = errors.New("table is not empty")
+
+// rowEncoder produces the same bytes as encoding each row with a fresh
+// gob.Encoder, which UnserializeData needs because every record is decoded
+// on its own. The type descriptors at the start of a fresh stream are
+// identical for every row, so they are captured once and prepended instead
+// of being rebuilt per row.
+type rowEncoder[K comparable, V any] struct {
+	buf    bytes.Buffer
+	enc    *gob.Encoder
+	prefix []byte
+	// values holding interfaces can send new type descriptors mid-stream,
+	// so they fall back to a fresh encoder per row
+	fresh bool
+}
+
+func newRowEncoder[K comparable, V any]() *rowEncoder[K, V] {
+	e := &rowEncoder[K, V]{fresh: hasInterface(reflect.TypeOf(DataRow[K, V]{}), map[reflect.Type]bool{})}
+	e.enc = gob.NewEncoder(&e.buf)
+	return e
+}
+
+func (e *rowEncoder[K, V]) encode(row DataRow[K, V]) ([]byte, error) {
+	e.buf.Reset()
+	if e.fresh {
+		if err := gob.NewEncoder(&e.buf).Encode(row); err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), e.buf.Bytes()...), nil
+	}
+
+	if err := e.enc.Encode(row); err != nil {
+		return nil, err
+	}
+
+	if e.prefix == nil {
+		full := append([]byte(nil), e.buf.Bytes()...)
+		e.buf.Reset()
+		if err := e.enc.Encode(row); err != nil {
+			return nil, err
+		}
+		e.prefix = full[:len(full)-e.buf.Len()]
+		return full, nil
+	}
+
+	record := make([]byte, 0, len(e.prefix)+e.buf.Len())
+	record = append(record, e.prefix...)
+	return append(record, e.buf.Bytes()...), nil
+}
+
+func hasInterface(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return hasInterface(t.Elem(), seen)
+	case reflect.Map:
+		return hasInterface(t.Key(), seen) || hasInterface(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasInterface(t.Field(i).Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allocate takes the smallest free slot that fits size, or returns -1 when
+// the row has to be appended. FreeList is kept sorted by size.
+func (dt *DataTable[K, V]) allocate(size int64) int {
+	i := sort.Search(len(dt.FreeList), func(i int) bool {
+		return dt.FreeList[i].Size >= size
+	})
+	if i == len(dt.FreeList) {
+		return -1
+	}
+
+	f := dt.FreeList[i]
+	dt.FreeList = append(dt.FreeList[:i], dt.FreeList[i+1:]...)
+	if rest := f.Size - size; rest > 0 {
+		dt.addFree(FreeNode{Offset: f.Offset + size, Size: rest})
+	}
+	return int(f.Offset)
+}
+
+func (dt *DataTable[K, V]) addFree(node FreeNode) {
+	i := sort.Search(len(dt.FreeList), func(i int) bool {
+		return dt.FreeList[i].Size >= node.Size
+	})
+	dt.FreeList = append(dt.FreeList, FreeNode{})
+	copy(dt.FreeList[i+1:], dt.FreeList[i:])
+	dt.FreeList[i] = node
+}
+
+// BulkLoad fills an empty table from rows sorted by key. Rows are appended
+// through one buffered writer, the index is built bottom-up and saved once.
+// If the load fails, rows is drained and what was written is dropped.
+func (dt *DataTable[K, V]) BulkLoad(rows <-chan btree.KVPair[K, V]) Result[int] {
+	// a failed load drains rows once the lock is released, so the sender
+	// is not left blocked
+	loaded := false
+	defer func() {
+		if !loaded {
+			for range rows {
+			}
+		}
+	}()
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if dt.IndexTable.Len() > 0 {
+		return Result[int]{Err: ErrTableNotEmpty}
+	}
+
+	start, err := dt.DataFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return Result[int]{Err: err}
+	}
+	var chains []uint64
+	defer func() {
+		if !loaded {
+			dt.dropBulkLoad(start, chains)
+		}
+	}()
+
+	offset := start
+	w := bufio.NewWriterSize(dt.DataFile, 1<<20)
+	enc := newRowEncoder[K, V]()
+	var index []btree.KVPair[K, int]
+	var logged []btree.KVPair[K, V]
+	keep := dt.logFile != nil || len(dt.hooks.afterInsert) > 0 || len(dt.indexes) > 0
+	unique := map[string]map[any]bool{}
+
+	for row := range rows {
+		if n := len(index); n > 0 && dt.Compare(index[n-1].Key, row.Key) >= 0 {
+			return Result[int]{Err: fmt.Errorf("bulk load input not strictly sorted at key %v", row.Key)}
+		}
+		if row.Value, err = dt.beforeInsert(row.Key, row.Value); err != nil {
+			return Result[int]{Err: err}
+		}
+		if err := dt.checkBatchUnique(unique, row.Value); err != nil {
+			return Result[int]{Err: err}
+		}
+
+		record, err := enc.encode(dt.newRow(row.Key, row.Value))
+		if err != nil {
+			return Result[int]{Err: err}
+		}
+		if record, err = dt.pack(record); err != nil {
+			return Result[int]{Err: err}
+		}
+		if record[0] == frameOverflow {
+			_, first, _ := readPointer(plainReader(record))
+			chains = append(chains, first)
+		}
+		if _, err := w.Write(record); err != nil {
+			return Result[int]{Err: err}
+		}
+		index = append(index, btree.KVPair[K, int]{Key: row.Key, Value: int(offset)})
+		if keep {
+			logged = append(logged, row)
+		}
+		offset += int64(len(record))
+	}
+
+	if err := w.Flush(); err != nil {
+		return Result[int]{Err: err}
+	}
+	loaded = true
+
+	for i, row := range index {
+		dt.track(row.Key, -1, dt.seq+uint64(i)+1)
+	}
+	dt.IndexTable.BulkLoad(index)
+	dt.rebuildBloom(0)
+	for _, row := range logged {
+		dt.indexAdd(row.Key, row.Value)
+	}
+	if res := dt.saveIndex(); res.Err != nil {
+		return Result[int]{Err: res.Err}
+	}
+	err = dt.commitInserts(logged)
+	for _, row := range logged {
+		dt.afterInsert(row.Key, row.Value)
+	}
+	return Result[int]{Value: len(index), Err: err}
+}
+
+// dropBulkLoad undoes the writes of a failed BulkLoad that started at the
+// end of the data file, start, and moved rows into the overflow chains.
+func (dt *DataTable[K, V]) dropBulkLoad(start int64, chains []uint64) {
+	for _, first := range chains {
+		dt.releaseChain(first)
+	}
+	if len(chains) > 0 {
+		dt.saveOverflow()
+	}
+	dt.DataFile.Truncate(start)
+}
+
+// BatchInsert inserts unsorted rows under one lock, placing them with a
+// single pass over the free list and appending the rest in one write.
+func (dt *DataTable[K, V]) BatchInsert(rows []btree.KVPair[K, V]) Result[any] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	seen := make(map[K]bool, len(rows))
+	unique := map[string]map[any]bool{}
+	rows = append([]btree.KVPair[K, V](nil), rows...)
+	for i, row := range rows {
+		if err := dt.expireKey(row.Key); err != nil {
+			return Result[any]{Err: err}
+		}
+		if _, found := dt.IndexTable.Search(row.Key); found || seen[row.Key] {
+			return Result[any]{Err: fmt.Errorf("%w: %v", ErrKeyExists, row.Key)}
+		}
+		seen[row.Key] = true
+
+		var err error
+		if rows[i].Value, err = dt.beforeInsert(row.Key, row.Value); err != nil {
+			return Result[any]{Err: err}
+		}
+		if err := dt.checkBatchUnique(unique, rows[i].Value); err != nil {
+			return Result[any]{Err: err}
+		}
+	}
+
+	enc := newRowEncoder[K, V]()
+	offsets := make([]int, len(rows))
+	var tail bytes.Buffer
+
+	info, err := dt.DataFile.Stat()
+	if err != nil {
+		return Result[any]{Err: err}
+	}
+	end := info.Size()
+
+	freeChanged := false
+	for i, row := range rows {
+		record, err := enc.encode(dt.newRow(row.Key, row.Value))
+		if err != nil {
+			return Result[any]{Err: err}
+		}
+		if record, err = dt.pack(record); err != nil {
+			return Result[any]{Err: err}
+		}
+
+		if offsets[i] = dt.allocate(int64(len(record))); offsets[i] >= 0 {
+			freeChanged = true
+			if _, err := dt.DataFile.WriteAt(record, int64(offsets[i])); err != nil {
+				return Result[any]{Err: err}
+			}
+			continue
+		}
+		offsets[i] = int(end) + tail.Len()
+		tail.Write(record)
+	}
+
+	if tail.Len() > 0 {
+		if _, err := dt.DataFile.WriteAt(tail.Bytes(), end); err != nil {
+			return Result[any]{Err: err}
+		}
+	}
+	if freeChanged {
+		if err := dt.saveFreeList(); err != nil {
+			return Result[any]{Err: err}
+		}
+	}
+
+	for i, row := range rows {
+		dt.trackInsert(row.Key, dt.seq+uint64(i)+1)
+		dt.IndexTable.Insert(row.Key, offsets[i])
+		dt.indexAdd(row.Key, row.Value)
+		dt.bloomAdd(row.Key)
+	}
+	err = dt.commitInserts(rows)
+	for _, row := range rows {
+		dt.afterInsert(row.Key, row.Value)
+	}
+	return Result[any]{Err: err}
+}
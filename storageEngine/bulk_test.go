@@ -0,0 +1,59 @@
+package storageEngine
+
+import (
+	"ZeroStore/datastructure/btree"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func sendRows(keys ...int) <-chan btree.KVPair[int, logRow] {
+	rows := make(chan btree.KVPair[int, logRow])
+	go func() {
+		defer close(rows)
+		for _, key := range keys {
+			rows <- btree.KVPair[int, logRow]{Key: key, Value: logRow{strings.Repeat("x", key)}}
+		}
+	}()
+	return rows
+}
+
+func TestFailedBulkLoadLeavesNothing(t *testing.T) {
+	dt := newRowTable(t, WithOverflowThreshold(256))
+	snap := dt.Snapshot()
+	defer snap.Release()
+	info, err := dt.DataFile.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// key 3 is out of order; the rows after it must still be drained
+	res := dt.BulkLoad(sendRows(1, 500, 1000, 3, 2000, 3000))
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "not strictly sorted") {
+		t.Fatalf("BulkLoad of unsorted rows = %+v", res)
+	}
+	if n := dt.Len(); n != 0 {
+		t.Fatalf("Len after a failed load = %d", n)
+	}
+	if after, err := dt.DataFile.Stat(); err != nil || after.Size() != info.Size() {
+		t.Fatalf("data file grew from %d to %d bytes", info.Size(), after.Size())
+	}
+	if len(dt.versions) != 0 {
+		t.Fatalf("failed load left versions %v", dt.versions)
+	}
+	if len(dt.overflow.parked) != 2 {
+		t.Fatalf("%d overflow chains parked, want the 2 written", len(dt.overflow.parked))
+	}
+	if res := snap.Release(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	if res := dt.BulkLoad(sendRows(1, 500, 1000)); res.Err != nil || res.Value != 3 {
+		t.Fatalf("BulkLoad after the failure = %+v", res)
+	}
+	wantRow(t, dt, 1, "x")
+	wantRow(t, dt, 1000, strings.Repeat("x", 1000))
+	if res := dt.BulkLoad(sendRows(5000)); !errors.Is(res.Err, ErrTableNotEmpty) {
+		t.Fatalf("BulkLoad into a full table = %v", res.Err)
+	}
+}
@@ -0,0 +1,119 @@
+package storageEngine
+
+import (
+	"container/list"
+	"sync"
+)
+
+// WithRowCache keeps up to capacity bytes of recently read rows in memory,
+// so lookups of hot keys skip the disk and the decode. A row's size is that
+// of its encoding. Rows handed out from the cache share slices and maps with
+// it and must not be modified in place.
+func WithRowCache(capacity int64) Option {
+	return func(o *tableOptions) {
+		o.cacheBytes = capacity
+	}
+}
+
+// rowCache is an LRU of decoded rows keyed by primary key, bounded by the
+// total size of their encodings. Lookups run under the table's read lock,
+// so it has a lock of its own.
+type rowCache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int64
+	used     int64
+	order    *list.List
+	items    map[K]*list.Element
+
+	hits, misses, evictions uint64
+}
+
+type cacheEntry[K comparable, V any] struct {
+	row  DataRow[K, V]
+	cost int64
+}
+
+func newRowCache[K comparable, V any](capacity int64) *rowCache[K, V] {
+	if capacity <= 0 {
+		return nil
+	}
+	return &rowCache[K, V]{capacity: capacity, order: list.New(), items: make(map[K]*list.Element)}
+}
+
+func (c *rowCache[K, V]) get(key K) (DataRow[K, V], bool) {
+	if c == nil {
+		return DataRow[K, V]{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return DataRow[K, V]{}, false
+	}
+	c.hits++
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry[K, V]).row, true
+}
+
+func (c *rowCache[K, V]) put(row DataRow[K, V], cost int64) {
+	if c == nil || cost > c.capacity {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[row.PrimaryKey]; ok {
+		c.used -= e.Value.(*cacheEntry[K, V]).cost
+		c.order.Remove(e)
+	}
+	c.items[row.PrimaryKey] = c.order.PushFront(&cacheEntry[K, V]{row: row, cost: cost})
+	c.used += cost
+	for c.used > c.capacity {
+		oldest := c.order.Back()
+		entry := c.order.Remove(oldest).(*cacheEntry[K, V])
+		delete(c.items, entry.row.PrimaryKey)
+		c.used -= entry.cost
+		c.evictions++
+	}
+}
+
+func (c *rowCache[K, V]) remove(key K) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.used -= e.Value.(*cacheEntry[K, V]).cost
+		c.order.Remove(e)
+		delete(c.items, key)
+	}
+}
+
+func (c *rowCache[K, V]) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.items = make(map[K]*list.Element)
+	c.used = 0
+}
+
+func (c *rowCache[K, V]) fill(stats *TableStats) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats.CacheHits = c.hits
+	stats.CacheMisses = c.misses
+	stats.CacheEvictions = c.evictions
+	stats.CacheBytes = c.used
+}
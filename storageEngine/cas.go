@@ -0,0 +1,89 @@
+package storageEngine
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrVersionConflict = errors.New("version conflict")
+
+// ConflictError reports that a row changed since the caller read it.
+// errors.Is(err, ErrVersionConflict) matches it.
+type ConflictError struct {
+	Key      any
+	Expected uint64
+	Actual   uint64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("version conflict on key %v: expected version %d, found %d", e.Key, e.Expected, e.Actual)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// CompareAndSwap replaces the row only if it is still at expectedVersion
+// and returns the new version.
+func (dt *DataTable[K, V]) CompareAndSwap(primaryKey K, expectedVersion uint64, data V) Result[uint64] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if err := dt.expireKey(primaryKey); err != nil {
+		return Result[uint64]{Err: err}
+	}
+	if err := dt.checkVersion(primaryKey, expectedVersion); err != nil {
+		return Result[uint64]{Err: err}
+	}
+	data, err := dt.beforeUpdate(primaryKey, data)
+	if err != nil {
+		return Result[uint64]{Err: err}
+	}
+
+	deleteResult := dt.delete(primaryKey)
+	if deleteResult.Err != nil {
+		return Result[uint64]{Err: deleteResult.Err}
+	}
+
+	version := deleteResult.Value.Version + 1
+	if res := dt.replace(deleteResult.Value, data); res.Err != nil {
+		return Result[uint64]{Err: res.Err}
+	}
+
+	return Result[uint64]{Value: version, Err: dt.commit(OpUpdate, primaryKey, deleteResult.Value.Data, data)}
+}
+
+// CompareAndDelete deletes the row only if it is still at expectedVersion.
+func (dt *DataTable[K, V]) CompareAndDelete(primaryKey K, expectedVersion uint64) Result[DataRow[K, V]] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if err := dt.expireKey(primaryKey); err != nil {
+		return Result[DataRow[K, V]]{Err: err}
+	}
+	if err := dt.checkVersion(primaryKey, expectedVersion); err != nil {
+		return Result[DataRow[K, V]]{Err: err}
+	}
+	if err := dt.beforeDelete(primaryKey); err != nil {
+		return Result[DataRow[K, V]]{Err: err}
+	}
+
+	res := dt.delete(primaryKey)
+	if res.Err != nil {
+		return res
+	}
+	var zero V
+	res.Err = dt.commit(OpDelete, primaryKey, res.Value.Data, zero)
+	return res
+}
+
+func (dt *DataTable[K, V]) checkVersion(primaryKey K, expectedVersion uint64) error {
+	res := dt.search(primaryKey)
+	if res.Err != nil {
+		return res.Err
+	}
+	if res.Value.Version != expectedVersion {
+		return &ConflictError{Key: primaryKey, Expected: expectedVersion, Actual: res.Value.Version}
+	}
+	return nil
+}
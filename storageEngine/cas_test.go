@@ -0,0 +1,51 @@
+package storageEngine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompareAndSwapRejectsStaleVersion(t *testing.T) {
+	dt := newRowTable(t)
+	if res := dt.Insert(1, logRow{"v1"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if v := dt.Search(1).Value.Version; v != 1 {
+		t.Fatalf("inserted row is at version %d, want 1", v)
+	}
+
+	res := dt.CompareAndSwap(1, 1, logRow{"v2"})
+	if res.Err != nil || res.Value != 2 {
+		t.Fatalf("CompareAndSwap at the current version = %+v", res)
+	}
+	wantRow(t, dt, 1, "v2")
+
+	// a writer still holding version 1 lost the race
+	res = dt.CompareAndSwap(1, 1, logRow{"stale"})
+	var conflict *ConflictError
+	if !errors.Is(res.Err, ErrVersionConflict) || !errors.As(res.Err, &conflict) {
+		t.Fatalf("CompareAndSwap at an old version = %v, want a version conflict", res.Err)
+	}
+	if conflict.Key != 1 || conflict.Expected != 1 || conflict.Actual != 2 {
+		t.Fatalf("conflict = %+v", conflict)
+	}
+	wantRow(t, dt, 1, "v2")
+
+	// plain updates move the version too
+	if res := dt.UpdateWithData(1, logRow{"v3"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res := dt.CompareAndDelete(1, 2); !errors.Is(res.Err, ErrVersionConflict) {
+		t.Fatalf("CompareAndDelete at an old version = %v, want a version conflict", res.Err)
+	}
+	wantRow(t, dt, 1, "v3")
+	if res := dt.CompareAndDelete(1, 3); res.Err != nil || res.Value.Data.Name != "v3" {
+		t.Fatalf("CompareAndDelete at the current version = %+v", res)
+	}
+	if res := dt.Search(1); !errors.Is(res.Err, ErrKeyNotFound) {
+		t.Fatalf("row survived CompareAndDelete: %+v", res)
+	}
+	if res := dt.CompareAndSwap(1, 3, logRow{"gone"}); !errors.Is(res.Err, ErrKeyNotFound) {
+		t.Fatalf("CompareAndSwap of a missing key = %v, want ErrKeyNotFound", res.Err)
+	}
+}
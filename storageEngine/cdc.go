@@ -0,0 +1,164 @@
+package storageEngine
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrHistoryUnavailable = errors.New("change history not available")
+
+// ChangeEvent describes one committed mutation. Old is the zero value for
+// inserts and New is the zero value for deletes.
+type ChangeEvent[K comparable, V any] struct {
+	Seq  uint64
+	Time time.Time
+	Op   LogOp
+	Key  K
+	Old  V
+	New  V
+}
+
+// Subscription delivers change events in commit order. Events are queued
+// without limit so a slow reader never blocks writers.
+type Subscription[K comparable, V any] struct {
+	dt      *DataTable[K, V]
+	events  chan ChangeEvent[K, V]
+	mu      sync.Mutex
+	pending []ChangeEvent[K, V]
+	wake    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Subscribe streams every mutation committed after fromSeq. Passing the
+// Seq of the last event a consumer processed resumes where it stopped;
+// events older than the subscription are read back from the mutation log,
+// so resuming across restarts needs WithMutationLog.
+func (dt *DataTable[K, V]) Subscribe(fromSeq uint64) Result[*Subscription[K, V]] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if fromSeq > dt.seq {
+		return Result[*Subscription[K, V]]{Err: fmt.Errorf("%w: sequence %d is ahead of the table at %d", ErrHistoryUnavailable, fromSeq, dt.seq)}
+	}
+	if fromSeq < dt.seq && dt.logFile == nil {
+		return Result[*Subscription[K, V]]{Err: fmt.Errorf("%w: table has no mutation log", ErrHistoryUnavailable)}
+	}
+
+	s := &Subscription[K, V]{
+		dt:     dt,
+		events: make(chan ChangeEvent[K, V]),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	dt.subscribers = append(dt.subscribers, s)
+
+	var logPath string
+	if fromSeq < dt.seq {
+		logPath = dt.logFile.Name()
+	}
+	go s.run(logPath, dt.crypt, fromSeq, dt.seq)
+	return Result[*Subscription[K, V]]{Value: s}
+}
+
+func (s *Subscription[K, V]) Events() <-chan ChangeEvent[K, V] {
+	return s.events
+}
+
+// Close stops the subscription and closes its channel.
+func (s *Subscription[K, V]) Close() {
+	s.dt.mu.Lock()
+	for i, sub := range s.dt.subscribers {
+		if sub == s {
+			s.dt.subscribers = append(s.dt.subscribers[:i], s.dt.subscribers[i+1:]...)
+			break
+		}
+	}
+	s.dt.mu.Unlock()
+	s.stop()
+}
+
+func (s *Subscription[K, V]) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *Subscription[K, V]) push(event ChangeEvent[K, V]) {
+	s.mu.Lock()
+	s.pending = append(s.pending, event)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+var errStopReplay = errors.New("stop replay")
+
+// run replays logged events in (fromSeq, upto] and then forwards live
+// events, which all have a higher sequence number.
+func (s *Subscription[K, V]) run(logPath string, crypt *crypter, fromSeq, upto uint64) {
+	defer close(s.events)
+
+	if logPath != "" {
+		err := readLog(logPath, crypt, func(r LogRecord[K, V]) error {
+			if r.Seq <= fromSeq {
+				return nil
+			}
+			if r.Seq > upto {
+				return errStopReplay
+			}
+			if !s.send(recordEvent(r)) {
+				return errStopReplay
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopReplay) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+
+		s.mu.Lock()
+		batch := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+
+		for _, event := range batch {
+			if !s.send(event) {
+				return
+			}
+		}
+	}
+}
+
+func (s *Subscription[K, V]) send(event ChangeEvent[K, V]) bool {
+	select {
+	case s.events <- event:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func recordEvent[K comparable, V any](r LogRecord[K, V]) ChangeEvent[K, V] {
+	return ChangeEvent[K, V]{Seq: r.Seq, Time: time.Unix(0, r.Time), Op: r.Op, Key: r.Key, Old: r.Old, New: r.Data}
+}
+
+func (dt *DataTable[K, V]) publish(record LogRecord[K, V]) {
+	if len(dt.subscribers) == 0 {
+		return
+	}
+	event := recordEvent(record)
+	for _, s := range dt.subscribers {
+		s.push(event)
+	}
+}
@@ -0,0 +1,130 @@
+package storageEngine
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, sub *Subscription[int, logRow]) ChangeEvent[int, logRow] {
+	t.Helper()
+	select {
+	case event, ok := <-sub.Events():
+		if !ok {
+			t.Fatal("events channel closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event within 5s")
+	}
+	return ChangeEvent[int, logRow]{}
+}
+
+func subscribe(t *testing.T, dt *DataTable[int, logRow], from uint64) *Subscription[int, logRow] {
+	t.Helper()
+	res := dt.Subscribe(from)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	t.Cleanup(res.Value.Close)
+	return res.Value
+}
+
+func TestSubscribeDeliversChangesInOrder(t *testing.T) {
+	dt := newRowTable(t)
+	first, second := subscribe(t, dt, 0), subscribe(t, dt, 0)
+
+	dt.Insert(1, logRow{"a"})
+	dt.Upsert(1, logRow{"b"})
+	dt.Insert(2, logRow{"c"})
+	dt.Delete(1)
+	want := []ChangeEvent[int, logRow]{
+		{Seq: 1, Op: OpInsert, Key: 1, New: logRow{"a"}},
+		{Seq: 2, Op: OpUpdate, Key: 1, Old: logRow{"a"}, New: logRow{"b"}},
+		{Seq: 3, Op: OpInsert, Key: 2, New: logRow{"c"}},
+		{Seq: 4, Op: OpDelete, Key: 1, Old: logRow{"b"}},
+	}
+	for _, sub := range []*Subscription[int, logRow]{first, second} {
+		for _, w := range want {
+			got := nextEvent(t, sub)
+			got.Time = time.Time{}
+			if got != w {
+				t.Fatalf("event = %+v, want %+v", got, w)
+			}
+		}
+	}
+
+	// a reader that falls behind a burst of writes still gets every event
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for key := 100; key < 600; key++ {
+			dt.Insert(key, logRow{"burst"})
+		}
+	}()
+	for seq := uint64(5); seq < 505; seq++ {
+		if event := nextEvent(t, first); event.Seq != seq || event.Key != int(seq)+95 {
+			t.Fatalf("event %+v, want seq %d", event, seq)
+		}
+	}
+	<-done
+}
+
+func TestUnsubscribe(t *testing.T) {
+	dt := newRowTable(t)
+	gone, kept := subscribe(t, dt, 0), subscribe(t, dt, 0)
+
+	dt.Insert(1, logRow{"a"})
+	nextEvent(t, gone)
+	gone.Close()
+	dt.Insert(2, logRow{"b"})
+
+	select {
+	case event, ok := <-gone.Events():
+		if ok {
+			t.Fatalf("closed subscription delivered %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("events channel not closed")
+	}
+	if n := len(dt.subscribers); n != 1 {
+		t.Fatalf("%d subscribers after one closed, want 1", n)
+	}
+	if event := nextEvent(t, kept); event.Key != 1 {
+		t.Fatalf("event = %+v", event)
+	}
+	if event := nextEvent(t, kept); event.Key != 2 {
+		t.Fatalf("event = %+v", event)
+	}
+	gone.Close()
+}
+
+func TestSubscribeResumesFromLog(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "logged")
+	dt := openLogged(t, name)
+	for key := 1; key <= 3; key++ {
+		dt.Insert(key, logRow{"row"})
+	}
+	dt.SaveIndex()
+	dt.Close()
+
+	dt = openLogged(t, name)
+	defer dt.Close()
+	if res := dt.Subscribe(4); !errors.Is(res.Err, ErrHistoryUnavailable) {
+		t.Fatalf("Subscribe ahead of the table = %v, want ErrHistoryUnavailable", res.Err)
+	}
+	sub := subscribe(t, dt, 1)
+	dt.Insert(4, logRow{"live"})
+	for seq := uint64(2); seq <= 4; seq++ {
+		if event := nextEvent(t, sub); event.Seq != seq || event.Key != int(seq) {
+			t.Fatalf("event = %+v, want seq %d", event, seq)
+		}
+	}
+
+	plain := newRowTable(t)
+	plain.Insert(1, logRow{"row"})
+	if res := plain.Subscribe(0); !errors.Is(res.Err, ErrHistoryUnavailable) {
+		t.Fatalf("replaying without a log = %v, want ErrHistoryUnavailable", res.Err)
+	}
+}
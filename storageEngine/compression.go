@@ -0,0 +1,300 @@
+package storageEngine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects how rows are compressed on disk.
+type Compression int
+
+const (
+	CompressNone Compression = iota
+	// CompressS2 is a Snappy-style LZ codec: fast, with a modest ratio.
+	CompressS2
+	// CompressZstd writes standard zstd frames: slower, with a better ratio.
+	CompressZstd
+)
+
+// DefaultCompressionThreshold is the encoded size below which rows are
+// stored raw; small rows rarely shrink enough to pay for the frame.
+const DefaultCompressionThreshold = 256
+
+// WithCompression compresses rows whose encoding is at least threshold
+// bytes. Rows that do not shrink are stored raw, and rows written under
+// another setting stay readable, so the option can be changed on an
+// existing table.
+func WithCompression(c Compression, threshold int) Option {
+	return func(o *tableOptions) {
+		o.compression = c
+		o.compressionThreshold = threshold
+	}
+}
+
+// A gob stream starts with a byte count that is either below 0x80 or a
+// negated length byte of 0xF8 and up, so the bytes between never begin a
+// raw record. A compressed record is the marker, the uvarint length of the
+// raw record, the uvarint length of the payload, and the payload.
+const (
+	frameS2   byte = 0x80
+	frameZstd byte = 0x81
+)
+
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+		return dec
+	})
+)
+
+// CompressionStats describes how the live rows of a table are stored.
+type CompressionStats struct {
+	Rows        int
+	Compressed  int
+	RawBytes    int64
+	StoredBytes int64
+}
+
+// Ratio is the raw size of the rows over the size they take on disk.
+func (s CompressionStats) Ratio() float64 {
+	if s.StoredBytes == 0 {
+		return 1
+	}
+	return float64(s.RawBytes) / float64(s.StoredBytes)
+}
+
+// encodeRow returns the bytes a row is stored as.
+func (dt *DataTable[K, V]) encodeRow(row DataRow[K, V]) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(row); err != nil {
+		return nil, err
+	}
+	return dt.pack(buf.Bytes())
+}
+
+// encodeTombstone encodes a deleted row, which never overflows.
+func (dt *DataTable[K, V]) encodeTombstone(row DataRow[K, V]) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(row); err != nil {
+		return nil, err
+	}
+	return dt.packInline(buf.Bytes())
+}
+
+// pack turns a gob record into the bytes it is stored as.
+func (dt *DataTable[K, V]) pack(record []byte) ([]byte, error) {
+	record = dt.frame(record)
+	if t := dt.options.overflowThreshold; t > 0 && len(record) > t {
+		return dt.overflowRow(record)
+	}
+	if dt.crypt == nil {
+		return record, nil
+	}
+	return dt.crypt.sealRecord(record)
+}
+
+// packInline is pack for records that must stay in the data file.
+func (dt *DataTable[K, V]) packInline(record []byte) ([]byte, error) {
+	record = dt.frame(record)
+	if dt.crypt == nil {
+		return record, nil
+	}
+	return dt.crypt.sealRecord(record)
+}
+
+// frame compresses a gob record when the table asks for it and it pays off.
+func (dt *DataTable[K, V]) frame(record []byte) []byte {
+	if len(record) < dt.options.compressionThreshold {
+		return record
+	}
+
+	var marker byte
+	var payload []byte
+	switch dt.options.compression {
+	case CompressS2:
+		marker, payload = frameS2, s2.Encode(nil, record)
+	case CompressZstd:
+		marker, payload = frameZstd, zstdEncoder().EncodeAll(record, nil)
+	default:
+		return record
+	}
+
+	framed := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(payload))
+	framed = append(framed, marker)
+	framed = binary.AppendUvarint(framed, uint64(len(record)))
+	framed = binary.AppendUvarint(framed, uint64(len(payload)))
+	framed = append(framed, payload...)
+	if len(framed) >= len(record) {
+		return record
+	}
+	return framed
+}
+
+// decodeRecord decodes the record at offset into v and returns the number of
+// bytes it takes on disk and the size of its gob encoding.
+func (dt *DataTable[K, V]) decodeRecord(offset int, v any) (stored, raw int64, err error) {
+	reader := dt.rowReader(offset)
+	if raw, err = dt.decodeFrom(reader, v); err != nil {
+		return 0, 0, fmt.Errorf("reading row at offset %d: %w", offset, err)
+	}
+	return reader.n, raw, nil
+}
+
+func (dt *DataTable[K, V]) decodeFrom(reader *countingReader, v any) (int64, error) {
+	marker, err := reader.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	switch marker[0] {
+	case frameS2, frameZstd:
+		record, err := readFrame(reader)
+		if err != nil {
+			return 0, err
+		}
+		return int64(len(record)), gob.NewDecoder(bytes.NewReader(record)).Decode(v)
+	case frameSealed:
+		plain, err := dt.unseal(reader)
+		if err != nil {
+			return 0, err
+		}
+		return dt.decodeFrom(plainReader(plain), v)
+	case frameOverflow:
+		record, err := dt.readOverflow(reader)
+		if err != nil {
+			return 0, err
+		}
+		return dt.decodeFrom(plainReader(record), v)
+	}
+	start := reader.n
+	err = gob.NewDecoder(reader).Decode(v)
+	return reader.n - start, err
+}
+
+func (dt *DataTable[K, V]) unseal(reader *countingReader) ([]byte, error) {
+	if dt.crypt == nil {
+		return nil, ErrEncrypted
+	}
+	reader.ReadByte()
+	return dt.crypt.open(reader, nil)
+}
+
+func plainReader(b []byte) *countingReader {
+	return &countingReader{r: bufio.NewReader(bytes.NewReader(b))}
+}
+
+// readFrame reads a compressed record and returns it decompressed.
+func readFrame(r *countingReader) ([]byte, error) {
+	marker, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	rawLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	payloadLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, payloadLen)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	var record []byte
+	if marker == frameS2 {
+		record, err = s2.Decode(make([]byte, rawLen), payload)
+	} else {
+		record, err = zstdDecoder().DecodeAll(payload, make([]byte, 0, rawLen))
+	}
+	if err == nil && uint64(len(record)) != rawLen {
+		err = fmt.Errorf("decompressed %d bytes, expected %d", len(record), rawLen)
+	}
+	return record, err
+}
+
+// recordSizes returns the raw and stored size of the record at offset,
+// without decompressing it.
+func (dt *DataTable[K, V]) recordSizes(offset int) (raw, stored int64, err error) {
+	reader := dt.rowReader(offset)
+	marker, err := reader.r.Peek(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if marker[0] == frameOverflow {
+		record, err := dt.readOverflow(reader)
+		if err != nil {
+			return 0, 0, err
+		}
+		raw, err = dt.rawSize(plainReader(record))
+		return raw, reader.n + int64(len(record)), err
+	}
+	if raw, err = dt.rawSize(reader); err != nil {
+		return 0, 0, err
+	}
+	return raw, reader.n, nil
+}
+
+func (dt *DataTable[K, V]) rawSize(reader *countingReader) (int64, error) {
+	marker, err := reader.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	switch marker[0] {
+	case frameS2, frameZstd:
+		reader.ReadByte()
+		rawLen, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return 0, err
+		}
+		payloadLen, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return 0, err
+		}
+		_, err = io.CopyN(io.Discard, reader, int64(payloadLen))
+		return int64(rawLen), err
+	case frameSealed:
+		plain, err := dt.unseal(reader)
+		if err != nil {
+			return 0, err
+		}
+		return dt.rawSize(plainReader(plain))
+	}
+	var header struct{ IsValid bool }
+	err = gob.NewDecoder(reader).Decode(&header)
+	return reader.n, err
+}
+
+// CompressionStats walks the live rows and reports how much compression
+// saves on them.
+func (dt *DataTable[K, V]) CompressionStats() Result[CompressionStats] {
+	dt.mu.RLock()
+	defer dt.mu.RUnlock()
+
+	var stats CompressionStats
+	for _, item := range dt.IndexTable.GetAll() {
+		raw, stored, err := dt.recordSizes(item.Value)
+		if err != nil {
+			return Result[CompressionStats]{Err: err}
+		}
+		stats.Rows++
+		if raw != stored {
+			stats.Compressed++
+		}
+		stats.RawBytes += raw
+		stats.StoredBytes += stored
+	}
+	return Result[CompressionStats]{Value: stats}
+}
@@ -0,0 +1,152 @@
+package storageEngine
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// marker returns the first stored byte of the row under key.
+func marker(t *testing.T, dt *DataTable[int, logRow], key int) byte {
+	t.Helper()
+	offset, found := dt.IndexTable.Search(key)
+	if !found {
+		t.Fatalf("key %d is not indexed", key)
+	}
+	b := make([]byte, 1)
+	if _, err := dt.DataFile.ReadAt(b, int64(offset)); err != nil {
+		t.Fatal(err)
+	}
+	return b[0]
+}
+
+// framed reports whether a stored record starts with a compression marker
+// rather than the byte count of a raw gob record.
+func framed(m byte) bool {
+	return m == frameS2 || m == frameZstd
+}
+
+func compressible(key int) string {
+	return strings.Repeat(fmt.Sprint("row ", key, " "), 200)
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		c     Compression
+		frame byte
+	}{{CompressS2, frameS2}, {CompressZstd, frameZstd}} {
+		dt := newRowTable(t, WithCompression(tt.c, DefaultCompressionThreshold))
+		for key := 1; key <= 3; key++ {
+			if res := dt.Insert(key, logRow{compressible(key)}); res.Err != nil {
+				t.Fatal(res.Err)
+			}
+		}
+		if res := dt.Insert(4, logRow{"tiny"}); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+
+		for key := 1; key <= 3; key++ {
+			if m := marker(t, dt, key); m != tt.frame {
+				t.Fatalf("codec %d: row %d starts with %#x, want %#x", tt.c, key, m, tt.frame)
+			}
+			wantName(t, dt, key, compressible(key))
+		}
+		if m := marker(t, dt, 4); framed(m) {
+			t.Fatalf("codec %d: a row below the threshold was framed as %#x", tt.c, m)
+		}
+		wantName(t, dt, 4, "tiny")
+	}
+}
+
+func TestCompressionChangeKeepsOldRows(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "mixed")
+	for i, c := range []Compression{CompressS2, CompressZstd, CompressNone} {
+		dt, err := NewDataTable[int, logRow](cmp.Compare[int], name, 4, WithCompression(c, DefaultCompressionThreshold))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 {
+			if res := dt.LoadIndex(dt.IndexFile.Name()); res.Err != nil {
+				t.Fatal(res.Err)
+			}
+		}
+		for key := 3*i + 1; key <= 3*i+3; key++ {
+			if res := dt.Insert(key, logRow{compressible(key)}); res.Err != nil {
+				t.Fatal(res.Err)
+			}
+		}
+		dt.SaveIndex()
+		dt.Close()
+	}
+
+	dt, err := reopenSealed(t, name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key := 1; key <= 9; key++ {
+		want := []byte{frameS2, frameZstd, 0}[(key-1)/3]
+		if m := marker(t, dt, key); (want != 0 && m != want) || (want == 0 && framed(m)) {
+			t.Fatalf("row %d starts with %#x", key, m)
+		}
+		wantName(t, dt, key, compressible(key))
+	}
+	// rewriting an old row uses the current setting
+	if res := dt.Upsert(1, logRow{compressible(10)}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if m := marker(t, dt, 1); framed(m) {
+		t.Fatalf("a row rewritten without compression starts with %#x", m)
+	}
+	wantName(t, dt, 1, compressible(10))
+}
+
+func TestCompressionStats(t *testing.T) {
+	raw := newRowTable(t)
+	packed := newRowTable(t, WithCompression(CompressZstd, DefaultCompressionThreshold))
+	for _, dt := range []*DataTable[int, logRow]{raw, packed} {
+		for key := 1; key <= 5; key++ {
+			name := compressible(key)
+			if key > 3 {
+				name = "tiny"
+			}
+			if res := dt.Insert(key, logRow{name}); res.Err != nil {
+				t.Fatal(res.Err)
+			}
+		}
+	}
+
+	plain := raw.CompressionStats()
+	if plain.Err != nil {
+		t.Fatal(plain.Err)
+	}
+	if s := plain.Value; s.Rows != 5 || s.Compressed != 0 || s.StoredBytes != s.RawBytes || s.Ratio() != 1 {
+		t.Fatalf("stats of an uncompressed table = %+v", s)
+	}
+
+	stats := packed.CompressionStats()
+	if stats.Err != nil {
+		t.Fatal(stats.Err)
+	}
+	s := stats.Value
+	info, err := packed.DataFile.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Rows != 5 || s.Compressed != 3 || s.RawBytes != plain.Value.RawBytes || s.StoredBytes != info.Size() {
+		t.Fatalf("stats = %+v, want 5 rows, 3 compressed, %d raw and %d stored bytes",
+			s, plain.Value.RawBytes, info.Size())
+	}
+	if s.Ratio() <= 2 {
+		t.Fatalf("ratio = %.2f for repetitive rows", s.Ratio())
+	}
+
+	// only live rows count
+	if res := packed.Delete(1); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if s := packed.CompressionStats().Value; s.Rows != 4 || s.Compressed != 2 {
+		t.Fatalf("stats after a delete = %+v", s)
+	}
+}
@@ -0,0 +1,528 @@
+package storageEngine
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+var (
+	ErrWrongKey     = errors.New("wrong encryption key")
+	ErrEncrypted    = errors.New("table is encrypted and no key was supplied")
+	ErrNotEncrypted = errors.New("table has no encryption key")
+)
+
+// KeyProvider supplies the AES keys a table is encrypted with. Keys are
+// 16, 24 or 32 bytes and are identified by an id stored next to the data
+// they encrypted, so older keys must stay available until a re-encryption
+// has moved everything to the current one.
+type KeyProvider interface {
+	CurrentKey() (id uint32, key []byte, err error)
+	Key(id uint32) ([]byte, error)
+}
+
+// KeyRing is a KeyProvider holding keys in memory. Keys get the ids 1, 2, ...
+// in the order they are added, and the last one is current, so a ring
+// rebuilt from the same keys in the same order reads the same data. A
+// retired key can be passed as nil to keep the ids of the later ones.
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys [][]byte
+}
+
+func NewKeyRing(keys ...[]byte) *KeyRing {
+	return &KeyRing{keys: keys}
+}
+
+// Rotate makes key the current key and returns its id.
+func (r *KeyRing) Rotate(key []byte) uint32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, key)
+	return uint32(len(r.keys))
+}
+
+func (r *KeyRing) CurrentKey() (uint32, []byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.keys) == 0 {
+		return 0, nil, errors.New("key ring is empty")
+	}
+	return uint32(len(r.keys)), r.keys[len(r.keys)-1], nil
+}
+
+func (r *KeyRing) Key(id uint32) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if id == 0 || int(id) > len(r.keys) || r.keys[id-1] == nil {
+		return nil, fmt.Errorf("no key with id %d", id)
+	}
+	return r.keys[id-1], nil
+}
+
+// WithEncryption encrypts rows, the index and the free list with AES-GCM
+// under keys from p. Rows written before the option was set stay readable
+// until StartReEncryption rewrites them.
+func WithEncryption(p KeyProvider) Option {
+	return func(o *tableOptions) {
+		o.keys = p
+	}
+}
+
+// A sealed record is frameSealed, the key id, the uvarint length of the
+// ciphertext, the nonce and the ciphertext of the record as it would be
+// stored unencrypted. The index and free list files start with sealedMagic
+// and hold a sequence of sealed pages.
+const frameSealed byte = 0x82
+
+var sealedMagic = []byte{frameSealed, 'Z', 'S', 'E', 'A', 'L'}
+
+const (
+	sealedPageSize = 64 << 10
+	nonceSize      = 12
+)
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+type crypter struct {
+	keys  KeyProvider
+	mu    sync.Mutex
+	aeads map[uint32]cipher.AEAD
+}
+
+func newCrypter(keys KeyProvider) *crypter {
+	if keys == nil {
+		return nil
+	}
+	return &crypter{keys: keys, aeads: make(map[uint32]cipher.AEAD)}
+}
+
+func (c *crypter) aead(id uint32, key []byte) (cipher.AEAD, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if aead, ok := c.aeads[id]; ok {
+		return aead, nil
+	}
+	if key == nil {
+		var err error
+		if key, err = c.keys.Key(id); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWrongKey, err)
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	c.aeads[id] = aead
+	return aead, nil
+}
+
+func (c *crypter) currentID() (uint32, error) {
+	id, _, err := c.keys.CurrentKey()
+	return id, err
+}
+
+// seal appends the key id, nonce and ciphertext of plain to dst.
+func (c *crypter) seal(dst, plain, ad []byte) ([]byte, error) {
+	id, key, err := c.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := c.aead(id, key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	dst = binary.BigEndian.AppendUint32(dst, id)
+	dst = binary.AppendUvarint(dst, uint64(len(plain)+aead.Overhead()))
+	dst = append(dst, nonce...)
+	return aead.Seal(dst, nonce, plain, ad), nil
+}
+
+// open reads what seal wrote from r and decrypts it.
+func (c *crypter) open(r byteReader, ad []byte) ([]byte, error) {
+	var head [4]byte
+	for i := range head {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		head[i] = b
+	}
+	id := binary.BigEndian.Uint32(head[:])
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > 1<<32 {
+		return nil, fmt.Errorf("sealed block of %d bytes is too large", n)
+	}
+	sealed := make([]byte, nonceSize+n)
+	if _, err := io.ReadFull(r, sealed); err != nil {
+		return nil, err
+	}
+
+	aead, err := c.aead(id, nil)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], ad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: key %d cannot decrypt the data", ErrWrongKey, id)
+	}
+	return plain, nil
+}
+
+// sealRecord encrypts a stored record.
+func (c *crypter) sealRecord(record []byte) ([]byte, error) {
+	return c.seal([]byte{frameSealed}, record, nil)
+}
+
+// writer returns a writer encrypting to w, or w itself without a key. The
+// returned function writes the last page and must be called once done.
+func (c *crypter) writer(w io.Writer) (io.Writer, func() error) {
+	if c == nil {
+		return w, func() error { return nil }
+	}
+	pw := &pageWriter{c: c, w: w}
+	if _, err := w.Write(sealedMagic); err != nil {
+		pw.err = err
+	}
+	return pw, pw.close
+}
+
+// reader returns a reader over what writer wrote to r, whether or not it was
+// encrypted.
+func (c *crypter) reader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(sealedMagic))
+	if err != nil || !bytes.Equal(head, sealedMagic) {
+		return br, nil
+	}
+	if c == nil {
+		return nil, ErrEncrypted
+	}
+	br.Discard(len(sealedMagic))
+	return &pageReader{c: c, r: br}, nil
+}
+
+// Pages are authenticated with their position and whether they are last,
+// so pages cannot be reordered or dropped from the end unnoticed.
+func pageData(page uint64, last bool) []byte {
+	ad := binary.BigEndian.AppendUint64(nil, page)
+	if last {
+		return append(ad, 1)
+	}
+	return append(ad, 0)
+}
+
+type pageWriter struct {
+	c    *crypter
+	w    io.Writer
+	buf  []byte
+	page uint64
+	err  error
+}
+
+func (pw *pageWriter) Write(p []byte) (int, error) {
+	if pw.err != nil {
+		return 0, pw.err
+	}
+	pw.buf = append(pw.buf, p...)
+	// a full page is only written once more data follows it, since the
+	// last page is marked as such
+	for len(pw.buf) > sealedPageSize {
+		if pw.err = pw.flush(pw.buf[:sealedPageSize], false); pw.err != nil {
+			return 0, pw.err
+		}
+		pw.buf = pw.buf[sealedPageSize:]
+	}
+	return len(p), nil
+}
+
+func (pw *pageWriter) flush(plain []byte, last bool) error {
+	flag := byte(0)
+	if last {
+		flag = 1
+	}
+	page, err := pw.c.seal([]byte{flag}, plain, pageData(pw.page, last))
+	if err != nil {
+		return err
+	}
+	pw.page++
+	_, err = pw.w.Write(page)
+	return err
+}
+
+func (pw *pageWriter) close() error {
+	if pw.err != nil {
+		return pw.err
+	}
+	pw.err = pw.flush(pw.buf, true)
+	pw.buf = nil
+	return pw.err
+}
+
+type pageReader struct {
+	c    *crypter
+	r    *bufio.Reader
+	buf  []byte
+	page uint64
+	done bool
+}
+
+func (pr *pageReader) Read(p []byte) (int, error) {
+	for len(pr.buf) == 0 {
+		if pr.done {
+			return 0, io.EOF
+		}
+		flag, err := pr.r.ReadByte()
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		pr.done = flag == 1
+		if pr.buf, err = pr.c.open(pr.r, pageData(pr.page, pr.done)); err != nil {
+			return 0, err
+		}
+		pr.page++
+	}
+	n := copy(p, pr.buf)
+	pr.buf = pr.buf[n:]
+	return n, nil
+}
+
+// recordKey returns the id of the key the record at offset is encrypted
+// with, and whether it is encrypted at all.
+func (dt *DataTable[K, V]) recordKey(offset int) (uint32, bool, error) {
+	reader := dt.rowReader(offset)
+	head, err := reader.r.Peek(1)
+	if err != nil {
+		return 0, false, err
+	}
+	switch head[0] {
+	case frameOverflow:
+		first, err := dt.overflowOf(offset)
+		if err != nil {
+			return 0, false, err
+		}
+		return dt.chainKey(first)
+	case frameSealed:
+		if head, err = reader.r.Peek(5); err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint32(head[1:]), true, nil
+	}
+	return 0, false, nil
+}
+
+// chainKey is recordKey for an overflow chain, judged by its first chunk.
+func (dt *DataTable[K, V]) chainKey(first uint64) (uint32, bool, error) {
+	if first == 0 {
+		return 0, false, nil
+	}
+	_, _, sealed, err := dt.chunkHead(first - 1)
+	if err != nil || !sealed {
+		return 0, false, err
+	}
+	var id [4]byte
+	if _, err := dt.overflow.file.ReadAt(id[:], int64(first-1)*chunkSize+chunkHeader); err != nil {
+		return 0, false, err
+	}
+	return binary.BigEndian.Uint32(id[:]), true, nil
+}
+
+// StartReEncryption rewrites, in the background, every row and blob not
+// encrypted with the current key, holding the table lock for batch rows or
+// one blob at a time so other work can go on in between. The index is saved
+// after each batch, and the free lists and mutation log once everything is
+// rewritten; backups keep the keys they were taken with. wait blocks until
+// it is done and returns the number of rows and blobs rewritten; call it
+// before closing the table.
+func (dt *DataTable[K, V]) StartReEncryption(batch int) (wait func() Result[int]) {
+	if batch <= 0 {
+		batch = 1
+	}
+	done := make(chan Result[int], 1)
+	go func() {
+		done <- dt.reEncrypt(batch)
+	}()
+
+	var once sync.Once
+	var res Result[int]
+	return func() Result[int] {
+		once.Do(func() { res = <-done })
+		return res
+	}
+}
+
+func (dt *DataTable[K, V]) reEncrypt(batch int) Result[int] {
+	if dt.crypt == nil {
+		return Result[int]{Err: ErrNotEncrypted}
+	}
+	current, err := dt.crypt.currentID()
+	if err != nil {
+		return Result[int]{Err: err}
+	}
+
+	// rows inserted from here on are already written with the current key
+	keys := dt.Keys()
+	rewritten := 0
+	for start := 0; start < len(keys); start += batch {
+		n, err := dt.reEncryptKeys(keys[start:min(start+batch, len(keys))], current)
+		rewritten += n
+		if err != nil {
+			return Result[int]{Value: rewritten, Err: err}
+		}
+	}
+
+	for _, key := range dt.BlobKeys() {
+		n, err := dt.reEncryptBlob(key, current)
+		rewritten += n
+		if err != nil {
+			return Result[int]{Value: rewritten, Err: err}
+		}
+	}
+
+	// pick up the index, free lists and log written before the rotation
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if res := dt.saveIndex(); res.Err != nil {
+		return Result[int]{Value: rewritten, Err: res.Err}
+	}
+	if err := dt.saveFreeList(); err != nil {
+		return Result[int]{Value: rewritten, Err: err}
+	}
+	if err := dt.saveOverflow(); err != nil {
+		return Result[int]{Value: rewritten, Err: err}
+	}
+	return Result[int]{Value: rewritten, Err: dt.rewriteLog()}
+}
+
+func (dt *DataTable[K, V]) reEncryptKeys(keys []K, current uint32) (rewritten int, err error) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if dt.backups > 0 {
+		return 0, ErrBackupInProgress
+	}
+	if len(dt.snapshots) > 0 {
+		return 0, ErrSnapshotActive
+	}
+
+	defer func() {
+		if rewritten > 0 {
+			if res := dt.saveIndex(); res.Err != nil && err == nil {
+				err = res.Err
+			}
+		}
+	}()
+	for _, key := range keys {
+		offset, found := dt.IndexTable.Search(key)
+		if !found {
+			continue
+		}
+		id, sealed, err := dt.recordKey(offset)
+		if err != nil {
+			return rewritten, err
+		}
+		if sealed && id == current {
+			continue
+		}
+		res := dt.delete(key)
+		if res.Err != nil {
+			return rewritten, res.Err
+		}
+		row := res.Value
+		row.IsValid = true
+		if res := dt.insertRow(row); res.Err != nil {
+			return rewritten, res.Err
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+// reEncryptBlob copies a blob not sealed with the current key into a new
+// chain and reports whether it did.
+func (dt *DataTable[K, V]) reEncryptBlob(key K, current uint32) (int, error) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	ref, found := dt.overflow.blobs[key]
+	if !found {
+		return 0, nil
+	}
+	id, sealed, err := dt.chainKey(ref.First)
+	if err != nil || ref.First == 0 || (sealed && id == current) {
+		return 0, err
+	}
+
+	w := &chainWriter[K, V]{dt: dt}
+	if _, err := io.Copy(w, &chainReader[K, V]{dt: dt, next: ref.First}); err != nil {
+		w.abort()
+		return 0, err
+	}
+	first, err := w.finish()
+	if err != nil {
+		w.abort()
+		return 0, err
+	}
+	dt.overflow.blobs[key] = blobRef{First: first, Size: ref.Size}
+	if err := dt.releaseChain(ref.First); err != nil {
+		return 0, err
+	}
+	return 1, dt.saveOverflow()
+}
+
+// rewriteLog re-encrypts the mutation log under the current key.
+func (dt *DataTable[K, V]) rewriteLog() error {
+	if dt.logFile == nil {
+		return nil
+	}
+	path := dt.logFile.Name()
+	var records []LogRecord[K, V]
+	if err := readLog(path, dt.crypt, func(r LogRecord[K, V]) error {
+		records = append(records, r)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := writeLog(path+".tmp", records, dt.crypt); err != nil {
+		return err
+	}
+	if err := dt.logFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	dt.logFile = f
+	return nil
+}
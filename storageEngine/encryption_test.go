@@ -0,0 +1,172 @@
+package storageEngine
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+// reopenSealed opens the table at name with ring, which may be nil, and
+// loads its index.
+func reopenSealed(t *testing.T, name string, ring *KeyRing) (*DataTable[int, logRow], error) {
+	t.Helper()
+	var opts []Option
+	if ring != nil {
+		opts = append(opts, WithEncryption(ring))
+	}
+	dt, err := NewDataTable[int, logRow](cmp.Compare[int], name, 4, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if res := dt.LoadIndex(dt.IndexFile.Name()); res.Err != nil {
+		dt.Close()
+		return nil, res.Err
+	}
+	t.Cleanup(func() { dt.Close() })
+	return dt, nil
+}
+
+func writeSealed(t *testing.T, name string, ring *KeyRing, n int) *DataTable[int, logRow] {
+	t.Helper()
+	dt, err := NewDataTable[int, logRow](cmp.Compare[int], name, 4, WithEncryption(ring))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key := 1; key <= n; key++ {
+		if res := dt.Insert(key, logRow{fmt.Sprint("secret ", key)}); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	return dt
+}
+
+func TestEncryptedTableNeedsItsKey(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "sealed")
+	dt := writeSealed(t, name, NewKeyRing(testKey(1)), 3)
+	if res := dt.SaveIndex(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	dt.Close()
+
+	data, err := os.ReadFile(name + "_data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret")) {
+		t.Fatal("the data file holds a row in plain text")
+	}
+	if _, err := reopenSealed(t, name, nil); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("opening without a key = %v, want ErrEncrypted", err)
+	}
+	if _, err := reopenSealed(t, name, NewKeyRing(testKey(2))); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("opening with another key = %v, want ErrWrongKey", err)
+	}
+	dt, err = reopenSealed(t, name, NewKeyRing(testKey(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := dt.Search(2); res.Err != nil || res.Value.Data.Name != "secret 2" {
+		t.Fatalf("Search with the key = %+v", res)
+	}
+
+	plain := newRowTable(t)
+	if res := plain.StartReEncryption(1)(); !errors.Is(res.Err, ErrNotEncrypted) {
+		t.Fatalf("re-encrypting a plain table = %v, want ErrNotEncrypted", res.Err)
+	}
+}
+
+func TestRotationReEncryptsEveryRow(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "sealed")
+	ring := NewKeyRing(testKey(1))
+	dt := writeSealed(t, name, ring, 20)
+	blob := bytes.Repeat([]byte("blob "), 5000)
+	w := dt.CreateBlob(1).Value
+	w.Write(blob)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if id := ring.Rotate(testKey(2)); id != 2 {
+		t.Fatalf("Rotate = %d, want 2", id)
+	}
+	if res := dt.Insert(21, logRow{"secret 21"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res := dt.StartReEncryption(7)(); res.Err != nil || res.Value != 21 {
+		t.Fatalf("re-encryption = %+v, want the 20 old rows and the blob", res)
+	}
+	for key := 1; key <= 21; key++ {
+		offset, _ := dt.IndexTable.Search(key)
+		if id, sealed, err := dt.recordKey(offset); err != nil || !sealed || id != 2 {
+			t.Fatalf("row %d is under key %d (sealed %v, %v), want key 2", key, id, sealed, err)
+		}
+	}
+	if res := dt.StartReEncryption(7)(); res.Err != nil || res.Value != 0 {
+		t.Fatalf("second re-encryption = %+v, want nothing rewritten", res)
+	}
+	dt.Close()
+
+	// the retired key is no longer needed, and no longer enough
+	if _, err := reopenSealed(t, name, NewKeyRing(testKey(1))); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("opening with only the retired key = %v, want ErrWrongKey", err)
+	}
+	dt, err := reopenSealed(t, name, NewKeyRing(nil, testKey(2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key := 1; key <= 21; key++ {
+		if res := dt.Search(key); res.Err != nil || res.Value.Data.Name != fmt.Sprint("secret ", key) {
+			t.Fatalf("Search(%d) = %+v", key, res)
+		}
+	}
+	r := dt.OpenBlob(1)
+	if r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	defer r.Value.Close()
+	if got, err := io.ReadAll(r.Value); err != nil || !bytes.Equal(got, blob) {
+		t.Fatalf("blob after re-encryption: %d bytes, %v", len(got), err)
+	}
+}
+
+func TestTamperedRecordFailsAuthentication(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "sealed")
+	dt := writeSealed(t, name, NewKeyRing(testKey(1)), 2)
+	defer dt.Close()
+
+	// flip the first ciphertext byte, after the marker, key id, length
+	// and nonce
+	offset, _ := dt.IndexTable.Search(1)
+	head := make([]byte, 16)
+	if _, err := dt.DataFile.ReadAt(head, int64(offset)); err != nil {
+		t.Fatal(err)
+	}
+	if head[0] != frameSealed {
+		t.Fatalf("row starts with %#x, want a sealed frame", head[0])
+	}
+	_, n := binary.Uvarint(head[5:])
+	at := int64(offset + 5 + n + nonceSize)
+	b := make([]byte, 1)
+	dt.DataFile.ReadAt(b, at)
+	b[0] ^= 0xff
+	if _, err := dt.DataFile.WriteAt(b, at); err != nil {
+		t.Fatal(err)
+	}
+
+	if res := dt.Search(1); !errors.Is(res.Err, ErrWrongKey) {
+		t.Fatalf("Search of a tampered row = %+v, want ErrWrongKey", res)
+	}
+	if res := dt.Search(2); res.Err != nil || res.Value.Data.Name != "secret 2" {
+		t.Fatalf("Search of an untouched row = %+v", res)
+	}
+}
@@ -0,0 +1,93 @@
+package storageEngine
+
+// Hooks run under the table's write lock, so they must not call back into
+// the same table. A hook that returns an error rejects the mutation; the
+// Before hooks may also return a transformed row to store instead.
+type tableHooks[K comparable, V any] struct {
+	beforeInsert []func(key K, data V) (V, error)
+	afterInsert  []func(key K, data V)
+	beforeUpdate []func(key K, old, data V) (V, error)
+	beforeDelete []func(key K, data V) error
+}
+
+func (dt *DataTable[K, V]) BeforeInsert(hook func(key K, data V) (V, error)) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	dt.hooks.beforeInsert = append(dt.hooks.beforeInsert, hook)
+}
+
+func (dt *DataTable[K, V]) AfterInsert(hook func(key K, data V)) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	dt.hooks.afterInsert = append(dt.hooks.afterInsert, hook)
+}
+
+func (dt *DataTable[K, V]) BeforeUpdate(hook func(key K, old, data V) (V, error)) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	dt.hooks.beforeUpdate = append(dt.hooks.beforeUpdate, hook)
+}
+
+func (dt *DataTable[K, V]) BeforeDelete(hook func(key K, data V) error) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	dt.hooks.beforeDelete = append(dt.hooks.beforeDelete, hook)
+}
+
+func (dt *DataTable[K, V]) beforeInsert(key K, data V) (V, error) {
+	for _, hook := range dt.hooks.beforeInsert {
+		var err error
+		if data, err = hook(key, data); err != nil {
+			return data, err
+		}
+	}
+	return data, nil
+}
+
+func (dt *DataTable[K, V]) afterInsert(key K, data V) {
+	for _, hook := range dt.hooks.afterInsert {
+		hook(key, data)
+	}
+}
+
+// beforeUpdate reads the current row only when there are hooks to show it to.
+func (dt *DataTable[K, V]) beforeUpdate(key K, data V) (V, error) {
+	if len(dt.hooks.beforeUpdate) == 0 {
+		return data, nil
+	}
+	res := dt.search(key)
+	if res.Err != nil {
+		return data, res.Err
+	}
+	return dt.runBeforeUpdate(key, res.Value.Data, data)
+}
+
+func (dt *DataTable[K, V]) runBeforeUpdate(key K, old, data V) (V, error) {
+	for _, hook := range dt.hooks.beforeUpdate {
+		var err error
+		if data, err = hook(key, old, data); err != nil {
+			return data, err
+		}
+	}
+	return data, nil
+}
+
+func (dt *DataTable[K, V]) beforeDelete(key K) error {
+	if len(dt.hooks.beforeDelete) == 0 {
+		return nil
+	}
+	res := dt.search(key)
+	if res.Err != nil {
+		return res.Err
+	}
+	return dt.runBeforeDelete(key, res.Value.Data)
+}
+
+func (dt *DataTable[K, V]) runBeforeDelete(key K, data V) error {
+	for _, hook := range dt.hooks.beforeDelete {
+		if err := hook(key, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
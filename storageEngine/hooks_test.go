@@ -0,0 +1,109 @@
+package storageEngine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBeforeHookErrorAbortsWrite(t *testing.T) {
+	dt := newRowTable(t)
+	if res := dt.Insert(1, logRow{"kept"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	rejected := errors.New("rejected")
+	var inserted []int
+	dt.BeforeInsert(func(key int, data logRow) (logRow, error) {
+		if data.Name == "" {
+			return data, rejected
+		}
+		return data, nil
+	})
+	dt.AfterInsert(func(key int, data logRow) { inserted = append(inserted, key) })
+	var sawOld logRow
+	dt.BeforeUpdate(func(key int, old, data logRow) (logRow, error) {
+		sawOld = old
+		if data.Name == "" {
+			return data, rejected
+		}
+		return data, nil
+	})
+	var sawDeleted logRow
+	dt.BeforeDelete(func(key int, data logRow) error {
+		sawDeleted = data
+		return rejected
+	})
+	seq := dt.seq
+
+	if res := dt.Insert(2, logRow{}); !errors.Is(res.Err, rejected) {
+		t.Fatalf("Insert = %v, want the hook's error", res.Err)
+	}
+	if res := dt.Search(2); !errors.Is(res.Err, ErrKeyNotFound) {
+		t.Fatalf("a rejected insert was stored: %+v", res)
+	}
+	if len(inserted) != 0 {
+		t.Fatalf("AfterInsert ran for a rejected insert: %v", inserted)
+	}
+
+	if res := dt.UpdateWithData(1, logRow{}); !errors.Is(res.Err, rejected) {
+		t.Fatalf("UpdateWithData = %v, want the hook's error", res.Err)
+	}
+	if sawOld.Name != "kept" {
+		t.Fatalf("BeforeUpdate saw old row %+v", sawOld)
+	}
+	wantRow(t, dt, 1, "kept")
+
+	if res := dt.Delete(1); !errors.Is(res.Err, rejected) {
+		t.Fatalf("Delete = %v, want the hook's error", res.Err)
+	}
+	if sawDeleted.Name != "kept" {
+		t.Fatalf("BeforeDelete saw %+v", sawDeleted)
+	}
+	wantRow(t, dt, 1, "kept")
+	if dt.seq != seq {
+		t.Fatalf("rejected writes were committed: sequence %d, want %d", dt.seq, seq)
+	}
+}
+
+func TestHooksTransformAndAfterInsertRuns(t *testing.T) {
+	dt := newRowTable(t)
+	var order []string
+	dt.BeforeInsert(func(key int, data logRow) (logRow, error) {
+		order = append(order, "first")
+		data.Name = strings.TrimSpace(data.Name)
+		return data, nil
+	})
+	dt.BeforeInsert(func(key int, data logRow) (logRow, error) {
+		order = append(order, "second")
+		data.Name = strings.ToUpper(data.Name)
+		return data, nil
+	})
+	var after []logRow
+	dt.AfterInsert(func(key int, data logRow) {
+		// the row is stored by the time after-hooks run
+		if _, found := dt.IndexTable.Search(key); !found {
+			t.Errorf("AfterInsert ran before key %d was stored", key)
+		}
+		after = append(after, data)
+	})
+	dt.BeforeUpdate(func(key int, old, data logRow) (logRow, error) {
+		data.Name = old.Name + "+" + data.Name
+		return data, nil
+	})
+
+	if res := dt.Insert(1, logRow{"  ada "}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if strings.Join(order, ",") != "first,second" {
+		t.Fatalf("hooks ran in order %v", order)
+	}
+	wantRow(t, dt, 1, "ADA")
+	if len(after) != 1 || after[0].Name != "ADA" {
+		t.Fatalf("AfterInsert saw %+v, want the transformed row", after)
+	}
+
+	if res := dt.UpdateWithData(1, logRow{"lovelace"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	wantRow(t, dt, 1, "ADA+lovelace")
+}
@@ -0,0 +1,1167 @@
+package storageEngine
+
+import (
+	"ZeroStore/datastructure/btree"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Table is the row API shared by DataTable and LSMTable, so callers such as
+// the query builder work with either engine.
+type Table[K comparable, V any] interface {
+	Search(primaryKey K) Result[DataRow[K, V]]
+	Insert(primaryKey K, data V) Result[any]
+	Upsert(primaryKey K, data V) Result[any]
+	InsertIfAbsent(primaryKey K, data V) Result[bool]
+	UpdateWithData(primaryKey K, data V) Result[any]
+	UpdateWithFunc(primaryKey K, updateFunc func(data V) V) Result[any]
+	Delete(primaryKey K) Result[DataRow[K, V]]
+	CompareAndSwap(primaryKey K, expectedVersion uint64, data V) Result[uint64]
+	CompareAndDelete(primaryKey K, expectedVersion uint64) Result[DataRow[K, V]]
+	GetAll() <-chan Result[DataRow[K, V]]
+	GetAllContext(ctx context.Context) <-chan Result[DataRow[K, V]]
+	Range(start, end K) <-chan Result[DataRow[K, V]]
+	RangeContext(ctx context.Context, start, end K) <-chan Result[DataRow[K, V]]
+	Keys() []K
+	Where(filter func(DataRow[K, V]) bool) Result[[]K]
+	GetFromKeys(keys []K) Result[[]DataRow[K, V]]
+	Select(keys []K, resultType interface{}) chan Result[interface{}]
+	Compact() Result[any]
+	Close() Result[any]
+}
+
+var (
+	_ Table[int, int] = (*DataTable[int, int])(nil)
+	_ Table[int, int] = (*LSMTable[int, int])(nil)
+)
+
+var ErrTableClosed = errors.New("table closed")
+
+// DefaultMemtableSize is the amount of logged writes the memtable of an
+// LSMTable collects before it is written out as an SSTable.
+const DefaultMemtableSize = 4 << 20
+
+// WithMemtableSize sets how many bytes of writes an LSMTable keeps in
+// memory before flushing them to level 0.
+func WithMemtableSize(bytes int) Option {
+	return func(o *tableOptions) {
+		o.memtableSize = bytes
+	}
+}
+
+const (
+	lsmLevels = 7
+	// level 0 holds flushed memtables, which overlap; once it has
+	// l0CompactionTrigger tables they are merged into level 1
+	l0CompactionTrigger = 4
+	// level 1 may hold levelBaseSize bytes and every deeper level ten
+	// times the one above
+	levelBaseSize  = 10 << 20
+	levelSizeRatio = 10
+	// compaction splits its output into tables of about targetTableSize
+	targetTableSize = 2 << 20
+)
+
+// LSMTable stores rows in a log-structured merge tree. Writes go to a
+// memtable backed by a log, full memtables are flushed to immutable
+// SSTables in level 0, and a background goroutine merges tables into
+// deeper levels, where they do not overlap. Deletes write tombstones, which
+// are dropped once they reach the last level. It suits write-heavy tables:
+// every write is an append, and there is no free list.
+type LSMTable[K comparable, V any] struct {
+	Compare func(a, b K) int
+	name    string
+	options tableOptions
+
+	mu     sync.RWMutex
+	mem    *memtable[K, V]
+	imm    *memtable[K, V]
+	levels [lsmLevels][]*sstable[K, V]
+	// flushed is signalled when imm has been written out
+	flushed  *sync.Cond
+	manifest lsmManifest
+	closed   bool
+	// bgErr is the first error of the background goroutine; later writes
+	// fail with it
+	bgErr error
+
+	// compactMu is held by whoever flushes or compacts
+	compactMu sync.Mutex
+	work      chan struct{}
+	done      chan struct{}
+	stats     LSMStats
+}
+
+type memtable[K comparable, V any] struct {
+	rows    *btree.BTree[K, DataRow[K, V]]
+	size    int
+	logNum  uint64
+	logFile *os.File
+	log     *bufio.Writer
+}
+
+// lsmManifest lists the live tables of each level, oldest log first.
+type lsmManifest struct {
+	NextFile uint64
+	// LogNumber is the oldest log holding writes not yet in a table
+	LogNumber uint64
+	Levels    [lsmLevels][]uint64
+}
+
+// LSMStats describes the memtable and the levels of an LSMTable.
+type LSMStats struct {
+	MemtableBytes int
+	Levels        []LevelStats
+	Flushes       uint64
+	Compactions   uint64
+}
+
+type LevelStats struct {
+	Tables int
+	Rows   int
+	Bytes  int64
+}
+
+func lsmManifestPath(name string) string {
+	return name + "_lsm.json"
+}
+
+func lsmLogPath(name string, num uint64) string {
+	return fmt.Sprintf("%s_%06d.log", name, num)
+}
+
+// NewLSMTable opens or creates the LSM table dbName. WithMemtableSize and
+// WithBloomFilter apply; the rate of the latter is used for the filter
+// every SSTable carries.
+func NewLSMTable[K comparable, V any](compare func(a, b K) int, dbName string, opts ...Option) (*LSMTable[K, V], error) {
+	options := tableOptions{memtableSize: DefaultMemtableSize, bloomRate: defaultSSTRate}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	gob.Register(DataRow[K, V]{})
+
+	lt := &LSMTable[K, V]{
+		Compare: compare,
+		name:    dbName,
+		options: options,
+		work:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	lt.flushed = sync.NewCond(&lt.mu)
+	if err := lt.open(); err != nil {
+		lt.closeFiles()
+		return nil, err
+	}
+	go lt.background()
+	return lt, nil
+}
+
+func (lt *LSMTable[K, V]) open() error {
+	data, err := os.ReadFile(lsmManifestPath(lt.name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &lt.manifest); err != nil {
+			return err
+		}
+	}
+
+	live := map[uint64]bool{}
+	for level, nums := range lt.manifest.Levels {
+		for _, num := range nums {
+			t, err := openSSTable[K, V](sstFilePath(lt.name, num), num)
+			if err != nil {
+				return err
+			}
+			lt.levels[level] = append(lt.levels[level], t)
+			live[num] = true
+		}
+	}
+	// tables written by a flush or compaction that did not finish
+	tables, _ := filepath.Glob(lt.name + "_*.sst")
+	for _, path := range tables {
+		if num, ok := fileNumber(lt.name, path, ".sst"); ok && !live[num] {
+			os.Remove(path)
+		}
+	}
+
+	// writes logged since the last flush are replayed and flushed
+	lt.mem = lt.newMemtable(0)
+	logs, _ := filepath.Glob(lt.name + "_*.log")
+	var replayed []string
+	for _, path := range logs {
+		num, ok := fileNumber(lt.name, path, ".log")
+		if !ok {
+			continue
+		}
+		if num >= lt.manifest.LogNumber {
+			if err := lt.replayLog(path); err != nil {
+				return err
+			}
+		}
+		replayed = append(replayed, path)
+	}
+	if lt.mem.rows.Len() > 0 {
+		lt.imm, lt.mem = lt.mem, nil
+		// every log up to here is in the table once it is written
+		lt.manifest.LogNumber = lt.manifest.NextFile + 1
+		if err := lt.flushImm(); err != nil {
+			return err
+		}
+	} else if err := lt.saveManifest(); err != nil {
+		return err
+	}
+	for _, path := range replayed {
+		os.Remove(path)
+	}
+
+	mem, err := lt.newLoggedMemtable()
+	if err != nil {
+		return err
+	}
+	lt.mem = mem
+	lt.manifest.LogNumber = mem.logNum
+	return lt.saveManifest()
+}
+
+func fileNumber(name, path, ext string) (uint64, bool) {
+	s := strings.TrimSuffix(strings.TrimPrefix(path, name+"_"), ext)
+	num, err := strconv.ParseUint(s, 10, 64)
+	return num, err == nil
+}
+
+func (lt *LSMTable[K, V]) newMemtable(logNum uint64) *memtable[K, V] {
+	return &memtable[K, V]{rows: btree.NewBTree[K, DataRow[K, V]](32, lt.Compare), logNum: logNum}
+}
+
+func (lt *LSMTable[K, V]) newLoggedMemtable() (*memtable[K, V], error) {
+	num := lt.nextFile()
+	f, err := os.OpenFile(lsmLogPath(lt.name, num), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	mem := lt.newMemtable(num)
+	mem.logFile, mem.log = f, bufio.NewWriter(f)
+	return mem, nil
+}
+
+func (lt *LSMTable[K, V]) nextFile() uint64 {
+	lt.manifest.NextFile++
+	return lt.manifest.NextFile
+}
+
+// replayLog applies a memtable log to the memtable, stopping at a record
+// torn by a crash.
+func (lt *LSMTable[K, V]) replayLog(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil
+		}
+		record := make([]byte, n)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return nil
+		}
+		var row DataRow[K, V]
+		if err := gob.NewDecoder(bytes.NewReader(record)).Decode(&row); err != nil {
+			return nil
+		}
+		lt.mem.put(row, len(record))
+	}
+}
+
+func (lt *LSMTable[K, V]) saveManifest() error {
+	data, err := json.MarshalIndent(lt.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := lsmManifestPath(lt.name) + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, lsmManifestPath(lt.name))
+}
+
+func (m *memtable[K, V]) put(row DataRow[K, V], size int) {
+	m.rows.Delete(row.PrimaryKey)
+	m.rows.Insert(row.PrimaryKey, row)
+	m.size += size
+}
+
+func (m *memtable[K, V]) sorted() []DataRow[K, V] {
+	pairs := m.rows.GetAll()
+	rows := make([]DataRow[K, V], len(pairs))
+	for i, p := range pairs {
+		rows[i] = p.Value
+	}
+	return rows
+}
+
+func (m *memtable[K, V]) between(start, end K) []DataRow[K, V] {
+	pairs := m.rows.Range(start, end)
+	rows := make([]DataRow[K, V], len(pairs))
+	for i, p := range pairs {
+		rows[i] = p.Value
+	}
+	return rows
+}
+
+// get returns the newest entry for key, which may be a tombstone. It is
+// called with lt.mu held.
+func (lt *LSMTable[K, V]) get(key K) (DataRow[K, V], bool, error) {
+	for _, m := range []*memtable[K, V]{lt.mem, lt.imm} {
+		if m == nil {
+			continue
+		}
+		if row, ok := m.rows.Search(key); ok {
+			return row, true, nil
+		}
+	}
+	// level 0 is searched newest first; deeper levels hold one candidate
+	for _, t := range lt.levels[0] {
+		if row, ok, err := t.get(key, lt.Compare); err != nil || ok {
+			return row, ok, err
+		}
+	}
+	for _, tables := range lt.levels[1:] {
+		i := sort.Search(len(tables), func(i int) bool {
+			return lt.Compare(tables[i].meta.Max, key) >= 0
+		})
+		if i == len(tables) {
+			continue
+		}
+		if row, ok, err := tables[i].get(key, lt.Compare); err != nil || ok {
+			return row, ok, err
+		}
+	}
+	return DataRow[K, V]{}, false, nil
+}
+
+func (lt *LSMTable[K, V]) search(key K) Result[DataRow[K, V]] {
+	row, ok, err := lt.get(key)
+	if err != nil {
+		return Result[DataRow[K, V]]{Err: err}
+	}
+	if !ok || !row.IsValid {
+		return Result[DataRow[K, V]]{Err: ErrKeyNotFound}
+	}
+	return Result[DataRow[K, V]]{Value: row}
+}
+
+func (lt *LSMTable[K, V]) Search(primaryKey K) Result[DataRow[K, V]] {
+	lt.mu.RLock()
+	defer lt.mu.RUnlock()
+
+	if lt.closed {
+		return Result[DataRow[K, V]]{Err: ErrTableClosed}
+	}
+	return lt.search(primaryKey)
+}
+
+// write logs row and adds it to the memtable, handing the memtable to the
+// background goroutine once it is full. It is called with lt.mu held.
+func (lt *LSMTable[K, V]) write(row DataRow[K, V]) error {
+	if lt.closed {
+		return ErrTableClosed
+	}
+	if lt.bgErr != nil {
+		return lt.bgErr
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(row); err != nil {
+		return err
+	}
+	record := binary.AppendUvarint(nil, uint64(buf.Len()))
+	record = append(record, buf.Bytes()...)
+	if _, err := lt.mem.log.Write(record); err != nil {
+		return err
+	}
+	if err := lt.mem.log.Flush(); err != nil {
+		return err
+	}
+	lt.mem.put(row, len(record))
+
+	if lt.mem.size >= lt.options.memtableSize {
+		return lt.rotate()
+	}
+	return nil
+}
+
+// rotate makes the memtable immutable and starts a new one, waiting for
+// the previous immutable memtable to be flushed first.
+func (lt *LSMTable[K, V]) rotate() error {
+	for lt.imm != nil && lt.bgErr == nil && !lt.closed {
+		lt.flushed.Wait()
+	}
+	if lt.closed {
+		return ErrTableClosed
+	}
+	if lt.bgErr != nil {
+		return lt.bgErr
+	}
+	mem, err := lt.newLoggedMemtable()
+	if err != nil {
+		return err
+	}
+	lt.imm, lt.mem = lt.mem, mem
+	lt.signal()
+	return nil
+}
+
+func (lt *LSMTable[K, V]) signal() {
+	select {
+	case lt.work <- struct{}{}:
+	default:
+	}
+}
+
+func (lt *LSMTable[K, V]) Insert(primaryKey K, data V) Result[any] {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if res := lt.search(primaryKey); res.Err == nil {
+		return Result[any]{Err: fmt.Errorf("%w: %v", ErrKeyExists, primaryKey)}
+	} else if !errors.Is(res.Err, ErrKeyNotFound) {
+		return Result[any]{Err: res.Err}
+	}
+	return Result[any]{Err: lt.write(newRow(primaryKey, data))}
+}
+
+func (lt *LSMTable[K, V]) Upsert(primaryKey K, data V) Result[any] {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	row := newRow(primaryKey, data)
+	res := lt.search(primaryKey)
+	if res.Err == nil {
+		row.Version = res.Value.Version + 1
+	} else if !errors.Is(res.Err, ErrKeyNotFound) {
+		return Result[any]{Err: res.Err}
+	}
+	return Result[any]{Err: lt.write(row)}
+}
+
+func (lt *LSMTable[K, V]) InsertIfAbsent(primaryKey K, data V) Result[bool] {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if res := lt.search(primaryKey); res.Err == nil {
+		return Result[bool]{Value: false}
+	} else if !errors.Is(res.Err, ErrKeyNotFound) {
+		return Result[bool]{Err: res.Err}
+	}
+	if err := lt.write(newRow(primaryKey, data)); err != nil {
+		return Result[bool]{Err: err}
+	}
+	return Result[bool]{Value: true}
+}
+
+// update writes the next version of an existing row.
+func (lt *LSMTable[K, V]) update(primaryKey K, updateFunc func(data V) V) Result[uint64] {
+	res := lt.search(primaryKey)
+	if res.Err != nil {
+		return Result[uint64]{Err: res.Err}
+	}
+	row := newRow(primaryKey, updateFunc(res.Value.Data))
+	row.Version = res.Value.Version + 1
+	return Result[uint64]{Value: row.Version, Err: lt.write(row)}
+}
+
+func (lt *LSMTable[K, V]) UpdateWithData(primaryKey K, data V) Result[any] {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	return Result[any]{Err: lt.update(primaryKey, func(V) V { return data }).Err}
+}
+
+func (lt *LSMTable[K, V]) UpdateWithFunc(primaryKey K, updateFunc func(data V) V) Result[any] {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	return Result[any]{Err: lt.update(primaryKey, updateFunc).Err}
+}
+
+// delete writes a tombstone for an existing row and returns the row.
+func (lt *LSMTable[K, V]) delete(primaryKey K) Result[DataRow[K, V]] {
+	res := lt.search(primaryKey)
+	if res.Err != nil {
+		return res
+	}
+	tombstone := DataRow[K, V]{PrimaryKey: primaryKey, Version: res.Value.Version + 1}
+	if err := lt.write(tombstone); err != nil {
+		return Result[DataRow[K, V]]{Err: err}
+	}
+	res.Value.IsValid = false
+	return res
+}
+
+func (lt *LSMTable[K, V]) Delete(primaryKey K) Result[DataRow[K, V]] {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	return lt.delete(primaryKey)
+}
+
+// CompareAndSwap replaces the row only if it is still at expectedVersion
+// and returns the new version.
+func (lt *LSMTable[K, V]) CompareAndSwap(primaryKey K, expectedVersion uint64, data V) Result[uint64] {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if err := lt.checkVersion(primaryKey, expectedVersion); err != nil {
+		return Result[uint64]{Err: err}
+	}
+	return lt.update(primaryKey, func(V) V { return data })
+}
+
+// CompareAndDelete deletes the row only if it is still at expectedVersion.
+func (lt *LSMTable[K, V]) CompareAndDelete(primaryKey K, expectedVersion uint64) Result[DataRow[K, V]] {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if err := lt.checkVersion(primaryKey, expectedVersion); err != nil {
+		return Result[DataRow[K, V]]{Err: err}
+	}
+	return lt.delete(primaryKey)
+}
+
+func (lt *LSMTable[K, V]) checkVersion(primaryKey K, expectedVersion uint64) error {
+	res := lt.search(primaryKey)
+	if res.Err != nil {
+		return res.Err
+	}
+	if res.Value.Version != expectedVersion {
+		return &ConflictError{Key: primaryKey, Expected: expectedVersion, Actual: res.Value.Version}
+	}
+	return nil
+}
+
+// scan streams the live rows from start, or from the first key when start
+// is nil, up to end, exclusive, or the last key when end is nil. The
+// memtables are copied and the tables pinned when it starts, so it sees
+// the table as of that moment.
+func (lt *LSMTable[K, V]) scan(ctx context.Context, start, end *K) <-chan Result[DataRow[K, V]] {
+	resultsChan := make(chan Result[DataRow[K, V]])
+
+	lt.mu.Lock()
+	if lt.closed {
+		lt.mu.Unlock()
+		go func() {
+			resultsChan <- Result[DataRow[K, V]]{Err: ErrTableClosed}
+			close(resultsChan)
+		}()
+		return resultsChan
+	}
+	var sources []rowIterator[K, V]
+	for _, m := range []*memtable[K, V]{lt.mem, lt.imm} {
+		if m == nil {
+			continue
+		}
+		rows := m.sorted()
+		if start != nil && end != nil {
+			rows = m.between(*start, *end)
+		}
+		sources = append(sources, &sliceIterator[K, V]{rows: rows})
+	}
+	var pinned []*sstable[K, V]
+	for level, tables := range lt.levels {
+		if level == 0 {
+			for _, t := range tables {
+				sources = append(sources, newLevelIterator([]*sstable[K, V]{t}, lt.Compare, start))
+			}
+		} else if len(tables) > 0 {
+			sources = append(sources, newLevelIterator(tables, lt.Compare, start))
+		}
+		for _, t := range tables {
+			t.refs++
+			pinned = append(pinned, t)
+		}
+	}
+	lt.mu.Unlock()
+
+	go func() {
+		defer close(resultsChan)
+		defer lt.unpin(pinned)
+
+		it := newMergeIterator(lt.Compare, sources...)
+		for {
+			row, ok, err := it.next()
+			if err != nil {
+				resultsChan <- Result[DataRow[K, V]]{Err: err}
+				return
+			}
+			if !ok || (end != nil && lt.Compare(row.PrimaryKey, *end) >= 0) {
+				return
+			}
+			if !row.IsValid || (start != nil && lt.Compare(row.PrimaryKey, *start) < 0) {
+				continue
+			}
+			select {
+			case resultsChan <- Result[DataRow[K, V]]{Value: row}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return resultsChan
+}
+
+func (lt *LSMTable[K, V]) unpin(tables []*sstable[K, V]) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	for _, t := range tables {
+		t.refs--
+		if t.refs == 0 && t.obsolete {
+			t.close()
+			os.Remove(t.path)
+		}
+	}
+}
+
+// retire removes tables replaced by a compaction once no scan reads them.
+// It is called with lt.mu held.
+func (lt *LSMTable[K, V]) retire(tables []*sstable[K, V]) {
+	for _, t := range tables {
+		t.obsolete = true
+		if t.refs == 0 {
+			t.close()
+			os.Remove(t.path)
+		}
+	}
+}
+
+func (lt *LSMTable[K, V]) GetAll() <-chan Result[DataRow[K, V]] {
+	return lt.scan(context.Background(), nil, nil)
+}
+
+// GetAllContext is GetAll that stops, closing the channel and unpinning the
+// tables it reads, once ctx is done.
+func (lt *LSMTable[K, V]) GetAllContext(ctx context.Context) <-chan Result[DataRow[K, V]] {
+	return lt.scan(ctx, nil, nil)
+}
+
+// Range streams the rows with keys from start up to end, exclusive.
+func (lt *LSMTable[K, V]) Range(start, end K) <-chan Result[DataRow[K, V]] {
+	return lt.scan(context.Background(), &start, &end)
+}
+
+// RangeContext is Range that stops once ctx is done.
+func (lt *LSMTable[K, V]) RangeContext(ctx context.Context, start, end K) <-chan Result[DataRow[K, V]] {
+	return lt.scan(ctx, &start, &end)
+}
+
+// Len estimates the number of rows without reading the tables. Overwritten
+// and deleted rows are counted until compaction drops them.
+func (lt *LSMTable[K, V]) Len() int {
+	lt.mu.RLock()
+	defer lt.mu.RUnlock()
+
+	n := lt.mem.rows.Len()
+	if lt.imm != nil {
+		n += lt.imm.rows.Len()
+	}
+	for _, tables := range lt.levels {
+		for _, t := range tables {
+			n += t.meta.Rows
+		}
+	}
+	return n
+}
+
+func (lt *LSMTable[K, V]) Keys() []K {
+	var keys []K
+	for res := range lt.GetAll() {
+		if res.Err != nil {
+			continue
+		}
+		keys = append(keys, res.Value.PrimaryKey)
+	}
+	return keys
+}
+
+func (lt *LSMTable[K, V]) Where(filter func(DataRow[K, V]) bool) Result[[]K] {
+	var keys []K
+	for res := range lt.GetAll() {
+		if res.Err != nil {
+			return Result[[]K]{Err: res.Err}
+		}
+		if filter(res.Value) {
+			keys = append(keys, res.Value.PrimaryKey)
+		}
+	}
+	return Result[[]K]{Value: keys}
+}
+
+func (lt *LSMTable[K, V]) GetFromKeys(keys []K) Result[[]DataRow[K, V]] {
+	var rows []DataRow[K, V]
+	for _, key := range keys {
+		res := lt.Search(key)
+		if res.Err != nil {
+			return Result[[]DataRow[K, V]]{Err: res.Err}
+		}
+		rows = append(rows, res.Value)
+	}
+	return Result[[]DataRow[K, V]]{Value: rows}
+}
+
+func (lt *LSMTable[K, V]) Select(keys []K, resultType interface{}) chan Result[interface{}] {
+	result := make(chan Result[interface{}])
+	resType := reflect.TypeOf(resultType)
+	go func() {
+		defer close(result)
+		for _, k := range keys {
+			res := lt.Search(k)
+			if res.Err != nil {
+				result <- Result[interface{}]{Err: res.Err}
+				continue
+			}
+			projected, err := ProjectRow(res.Value, resType)
+			if err != nil {
+				result <- Result[interface{}]{Err: err}
+				continue
+			}
+			result <- Result[interface{}]{Value: projected}
+		}
+	}()
+	return result
+}
+
+// background flushes immutable memtables and compacts levels until the
+// table is closed.
+func (lt *LSMTable[K, V]) background() {
+	for {
+		select {
+		case <-lt.done:
+			return
+		case <-lt.work:
+		}
+		lt.compactMu.Lock()
+		var err error
+		for !lt.isClosed() {
+			// a memtable filled during a long compaction is flushed first
+			if err = lt.flushImm(); err != nil {
+				break
+			}
+			var compacted bool
+			if compacted, err = lt.compactStep(); err != nil || !compacted {
+				break
+			}
+		}
+		lt.compactMu.Unlock()
+		if err != nil {
+			lt.mu.Lock()
+			if lt.bgErr == nil {
+				lt.bgErr = err
+			}
+			lt.flushed.Broadcast()
+			lt.mu.Unlock()
+		}
+	}
+}
+
+func (lt *LSMTable[K, V]) isClosed() bool {
+	lt.mu.RLock()
+	defer lt.mu.RUnlock()
+
+	return lt.closed
+}
+
+// flushImm writes the immutable memtable to a level 0 table. It is called
+// with compactMu held.
+func (lt *LSMTable[K, V]) flushImm() error {
+	lt.mu.Lock()
+	imm := lt.imm
+	var num uint64
+	if imm != nil {
+		num = lt.nextFile()
+	}
+	lt.mu.Unlock()
+	if imm == nil {
+		return nil
+	}
+
+	var t *sstable[K, V]
+	if imm.rows.Len() > 0 {
+		w, err := newSSTWriter[K, V](lt.name, num, lt.options.bloomRate)
+		if err != nil {
+			return err
+		}
+		for _, row := range imm.sorted() {
+			if err := w.add(row); err != nil {
+				w.abort()
+				return err
+			}
+		}
+		if t, err = w.finish(); err != nil {
+			return err
+		}
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if t != nil {
+		lt.levels[0] = append([]*sstable[K, V]{t}, lt.levels[0]...)
+	}
+	lt.imm = nil
+	if lt.mem != nil {
+		lt.manifest.LogNumber = lt.mem.logNum
+	}
+	lt.setManifestLevels()
+	err := lt.saveManifest()
+	if imm.logFile != nil {
+		imm.logFile.Close()
+		os.Remove(imm.logFile.Name())
+	}
+	lt.stats.Flushes++
+	lt.flushed.Broadcast()
+	return err
+}
+
+func (lt *LSMTable[K, V]) setManifestLevels() {
+	for level, tables := range lt.levels {
+		nums := make([]uint64, len(tables))
+		for i, t := range tables {
+			nums[i] = t.num
+		}
+		lt.manifest.Levels[level] = nums
+	}
+}
+
+// compactStep runs one compaction if a level is over its limit and reports
+// whether it did. It is called with compactMu held.
+func (lt *LSMTable[K, V]) compactStep() (bool, error) {
+	lt.mu.RLock()
+	level := -1
+	if len(lt.levels[0]) >= l0CompactionTrigger {
+		level = 0
+	} else {
+		limit := int64(levelBaseSize)
+		for l := 1; l < lsmLevels-1; l++ {
+			if levelBytes(lt.levels[l]) > limit {
+				level = l
+				break
+			}
+			limit *= levelSizeRatio
+		}
+	}
+	var inputs []*sstable[K, V]
+	if level == 0 {
+		inputs = append(inputs, lt.levels[0]...)
+	} else if level > 0 {
+		// the oldest table, which is the first in key order, moves down
+		inputs = append(inputs, lt.levels[level][0])
+	}
+	lt.mu.RUnlock()
+	if level < 0 {
+		return false, nil
+	}
+	return true, lt.compact(level, inputs)
+}
+
+func levelBytes[K comparable, V any](tables []*sstable[K, V]) int64 {
+	var n int64
+	for _, t := range tables {
+		n += t.size
+	}
+	return n
+}
+
+// compact merges inputs from level with the overlapping tables of the
+// next level into new tables of the next level. It is called with
+// compactMu held; only it and flushImm change the levels.
+func (lt *LSMTable[K, V]) compact(level int, inputs []*sstable[K, V]) error {
+	lt.mu.RLock()
+	min, max := inputs[0].meta.Min, inputs[0].meta.Max
+	for _, t := range inputs[1:] {
+		if lt.Compare(t.meta.Min, min) < 0 {
+			min = t.meta.Min
+		}
+		if lt.Compare(t.meta.Max, max) > 0 {
+			max = t.meta.Max
+		}
+	}
+	var overlapping []*sstable[K, V]
+	for _, t := range lt.levels[level+1] {
+		if t.overlaps(min, max, lt.Compare) {
+			overlapping = append(overlapping, t)
+		}
+	}
+	// tombstones can go once nothing older lies below the output
+	bottom := true
+	for _, tables := range lt.levels[level+2:] {
+		if len(tables) > 0 {
+			bottom = false
+		}
+	}
+	lt.mu.RUnlock()
+
+	var sources []rowIterator[K, V]
+	for _, t := range inputs {
+		sources = append(sources, newLevelIterator([]*sstable[K, V]{t}, lt.Compare, nil))
+	}
+	sources = append(sources, newLevelIterator(overlapping, lt.Compare, nil))
+	outputs, err := lt.writeTables(newMergeIterator(lt.Compare, sources...), bottom)
+	if err != nil {
+		return err
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	replaced := append(append([]*sstable[K, V](nil), inputs...), overlapping...)
+	lt.levels[level] = without(lt.levels[level], inputs)
+	next := append(without(lt.levels[level+1], overlapping), outputs...)
+	sort.Slice(next, func(i, j int) bool {
+		return lt.Compare(next[i].meta.Min, next[j].meta.Min) < 0
+	})
+	lt.levels[level+1] = next
+	lt.setManifestLevels()
+	if err := lt.saveManifest(); err != nil {
+		return err
+	}
+	lt.retire(replaced)
+	lt.stats.Compactions++
+	return nil
+}
+
+func without[K comparable, V any](tables, remove []*sstable[K, V]) []*sstable[K, V] {
+	var kept []*sstable[K, V]
+	for _, t := range tables {
+		gone := false
+		for _, r := range remove {
+			gone = gone || t == r
+		}
+		if !gone {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+// writeTables writes the merged rows into tables of about targetTableSize,
+// dropping tombstones when dropDeleted is set.
+func (lt *LSMTable[K, V]) writeTables(it rowIterator[K, V], dropDeleted bool) ([]*sstable[K, V], error) {
+	var outputs []*sstable[K, V]
+	var w *sstWriter[K, V]
+	fail := func(err error) ([]*sstable[K, V], error) {
+		if w != nil {
+			w.abort()
+		}
+		for _, t := range outputs {
+			t.close()
+			os.Remove(t.path)
+		}
+		return nil, err
+	}
+
+	for {
+		row, ok, err := it.next()
+		if err != nil {
+			return fail(err)
+		}
+		if !ok {
+			break
+		}
+		if !row.IsValid && dropDeleted {
+			continue
+		}
+		if w == nil {
+			lt.mu.Lock()
+			num := lt.nextFile()
+			lt.mu.Unlock()
+			if w, err = newSSTWriter[K, V](lt.name, num, lt.options.bloomRate); err != nil {
+				return fail(err)
+			}
+		}
+		if err := w.add(row); err != nil {
+			return fail(err)
+		}
+		if w.size() >= targetTableSize {
+			t, err := w.finish()
+			w = nil
+			if err != nil {
+				return fail(err)
+			}
+			outputs = append(outputs, t)
+		}
+	}
+	if w != nil {
+		t, err := w.finish()
+		if err != nil {
+			return fail(err)
+		}
+		outputs = append(outputs, t)
+	}
+	return outputs, nil
+}
+
+// Compact flushes the memtable and merges every table into the deepest
+// level in use, dropping tombstones and overwritten rows.
+func (lt *LSMTable[K, V]) Compact() Result[any] {
+	lt.compactMu.Lock()
+	defer lt.compactMu.Unlock()
+
+	if err := lt.flushImm(); err != nil {
+		return Result[any]{Err: err}
+	}
+	lt.mu.Lock()
+	if lt.closed {
+		lt.mu.Unlock()
+		return Result[any]{Err: ErrTableClosed}
+	}
+	if lt.mem.rows.Len() > 0 {
+		mem, err := lt.newLoggedMemtable()
+		if err != nil {
+			lt.mu.Unlock()
+			return Result[any]{Err: err}
+		}
+		lt.imm, lt.mem = lt.mem, mem
+	}
+	lt.mu.Unlock()
+	if err := lt.flushImm(); err != nil {
+		return Result[any]{Err: err}
+	}
+
+	lt.mu.RLock()
+	target := 1
+	var inputs []*sstable[K, V]
+	for level, tables := range lt.levels {
+		if len(tables) > 0 {
+			target = max(target, level)
+		}
+	}
+	for level := 0; level < target; level++ {
+		inputs = append(inputs, lt.levels[level]...)
+	}
+	lt.mu.RUnlock()
+	if len(inputs) == 0 {
+		return Result[any]{}
+	}
+	// inputs are newest first: level 0 by age, then each level down
+	return Result[any]{Err: lt.compactInto(target, inputs)}
+}
+
+// compactInto merges inputs, newest first, with every table of target.
+func (lt *LSMTable[K, V]) compactInto(target int, inputs []*sstable[K, V]) error {
+	lt.mu.RLock()
+	existing := append([]*sstable[K, V](nil), lt.levels[target]...)
+	lt.mu.RUnlock()
+
+	var sources []rowIterator[K, V]
+	for _, t := range inputs {
+		sources = append(sources, newLevelIterator([]*sstable[K, V]{t}, lt.Compare, nil))
+	}
+	sources = append(sources, newLevelIterator(existing, lt.Compare, nil))
+	// target is the deepest level in use, so no older row is left below
+	outputs, err := lt.writeTables(newMergeIterator(lt.Compare, sources...), true)
+	if err != nil {
+		return err
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	for level := 0; level < target; level++ {
+		lt.levels[level] = without(lt.levels[level], inputs)
+	}
+	lt.levels[target] = outputs
+	lt.setManifestLevels()
+	if err := lt.saveManifest(); err != nil {
+		return err
+	}
+	lt.retire(append(inputs, existing...))
+	lt.stats.Compactions++
+	return nil
+}
+
+// Stats reports the size of the memtable and of each level.
+func (lt *LSMTable[K, V]) Stats() Result[LSMStats] {
+	lt.mu.RLock()
+	defer lt.mu.RUnlock()
+
+	stats := lt.stats
+	stats.MemtableBytes = lt.mem.size
+	stats.Levels = make([]LevelStats, lsmLevels)
+	for level, tables := range lt.levels {
+		for _, t := range tables {
+			stats.Levels[level].Tables++
+			stats.Levels[level].Rows += t.meta.Rows
+			stats.Levels[level].Bytes += t.size
+		}
+	}
+	return Result[LSMStats]{Value: stats}
+}
+
+// Close waits for a running flush or compaction and closes the table's
+// files. Rows still in the memtable are in its log and are flushed when the
+// table is next opened.
+func (lt *LSMTable[K, V]) Close() Result[any] {
+	lt.mu.Lock()
+	if lt.closed {
+		lt.mu.Unlock()
+		return Result[any]{}
+	}
+	lt.mu.Unlock()
+
+	close(lt.done)
+	lt.compactMu.Lock()
+	defer lt.compactMu.Unlock()
+
+	err := lt.flushImm()
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if err == nil && lt.mem.log != nil {
+		err = lt.mem.log.Flush()
+	}
+	lt.closed = true
+	lt.flushed.Broadcast()
+	lt.closeFiles()
+	if err == nil {
+		err = lt.bgErr
+	}
+	return Result[any]{Err: err}
+}
+
+func (lt *LSMTable[K, V]) closeFiles() {
+	if lt.mem != nil && lt.mem.logFile != nil {
+		lt.mem.logFile.Close()
+	}
+	for _, tables := range lt.levels {
+		for _, t := range tables {
+			t.close()
+		}
+	}
+}
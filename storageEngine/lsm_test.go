@@ -0,0 +1,392 @@
+package storageEngine
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func openLSM(t *testing.T, name string, opts ...Option) *LSMTable[int, logRow] {
+	t.Helper()
+	lt, err := NewLSMTable[int, logRow](cmp.Compare[int], name, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lt.Close() })
+	return lt
+}
+
+// waitIdle waits until the immutable memtable is flushed and the background
+// goroutine is not compacting.
+func waitIdle(lt *LSMTable[int, logRow]) {
+	for {
+		lt.compactMu.Lock()
+		lt.compactMu.Unlock()
+		lt.mu.RLock()
+		idle := lt.imm == nil
+		lt.mu.RUnlock()
+		if idle {
+			return
+		}
+	}
+}
+
+// flushMem hands the memtable to the background goroutine and waits until
+// it is in level 0.
+func flushMem(t *testing.T, lt *LSMTable[int, logRow]) {
+	t.Helper()
+	lt.mu.Lock()
+	err := lt.rotate()
+	lt.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitIdle(lt)
+}
+
+// compactLevel merges level into the one below it, as the background
+// goroutine does once a level is full.
+func compactLevel(t *testing.T, lt *LSMTable[int, logRow], level int) {
+	t.Helper()
+	waitIdle(lt)
+	lt.compactMu.Lock()
+	defer lt.compactMu.Unlock()
+	lt.mu.RLock()
+	inputs := append([]*sstable[int, logRow](nil), lt.levels[level]...)
+	lt.mu.RUnlock()
+	if err := lt.compact(level, inputs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func levelRows(t *testing.T, lt *LSMTable[int, logRow]) []int {
+	t.Helper()
+	stats := lt.Stats()
+	if stats.Err != nil {
+		t.Fatal(stats.Err)
+	}
+	rows := make([]int, len(stats.Value.Levels))
+	for i, l := range stats.Value.Levels {
+		rows[i] = l.Rows
+	}
+	return rows
+}
+
+// checkRows fails unless the table holds exactly want, in key order.
+func checkRows(t *testing.T, rows <-chan Result[DataRow[int, logRow]], want map[int]string, start, end int) {
+	t.Helper()
+	var got []DataRow[int, logRow]
+	for res := range rows {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		got = append(got, res.Value)
+	}
+	i := 0
+	for key := start; key < end; key++ {
+		name, ok := want[key]
+		if !ok {
+			continue
+		}
+		if i >= len(got) {
+			t.Fatalf("rows stop before key %d", key)
+		}
+		if got[i].PrimaryKey != key || got[i].Data.Name != name {
+			t.Fatalf("row %d = %d %q, want %d %q", i, got[i].PrimaryKey, got[i].Data.Name, key, name)
+		}
+		i++
+	}
+	if i != len(got) {
+		t.Fatalf("got %d rows, want %d", len(got), i)
+	}
+}
+
+func copyFiles(t *testing.T, pattern, dir string) {
+	t.Helper()
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		src, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst, err := os.Create(filepath.Join(dir, filepath.Base(path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			t.Fatal(err)
+		}
+		src.Close()
+		dst.Close()
+	}
+}
+
+func TestLSMReplaysLogAfterCrash(t *testing.T) {
+	dir, crashed := t.TempDir(), t.TempDir()
+	lt := openLSM(t, filepath.Join(dir, "lsm"))
+	want := map[int]string{}
+	for key := 1; key <= 50; key++ {
+		if res := lt.Insert(key, logRow{fmt.Sprint(key)}); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		want[key] = fmt.Sprint(key)
+	}
+	if res := lt.Upsert(10, logRow{"ten"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	want[10] = "ten"
+	if res := lt.Delete(20); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	delete(want, 20)
+
+	// the files as a crash would leave them: every write is in the log and
+	// none in a table, and the last record is torn
+	copyFiles(t, filepath.Join(dir, "lsm_*"), crashed)
+	logs, _ := filepath.Glob(filepath.Join(crashed, "lsm_*.log"))
+	if len(logs) != 1 {
+		t.Fatalf("found logs %v, want one", logs)
+	}
+	f, err := os.OpenFile(logs[0], os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(append(binary.AppendUvarint(nil, 200), "torn record"...))
+	f.Close()
+
+	name := filepath.Join(crashed, "lsm")
+	lt = openLSM(t, name)
+	checkRows(t, lt.GetAll(), want, 0, 100)
+	if rows := levelRows(t, lt); rows[0] != 50 {
+		t.Fatalf("level 0 holds %d rows after replay, want the 50 logged keys", rows[0])
+	}
+	if res := lt.Insert(51, logRow{"after"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	want[51] = "after"
+	if res := lt.Close(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	lt = openLSM(t, name)
+	checkRows(t, lt.GetAll(), want, 0, 100)
+	if logs, _ := filepath.Glob(name + "_*.log"); len(logs) != 1 {
+		t.Fatalf("replayed logs were kept: %v", logs)
+	}
+}
+
+func TestLSMTombstones(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "lsm")
+	lt := openLSM(t, name, WithMemtableSize(1<<20))
+	for _, key := range []int{1, 2} {
+		if res := lt.Insert(key, logRow{"old"}); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	if res := lt.Compact(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	compactLevel(t, lt, 1)
+	if rows := levelRows(t, lt); rows[2] != 2 {
+		t.Fatalf("level rows = %v, want both rows in level 2", rows)
+	}
+
+	// a tombstone in level 0 hides the value two levels down
+	if res := lt.Delete(1); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	flushMem(t, lt)
+	if res := lt.Search(1); !errors.Is(res.Err, ErrKeyNotFound) {
+		t.Fatalf("Search of a deleted key = %+v", res)
+	}
+	checkRows(t, lt.GetAll(), map[int]string{2: "old"}, 0, 10)
+
+	// compacted into level 1 it is kept, as level 2 still holds the value
+	compactLevel(t, lt, 0)
+	if rows := levelRows(t, lt); rows[0] != 0 || rows[1] != 1 || rows[2] != 2 {
+		t.Fatalf("level rows = %v, want the tombstone in level 1", rows)
+	}
+	if res := lt.Search(1); !errors.Is(res.Err, ErrKeyNotFound) {
+		t.Fatalf("Search after compacting the tombstone = %+v", res)
+	}
+
+	// at the bottom level it is dropped along with the value
+	if res := lt.Compact(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if rows := levelRows(t, lt); rows[1] != 0 || rows[2] != 1 {
+		t.Fatalf("level rows = %v, want only key 2 in level 2", rows)
+	}
+	if res := lt.Close(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	lt = openLSM(t, name)
+	if res := lt.Search(1); !errors.Is(res.Err, ErrKeyNotFound) {
+		t.Fatalf("Search after reopening = %+v", res)
+	}
+	checkRows(t, lt.GetAll(), map[int]string{2: "old"}, 0, 10)
+}
+
+func TestLSMReadsDuringCompaction(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "lsm")
+	lt := openLSM(t, name, WithMemtableSize(16<<10))
+	want := map[int]string{}
+	for key := 0; key < 500; key++ {
+		if res := lt.Insert(key, logRow{"stable"}); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		want[key] = "stable"
+	}
+
+	// readers check the stable keys while writes below them are flushed
+	// and compacted
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for key := 0; ; key = (key + 7) % 500 {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if res := lt.Search(key); res.Err != nil || res.Value.Data.Name != "stable" {
+				errs <- fmt.Errorf("Search(%d) = %+v", key, res)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			n := 0
+			for res := range lt.Range(100, 200) {
+				if res.Err != nil || res.Value.PrimaryKey != 100+n {
+					errs <- fmt.Errorf("Range row %d = %+v", n, res)
+					return
+				}
+				n++
+			}
+			if n != 100 {
+				errs <- fmt.Errorf("Range returned %d rows, want 100", n)
+				return
+			}
+		}
+	}()
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		key := 1000 + rng.Intn(2000)
+		if rng.Intn(4) == 0 {
+			lt.Delete(key)
+			delete(want, key)
+			continue
+		}
+		name := fmt.Sprint(i)
+		if res := lt.Upsert(key, logRow{name}); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		want[key] = name
+	}
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	waitIdle(lt)
+	if stats := lt.Stats(); stats.Err != nil || stats.Value.Compactions == 0 {
+		t.Fatalf("no background compaction ran: %+v", stats)
+	}
+	checkRows(t, lt.GetAll(), want, 0, 3000)
+	checkRows(t, lt.Range(1500, 2500), want, 1500, 2500)
+	if res := lt.Compact(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	checkRows(t, lt.GetAll(), want, 0, 3000)
+	for key := 0; key < 3000; key += 37 {
+		res := lt.Search(key)
+		if name, ok := want[key]; ok != (res.Err == nil) || (ok && res.Value.Data.Name != name) {
+			t.Fatalf("Search(%d) = %+v, want %q", key, res, name)
+		}
+	}
+
+	// the tables replaced by compactions are gone once no scan reads them
+	tables := 0
+	for _, l := range lt.Stats().Value.Levels {
+		tables += l.Tables
+	}
+	if files, _ := filepath.Glob(name + "_*.sst"); len(files) != tables {
+		t.Fatalf("%d table files for %d live tables", len(files), tables)
+	}
+
+	if res := lt.Close(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	lt = openLSM(t, name)
+	checkRows(t, lt.GetAll(), want, 0, 3000)
+}
+
+func TestLSMRangeAcrossLevels(t *testing.T) {
+	lt := openLSM(t, filepath.Join(t.TempDir(), "lsm"), WithMemtableSize(1<<20))
+	want := map[int]string{}
+	put := func(key int, name string) {
+		t.Helper()
+		if res := lt.Upsert(key, logRow{name}); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		want[key] = name
+	}
+
+	for key := 0; key < 100; key++ {
+		put(key, "level 2")
+	}
+	flushMem(t, lt)
+	compactLevel(t, lt, 0)
+	compactLevel(t, lt, 1)
+	for key := 0; key < 120; key += 2 {
+		put(key, "level 1")
+	}
+	flushMem(t, lt)
+	compactLevel(t, lt, 0)
+	for key := 0; key < 130; key += 3 {
+		put(key, "level 0")
+	}
+	flushMem(t, lt)
+	for key := 0; key < 140; key += 5 {
+		put(key, "memtable")
+	}
+	for _, key := range []int{7, 50, 126} {
+		if res := lt.Delete(key); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		delete(want, key)
+	}
+
+	if rows := levelRows(t, lt); rows[0] == 0 || rows[1] == 0 || rows[2] == 0 {
+		t.Fatalf("level rows = %v, want rows in levels 0 to 2", rows)
+	}
+	checkRows(t, lt.GetAll(), want, 0, 200)
+	checkRows(t, lt.Range(10, 60), want, 10, 60)
+	checkRows(t, lt.Range(95, 125), want, 95, 125)
+	checkRows(t, lt.Range(135, 1000), want, 135, 1000)
+	checkRows(t, lt.Range(60, 10), want, 0, 0)
+}
@@ -0,0 +1,463 @@
+package storageEngine
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"time"
+)
+
+var ErrSchemaMismatch = errors.New("schema mismatch")
+
+type migrationKind int
+
+const (
+	addColumn migrationKind = iota
+	dropColumn
+	renameColumn
+	changeType
+)
+
+// Migration is one step in the history of a table's row type. The steps
+// given to WithMigrations are applied in order, and the table's schema
+// version is the number of steps.
+type Migration struct {
+	kind    migrationKind
+	column  string
+	to      string
+	value   any
+	typ     reflect.Type
+	convert func(old any) (any, error)
+}
+
+// AddColumn adds a field; rows stored before it read value.
+func AddColumn(column string, value any) Migration {
+	return Migration{kind: addColumn, column: column, value: value, typ: reflect.TypeOf(value)}
+}
+
+func DropColumn(column string) Migration {
+	return Migration{kind: dropColumn, column: column}
+}
+
+func RenameColumn(column, to string) Migration {
+	return Migration{kind: renameColumn, column: column, to: to}
+}
+
+// ChangeType gives a field the type T, converting the values of rows
+// stored before the change.
+func ChangeType[T any](column string, convert func(old any) (T, error)) Migration {
+	return Migration{
+		kind:    changeType,
+		column:  column,
+		typ:     reflect.TypeOf((*T)(nil)).Elem(),
+		convert: func(old any) (any, error) { return convert(old) },
+	}
+}
+
+// WithMigrations declares the schema history of the row type. Rows stored
+// in an older layout are upgraded when read and rewritten in the current
+// one when next written, or all at once by UpgradeRows.
+func WithMigrations(migrations ...Migration) Option {
+	return func(o *tableOptions) {
+		o.migrations = migrations
+	}
+}
+
+// Column is a field as the stored schema records it.
+type Column struct {
+	Name string
+	Type string
+}
+
+// Layout is the row type rows of a schema version were written with.
+type Layout struct {
+	Version int
+	Columns []Column
+}
+
+// storedSchema is kept in <dbName>_schema.json and lists, oldest first, the
+// layouts rows may still be stored in.
+type storedSchema struct {
+	Layouts []Layout
+}
+
+// history is what the table needs to read rows of older layouts.
+type history struct {
+	version    int
+	migrations []Migration
+	layouts    []Layout
+	// legacy holds the row type of every older layout by version
+	legacy map[int]reflect.Type
+}
+
+func schemaFilePath(dbName string) string {
+	return dbName + "_schema.json"
+}
+
+func (m Migration) apply(columns []Column) ([]Column, error) {
+	i := columnIndex(columns, m.column)
+	if m.kind == addColumn {
+		if i >= 0 {
+			return nil, fmt.Errorf("AddColumn %s: the column exists", m.column)
+		}
+		if m.typ == nil {
+			return nil, fmt.Errorf("AddColumn %s: the default must not be nil", m.column)
+		}
+		return append(columns[:len(columns):len(columns)], Column{m.column, m.typ.String()}), nil
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("column %s does not exist", m.column)
+	}
+
+	out := append([]Column(nil), columns...)
+	switch m.kind {
+	case dropColumn:
+		out = append(out[:i], out[i+1:]...)
+	case renameColumn:
+		if columnIndex(columns, m.to) >= 0 {
+			return nil, fmt.Errorf("RenameColumn %s: column %s exists", m.column, m.to)
+		}
+		out[i].Name = m.to
+	case changeType:
+		out[i].Type = m.typ.String()
+	}
+	return out, nil
+}
+
+// upgrade applies the step to the fields of one stored row.
+func (m Migration) upgrade(values map[string]any) error {
+	switch m.kind {
+	case addColumn:
+		values[m.column] = m.value
+	case dropColumn:
+		delete(values, m.column)
+	case renameColumn:
+		values[m.to] = values[m.column]
+		delete(values, m.column)
+	case changeType:
+		converted, err := m.convert(values[m.column])
+		if err != nil {
+			return fmt.Errorf("converting %s: %w", m.column, err)
+		}
+		values[m.column] = converted
+	}
+	return nil
+}
+
+func columnIndex(columns []Column, name string) int {
+	for i, c := range columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func columnsOf(t reflect.Type) []Column {
+	var columns []Column
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.IsExported() {
+			columns = append(columns, Column{f.Name, f.Type.String()})
+		}
+	}
+	return columns
+}
+
+// loadHistory reads the stored schema, extends it with the migrations
+// declared since the last open and checks the result against V.
+func (dt *DataTable[K, V]) loadHistory(dbName string) error {
+	t := reflect.TypeOf((*V)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	migrations := dt.options.migrations
+
+	var stored storedSchema
+	data, err := os.ReadFile(schemaFilePath(dbName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return fmt.Errorf("%s: %w", schemaFilePath(dbName), err)
+		}
+	}
+
+	changed := false
+	if len(stored.Layouts) == 0 {
+		// rows stored before the schema was recorded are taken to match V
+		stored.Layouts = []Layout{{Version: len(migrations), Columns: columnsOf(t)}}
+		changed = true
+	}
+	last := stored.Layouts[len(stored.Layouts)-1]
+	if last.Version > len(migrations) {
+		return fmt.Errorf("%w: rows are at schema version %d but %d migrations are declared", ErrSchemaMismatch, last.Version, len(migrations))
+	}
+	for _, m := range migrations[last.Version:] {
+		columns, err := m.apply(last.Columns)
+		if err != nil {
+			return fmt.Errorf("%w: migration %d: %v", ErrSchemaMismatch, last.Version+1, err)
+		}
+		last = Layout{Version: last.Version + 1, Columns: columns}
+		stored.Layouts = append(stored.Layouts, last)
+		changed = true
+	}
+	if err := matchColumns(t, last.Columns); err != nil {
+		return err
+	}
+
+	if changed {
+		if err := saveSchema(dbName, stored); err != nil {
+			return err
+		}
+	}
+
+	dt.history = history{version: last.Version, migrations: migrations, layouts: stored.Layouts}
+	return dt.buildLegacy()
+}
+
+// matchColumns reports how V differs from the columns the stored schema and
+// migrations say rows have.
+func matchColumns(t reflect.Type, columns []Column) error {
+	current := columnsOf(t)
+	for _, c := range current {
+		i := columnIndex(columns, c.Name)
+		if i < 0 {
+			return fmt.Errorf("%w: %s.%s is not in the stored schema; declare it with AddColumn or RenameColumn", ErrSchemaMismatch, t.Name(), c.Name)
+		}
+		if columns[i].Type != c.Type {
+			return fmt.Errorf("%w: %s.%s is %s but stored as %s; declare the change with ChangeType", ErrSchemaMismatch, t.Name(), c.Name, c.Type, columns[i].Type)
+		}
+	}
+	for _, c := range columns {
+		if columnIndex(current, c.Name) < 0 {
+			return fmt.Errorf("%w: stored column %s is missing from %s; declare it with DropColumn or RenameColumn", ErrSchemaMismatch, c.Name, t.Name())
+		}
+	}
+	return nil
+}
+
+func saveSchema(dbName string, stored storedSchema) error {
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(schemaFilePath(dbName), data, 0644)
+}
+
+// buildLegacy makes a row type for each older layout out of the types the
+// table knows by name: basic types, V's field types and the types named by
+// migrations.
+func (dt *DataTable[K, V]) buildLegacy() error {
+	dt.history.legacy = nil
+	if len(dt.history.layouts) < 2 {
+		return nil
+	}
+
+	types := map[string]reflect.Type{}
+	for _, v := range []any{false, "", 0, int8(0), int16(0), int32(0), int64(0), uint(0), uint8(0), uint16(0),
+		uint32(0), uint64(0), float32(0), float64(0), []byte(nil), []string(nil), []int(nil), time.Time{}} {
+		types[reflect.TypeOf(v).String()] = reflect.TypeOf(v)
+	}
+	t := reflect.TypeOf((*V)(nil)).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		types[t.Field(i).Type.String()] = t.Field(i).Type
+	}
+	for _, m := range dt.history.migrations {
+		if m.typ != nil {
+			types[m.typ.String()] = m.typ
+		}
+	}
+
+	dt.history.legacy = map[int]reflect.Type{}
+	for _, layout := range dt.history.layouts[:len(dt.history.layouts)-1] {
+		fields := make([]reflect.StructField, len(layout.Columns))
+		for i, c := range layout.Columns {
+			ft, ok := types[c.Type]
+			if !ok {
+				return fmt.Errorf("%w: cannot read rows of schema version %d: unknown type %s of column %s", ErrSchemaMismatch, layout.Version, c.Type, c.Name)
+			}
+			fields[i] = reflect.StructField{Name: c.Name, Type: ft}
+		}
+		dt.history.legacy[layout.Version] = reflect.StructOf([]reflect.StructField{
+			{Name: "PrimaryKey", Type: reflect.TypeOf((*K)(nil)).Elem()},
+			{Name: "Data", Type: reflect.StructOf(fields)},
+			{Name: "IsValid", Type: reflect.TypeOf(false)},
+			{Name: "Version", Type: reflect.TypeOf(uint64(0))},
+			{Name: "ExpiresAt", Type: reflect.TypeOf(int64(0))},
+			{Name: "SchemaVersion", Type: reflect.TypeOf(0)},
+		})
+	}
+	return nil
+}
+
+// layoutOf returns the version whose layout a row of the given stored
+// version was written in. Rows from before the schema was recorded carry 0
+// and use the oldest layout.
+func (dt *DataTable[K, V]) layoutOf(version int) int {
+	if oldest := dt.history.layouts[0].Version; version < oldest {
+		return oldest
+	}
+	return version
+}
+
+// countingReader tells how many bytes a gob decode consumed. Implementing
+// io.ByteReader stops gob from buffering past the end of the record.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+func (dt *DataTable[K, V]) rowReader(offset int) *countingReader {
+	// ReadAt does not move the shared file offset, so concurrent readers
+	// holding the read lock do not interfere with each other.
+	return &countingReader{r: bufio.NewReader(io.NewSectionReader(dt.DataFile, int64(offset), math.MaxInt64-int64(offset)))}
+}
+
+// storedVersion returns the layout the row at offset was written in.
+func (dt *DataTable[K, V]) storedVersion(offset int) (int, error) {
+	var header struct {
+		IsValid       bool
+		SchemaVersion int
+	}
+	if _, _, err := dt.decodeRecord(offset, &header); err != nil {
+		return 0, err
+	}
+	return dt.layoutOf(header.SchemaVersion), nil
+}
+
+// readLegacy decodes a row written in an older layout and upgrades it.
+func (dt *DataTable[K, V]) readLegacy(offset, version int) (DataRow[K, V], error) {
+	var row DataRow[K, V]
+	stored := reflect.New(dt.history.legacy[version])
+	size, raw, err := dt.decodeRecord(offset, stored.Interface())
+	if err != nil {
+		return row, err
+	}
+	stored = stored.Elem()
+
+	row.PrimaryKey = stored.Field(0).Interface().(K)
+	row.IsValid = stored.Field(2).Bool()
+	row.Version = stored.Field(3).Uint()
+	row.ExpiresAt = stored.Field(4).Int()
+	row.SchemaVersion = dt.history.version
+	row.size = size
+	row.raw = raw
+
+	data := stored.Field(1)
+	values := make(map[string]any, data.NumField())
+	for i := 0; i < data.NumField(); i++ {
+		values[data.Type().Field(i).Name] = data.Field(i).Interface()
+	}
+	for _, m := range dt.history.migrations[version:] {
+		if err := m.upgrade(values); err != nil {
+			return row, fmt.Errorf("upgrading key %v: %w", row.PrimaryKey, err)
+		}
+	}
+
+	target := reflect.ValueOf(&row.Data).Elem()
+	for name, value := range values {
+		field := target.FieldByName(name)
+		v := reflect.ValueOf(value)
+		switch {
+		case !field.IsValid() || value == nil:
+			continue
+		case v.Type().AssignableTo(field.Type()):
+			field.Set(v)
+		case v.Type().ConvertibleTo(field.Type()):
+			field.Set(v.Convert(field.Type()))
+		default:
+			return row, fmt.Errorf("%w: upgrading key %v: %s is %s, want %s", ErrSchemaMismatch, row.PrimaryKey, name, v.Type(), field.Type())
+		}
+	}
+	return row, nil
+}
+
+// newRow stamps the row with the current schema version for writers that
+// encode it themselves.
+func (dt *DataTable[K, V]) newRow(key K, data V) DataRow[K, V] {
+	row := newRow(key, data)
+	row.SchemaVersion = dt.history.version
+	return row
+}
+
+// SchemaVersion is the number of migrations the table has applied.
+func (dt *DataTable[K, V]) SchemaVersion() int {
+	return dt.history.version
+}
+
+// UpgradeRows rewrites every row still stored in an older layout, after
+// which the older layouts are forgotten. It returns the number of rows
+// rewritten.
+func (dt *DataTable[K, V]) UpgradeRows() Result[int] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if len(dt.history.legacy) == 0 {
+		return Result[int]{}
+	}
+	if dt.backups > 0 {
+		return Result[int]{Err: ErrBackupInProgress}
+	}
+	if len(dt.snapshots) > 0 {
+		return Result[int]{Err: ErrSnapshotActive}
+	}
+
+	upgraded := 0
+	for _, item := range dt.IndexTable.GetAll() {
+		version, err := dt.storedVersion(item.Value)
+		if err != nil {
+			return Result[int]{Value: upgraded, Err: err}
+		}
+		if version == dt.history.version {
+			continue
+		}
+		res := dt.delete(item.Key)
+		if res.Err != nil {
+			return Result[int]{Value: upgraded, Err: res.Err}
+		}
+		row := res.Value
+		row.IsValid = true
+		if res := dt.insertRow(row); res.Err != nil {
+			return Result[int]{Value: upgraded, Err: res.Err}
+		}
+		upgraded++
+	}
+	if res := dt.saveIndex(); res.Err != nil {
+		return Result[int]{Value: upgraded, Err: res.Err}
+	}
+	return Result[int]{Value: upgraded, Err: dt.forgetLayouts()}
+}
+
+// forgetLayouts drops the older layouts once no row uses them.
+func (dt *DataTable[K, V]) forgetLayouts() error {
+	if len(dt.history.layouts) < 2 {
+		return nil
+	}
+	current := dt.history.layouts[len(dt.history.layouts)-1]
+	if err := saveSchema(dt.name(), storedSchema{Layouts: []Layout{current}}); err != nil {
+		return err
+	}
+	dt.history.layouts = []Layout{current}
+	dt.history.legacy = nil
+	return nil
+}
@@ -0,0 +1,166 @@
+package storageEngine
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type personV0 struct {
+	Name string
+	Age  int
+	Nick string
+}
+
+type personV4 struct {
+	FullName string
+	Age      int64
+	Email    string
+}
+
+var personMigrations = []Migration{
+	RenameColumn("Name", "FullName"),
+	DropColumn("Nick"),
+	ChangeType("Age", func(old any) (int64, error) {
+		if age := old.(int); age >= 0 {
+			return int64(age), nil
+		}
+		return 0, fmt.Errorf("negative age")
+	}),
+	AddColumn("Email", "unknown"),
+}
+
+func writePeopleV0(t *testing.T, name string, people map[int]personV0) {
+	t.Helper()
+	dt, err := NewDataTable[int, personV0](cmp.Compare[int], name, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, p := range people {
+		if res := dt.Insert(key, p); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	if res := dt.SaveIndex(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	dt.Close()
+}
+
+func openPeopleV4(t *testing.T, name string) (*DataTable[int, personV4], error) {
+	t.Helper()
+	dt, err := NewDataTable[int, personV4](cmp.Compare[int], name, 4, WithMigrations(personMigrations...))
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() { dt.Close() })
+	if res := dt.LoadIndex(dt.IndexFile.Name()); res.Err != nil {
+		return nil, res.Err
+	}
+	return dt, nil
+}
+
+func TestMigrationUpgradesRowsLazily(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "people")
+	writePeopleV0(t, name, map[int]personV0{
+		1: {Name: "ada", Age: 36, Nick: "countess"},
+		2: {Name: "bob", Age: 40},
+		3: {Name: "cy", Age: 7},
+	})
+
+	if _, err := NewDataTable[int, personV4](cmp.Compare[int], name, 4); !errors.Is(err, ErrSchemaMismatch) {
+		t.Fatalf("opening a changed row type without migrations = %v, want ErrSchemaMismatch", err)
+	}
+	dt, err := openPeopleV4(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := dt.SchemaVersion(); v != 4 {
+		t.Fatalf("SchemaVersion = %d, want 4", v)
+	}
+	stored := func(key int) int {
+		t.Helper()
+		offset, _ := dt.IndexTable.Search(key)
+		version, err := dt.storedVersion(offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return version
+	}
+
+	// reading upgrades the row without rewriting it
+	if res := dt.Search(1); res.Err != nil || res.Value.Data != (personV4{FullName: "ada", Age: 36, Email: "unknown"}) {
+		t.Fatalf("Search of an old row = %+v", res)
+	}
+	if v := stored(1); v != 0 {
+		t.Fatalf("row 1 is stored at version %d after a read, want 0", v)
+	}
+	// writing stores it in the current layout
+	if res := dt.Upsert(2, personV4{FullName: "bob", Age: 41, Email: "bob@example.com"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if v := stored(2); v != 4 {
+		t.Fatalf("row 2 is stored at version %d after a write, want 4", v)
+	}
+
+	if res := dt.UpgradeRows(); res.Err != nil || res.Value != 2 {
+		t.Fatalf("UpgradeRows = %+v, want rows 1 and 3 rewritten", res)
+	}
+	if v := stored(3); v != 4 {
+		t.Fatalf("row 3 is stored at version %d after UpgradeRows", v)
+	}
+	dt.Close()
+
+	dt, err = openPeopleV4(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dt.history.layouts) != 1 {
+		t.Fatalf("%d layouts kept after upgrading every row", len(dt.history.layouts))
+	}
+	want := map[int]personV4{
+		1: {FullName: "ada", Age: 36, Email: "unknown"},
+		2: {FullName: "bob", Age: 41, Email: "bob@example.com"},
+		3: {FullName: "cy", Age: 7, Email: "unknown"},
+	}
+	for key, p := range want {
+		if res := dt.Search(key); res.Err != nil || res.Value.Data != p {
+			t.Fatalf("Search(%d) after reopening = %+v, want %+v", key, res, p)
+		}
+	}
+}
+
+func TestMigrationFailureIsAnError(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "people")
+	writePeopleV0(t, name, map[int]personV0{
+		1: {Name: "ada", Age: 36},
+		2: {Name: "nobody", Age: -1},
+	})
+	dt, err := openPeopleV4(t, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res := dt.Search(2); res.Err == nil || !strings.Contains(res.Err.Error(), "negative age") {
+		t.Fatalf("Search of a row that cannot be upgraded = %+v", res)
+	}
+	if res := dt.Search(1); res.Err != nil {
+		t.Fatalf("Search of a good row = %v", res.Err)
+	}
+	if res := dt.UpgradeRows(); res.Err == nil {
+		t.Fatal("UpgradeRows skipped a row that cannot be upgraded")
+	}
+	if keys := dt.Keys(); len(keys) != 2 {
+		t.Fatalf("keys after a failed upgrade = %v, want both rows kept", keys)
+	}
+	failed := false
+	for res := range dt.GetAll() {
+		failed = failed || res.Err != nil
+	}
+	if !failed {
+		t.Fatal("GetAll hid the failed upgrade")
+	}
+}
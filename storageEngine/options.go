@@ -0,0 +1,33 @@
+package storageEngine
+
+type Option func(*tableOptions)
+
+type tableOptions struct {
+	mutationLog bool
+	clock       Clock
+	migrations  []Migration
+	ulidKeys    bool
+
+	compression          Compression
+	compressionThreshold int
+	keys                 KeyProvider
+	overflowThreshold    int
+	cacheBytes           int64
+	bloomRate            float64
+	memtableSize         int
+}
+
+// WithMutationLog records every committed mutation in <dbName>_wal.bin so a
+// backup can be rolled forward to a point in time.
+func WithMutationLog() Option {
+	return func(o *tableOptions) {
+		o.mutationLog = true
+	}
+}
+
+// WithClock sets the clock used to decide whether rows have expired.
+func WithClock(clock Clock) Option {
+	return func(o *tableOptions) {
+		o.clock = clock
+	}
+}
@@ -0,0 +1,589 @@
+package storageEngine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Rows larger than the overflow threshold and blobs are stored in fixed-size
+// chunks in <name>_overflow.bin, chained through the id of the next chunk.
+// Because every chunk has the same size, a freed chunk fits any later
+// allocation. A chunk starts with the next chunk id plus one (0 ends the
+// chain), the length of its body and a flag telling whether the body is
+// sealed with the table key.
+const (
+	chunkSize   = 64 << 10
+	chunkHeader = 8 + 4 + 1
+	// room a sealed body needs beyond its plaintext
+	sealReserve = 4 + binary.MaxVarintLen64 + nonceSize + 16
+
+	// DefaultOverflowThreshold is the stored size above which a row moves
+	// to overflow chunks.
+	DefaultOverflowThreshold = chunkSize
+)
+
+// An overflowed row is stored as frameOverflow, the uvarint length of the
+// record kept in the chunks and the uvarint id plus one of its first chunk.
+const frameOverflow byte = 0x83
+
+// WithOverflowThreshold moves rows whose stored record is larger than
+// threshold bytes to overflow chunks, leaving a small pointer in the data
+// file. A threshold of 0 keeps every row inline.
+func WithOverflowThreshold(threshold int) Option {
+	return func(o *tableOptions) {
+		o.overflowThreshold = threshold
+	}
+}
+
+type blobRef struct {
+	// First is the id plus one of the first chunk, 0 for an empty blob
+	First uint64
+	Size  int64
+}
+
+// overflowMeta is what <name>_blobs.bin holds.
+type overflowMeta[K comparable] struct {
+	Free  []uint64
+	Blobs map[K]blobRef
+}
+
+type overflowStore[K comparable] struct {
+	path   string
+	mu     sync.Mutex
+	file   *os.File
+	chunks uint64
+	free   []uint64
+	blobs  map[K]blobRef
+	// chains freed while a blob reader or snapshot may still read them
+	parked  []uint64
+	readers int
+}
+
+func overflowFilePath(name string) string {
+	return name + "_overflow.bin"
+}
+
+func blobsFilePath(name string) string {
+	return name + "_blobs.bin"
+}
+
+// openOverflow loads the chunk free list and blob directory. The overflow
+// file itself is created on first use.
+func (dt *DataTable[K, V]) openOverflow(dbName string) error {
+	o := &dt.overflow
+	o.path = overflowFilePath(dbName)
+	o.blobs = make(map[K]blobRef)
+
+	if info, err := os.Stat(o.path); err == nil {
+		if o.file, err = os.OpenFile(o.path, os.O_RDWR, 0644); err != nil {
+			return err
+		}
+		o.chunks = uint64((info.Size() + chunkSize - 1) / chunkSize)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	f, err := os.Open(blobsFilePath(dbName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil || info.Size() == 0 {
+		return err
+	}
+
+	r, err := dt.crypt.reader(f)
+	if err != nil {
+		return err
+	}
+	var meta overflowMeta[K]
+	if err := gob.NewDecoder(r).Decode(&meta); err != nil {
+		return err
+	}
+	o.free = meta.Free
+	if meta.Blobs != nil {
+		o.blobs = meta.Blobs
+	}
+	return nil
+}
+
+// saveOverflow persists the chunk free list and blob directory.
+func (dt *DataTable[K, V]) saveOverflow() error {
+	f, err := os.Create(blobsFilePath(dt.name()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return dt.writeOverflowMeta(f)
+}
+
+func (dt *DataTable[K, V]) writeOverflowMeta(f *os.File) error {
+	o := &dt.overflow
+	o.mu.Lock()
+	meta := overflowMeta[K]{Free: append([]uint64(nil), o.free...), Blobs: o.blobs}
+	// parked chains are only waiting for readers, which a reopen ends
+	for _, first := range o.parked {
+		ids, err := dt.chainIDs(first)
+		if err != nil {
+			o.mu.Unlock()
+			return err
+		}
+		meta.Free = append(meta.Free, ids...)
+	}
+	o.mu.Unlock()
+
+	w, finish := dt.crypt.writer(f)
+	if err := gob.NewEncoder(w).Encode(meta); err != nil {
+		return err
+	}
+	return finish()
+}
+
+func (dt *DataTable[K, V]) closeOverflow() error {
+	if dt.overflow.file == nil {
+		return nil
+	}
+	return dt.overflow.file.Close()
+}
+
+// chunkCapacity is how much data one chunk holds.
+func (dt *DataTable[K, V]) chunkCapacity() int {
+	if dt.crypt != nil {
+		return chunkSize - chunkHeader - sealReserve
+	}
+	return chunkSize - chunkHeader
+}
+
+func (dt *DataTable[K, V]) allocChunk() (uint64, error) {
+	o := &dt.overflow
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.file == nil {
+		f, err := os.OpenFile(o.path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return 0, err
+		}
+		o.file = f
+	}
+	if n := len(o.free); n > 0 {
+		id := o.free[n-1]
+		o.free = o.free[:n-1]
+		return id, nil
+	}
+	o.chunks++
+	return o.chunks - 1, nil
+}
+
+func chunkData(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
+
+func (dt *DataTable[K, V]) writeChunk(id uint64, plain []byte) error {
+	chunk := make([]byte, chunkHeader, chunkHeader+len(plain)+sealReserve)
+	if dt.crypt != nil {
+		var err error
+		if chunk, err = dt.crypt.seal(chunk, plain, chunkData(id)); err != nil {
+			return err
+		}
+		chunk[12] = 1
+	} else {
+		chunk = append(chunk, plain...)
+	}
+	binary.BigEndian.PutUint32(chunk[8:12], uint32(len(chunk)-chunkHeader))
+	_, err := dt.overflow.file.WriteAt(chunk, int64(id)*chunkSize)
+	return err
+}
+
+func (dt *DataTable[K, V]) setNext(id, next uint64) error {
+	_, err := dt.overflow.file.WriteAt(binary.BigEndian.AppendUint64(nil, next), int64(id)*chunkSize)
+	return err
+}
+
+func (dt *DataTable[K, V]) chunkHead(id uint64) (next uint64, n uint32, sealed bool, err error) {
+	var head [chunkHeader]byte
+	if _, err := dt.overflow.file.ReadAt(head[:], int64(id)*chunkSize); err != nil {
+		return 0, 0, false, err
+	}
+	return binary.BigEndian.Uint64(head[:8]), binary.BigEndian.Uint32(head[8:12]), head[12] == 1, nil
+}
+
+// readChunk returns the id plus one of the next chunk and the data of chunk id.
+func (dt *DataTable[K, V]) readChunk(id uint64) (uint64, []byte, error) {
+	if dt.overflow.file == nil {
+		return 0, nil, fmt.Errorf("overflow chunk %d does not exist", id)
+	}
+	chunk := make([]byte, chunkSize)
+	n, err := dt.overflow.file.ReadAt(chunk, int64(id)*chunkSize)
+	if err != nil && !(errors.Is(err, io.EOF) && n >= chunkHeader) {
+		return 0, nil, err
+	}
+	next := binary.BigEndian.Uint64(chunk[:8])
+	size := int(binary.BigEndian.Uint32(chunk[8:12]))
+	if chunkHeader+size > n {
+		return 0, nil, fmt.Errorf("overflow chunk %d is truncated", id)
+	}
+	body := chunk[chunkHeader : chunkHeader+size]
+	if chunk[12] != 1 {
+		return next, body, nil
+	}
+	if dt.crypt == nil {
+		return 0, nil, ErrEncrypted
+	}
+	plain, err := dt.crypt.open(bytes.NewReader(body), chunkData(id))
+	return next, plain, err
+}
+
+// chainIDs lists the chunks of the chain starting at first. The caller
+// holds o.mu.
+func (dt *DataTable[K, V]) chainIDs(first uint64) ([]uint64, error) {
+	var ids []uint64
+	for next := first; next != 0; {
+		if len(ids) > int(dt.overflow.chunks) {
+			return nil, fmt.Errorf("overflow chain at chunk %d loops", first-1)
+		}
+		id := next - 1
+		ids = append(ids, id)
+		var err error
+		if next, _, _, err = dt.chunkHead(id); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// releaseChain frees a chain no longer referenced, or parks it while blob
+// readers or snapshots may still read it. The caller holds dt.mu.
+func (dt *DataTable[K, V]) releaseChain(first uint64) error {
+	if first == 0 {
+		return nil
+	}
+	o := &dt.overflow
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.readers > 0 || len(dt.snapshots) > 0 {
+		o.parked = append(o.parked, first)
+		return nil
+	}
+	return dt.freeChain(first)
+}
+
+// freeChain returns the chunks of a chain to the free list. The caller
+// holds o.mu.
+func (dt *DataTable[K, V]) freeChain(first uint64) error {
+	ids, err := dt.chainIDs(first)
+	if err != nil {
+		return err
+	}
+	dt.overflow.free = append(dt.overflow.free, ids...)
+	return nil
+}
+
+// releaseParked frees parked chains once nothing can read them. The caller
+// holds dt.mu.
+func (dt *DataTable[K, V]) releaseParked() error {
+	o := &dt.overflow
+	o.mu.Lock()
+	if len(o.parked) == 0 || o.readers > 0 || len(dt.snapshots) > 0 {
+		o.mu.Unlock()
+		return nil
+	}
+	parked := o.parked
+	o.parked = nil
+	for _, first := range parked {
+		if err := dt.freeChain(first); err != nil {
+			o.mu.Unlock()
+			return err
+		}
+	}
+	o.mu.Unlock()
+	return dt.saveOverflow()
+}
+
+// chainWriter streams data into a new chain of chunks.
+type chainWriter[K comparable, V any] struct {
+	dt          *DataTable[K, V]
+	first, last uint64
+	buf         []byte
+	size        int64
+	err         error
+}
+
+func (w *chainWriter[K, V]) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf = append(w.buf, p...)
+	w.size += int64(len(p))
+	capacity := w.dt.chunkCapacity()
+	for len(w.buf) >= capacity {
+		if w.err = w.flush(w.buf[:capacity]); w.err != nil {
+			return 0, w.err
+		}
+		w.buf = w.buf[capacity:]
+	}
+	return len(p), nil
+}
+
+func (w *chainWriter[K, V]) flush(plain []byte) error {
+	id, err := w.dt.allocChunk()
+	if err != nil {
+		return err
+	}
+	if w.last == 0 {
+		w.first = id + 1
+	} else if err := w.dt.setNext(w.last-1, id+1); err != nil {
+		return err
+	}
+	w.last = id + 1
+	return w.dt.writeChunk(id, plain)
+}
+
+// finish writes what is buffered and returns the first chunk of the chain.
+func (w *chainWriter[K, V]) finish() (uint64, error) {
+	if w.err == nil && len(w.buf) > 0 {
+		w.err = w.flush(w.buf)
+		w.buf = nil
+	}
+	return w.first, w.err
+}
+
+// abort returns the chunks written so far to the free list.
+func (w *chainWriter[K, V]) abort() error {
+	if w.first == 0 {
+		return nil
+	}
+	o := &w.dt.overflow
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	first := w.first
+	w.first, w.last = 0, 0
+	return w.dt.freeChain(first)
+}
+
+// chainReader streams the data of a chain.
+type chainReader[K comparable, V any] struct {
+	dt   *DataTable[K, V]
+	next uint64
+	buf  []byte
+}
+
+func (r *chainReader[K, V]) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.next == 0 {
+			return 0, io.EOF
+		}
+		next, plain, err := r.dt.readChunk(r.next - 1)
+		if err != nil {
+			return 0, err
+		}
+		r.next, r.buf = next, plain
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// overflowRow moves a record too large for the data file to a chain and
+// returns the pointer stored in its place.
+func (dt *DataTable[K, V]) overflowRow(record []byte) ([]byte, error) {
+	w := &chainWriter[K, V]{dt: dt}
+	w.Write(record)
+	first, err := w.finish()
+	if err != nil {
+		w.abort()
+		return nil, err
+	}
+	if err := dt.saveOverflow(); err != nil {
+		return nil, err
+	}
+	pointer := []byte{frameOverflow}
+	pointer = binary.AppendUvarint(pointer, uint64(len(record)))
+	return binary.AppendUvarint(pointer, first), nil
+}
+
+// readOverflow reads an overflow pointer and returns the record it refers to.
+func (dt *DataTable[K, V]) readOverflow(reader *countingReader) ([]byte, error) {
+	size, first, err := readPointer(reader)
+	if err != nil {
+		return nil, err
+	}
+	record := make([]byte, 0, size)
+	buf := bytes.NewBuffer(record)
+	if _, err := io.Copy(buf, &chainReader[K, V]{dt: dt, next: first}); err != nil {
+		return nil, err
+	}
+	if uint64(buf.Len()) != size {
+		return nil, fmt.Errorf("overflow chain holds %d bytes, expected %d", buf.Len(), size)
+	}
+	return buf.Bytes(), nil
+}
+
+func readPointer(reader *countingReader) (size, first uint64, err error) {
+	if _, err = reader.ReadByte(); err != nil {
+		return 0, 0, err
+	}
+	if size, err = binary.ReadUvarint(reader); err != nil {
+		return 0, 0, err
+	}
+	first, err = binary.ReadUvarint(reader)
+	return size, first, err
+}
+
+// overflowOf returns the first chunk of the chain the row at offset
+// overflows into, or 0.
+func (dt *DataTable[K, V]) overflowOf(offset int) (uint64, error) {
+	reader := dt.rowReader(offset)
+	marker, err := reader.r.Peek(1)
+	if err != nil || marker[0] != frameOverflow {
+		return 0, err
+	}
+	_, first, err := readPointer(reader)
+	return first, err
+}
+
+// BlobWriter streams a blob into the table. The blob replaces any earlier
+// one under the same key when Close returns without error.
+type BlobWriter[K comparable, V any] struct {
+	key    K
+	w      chainWriter[K, V]
+	closed bool
+}
+
+// CreateBlob starts writing the blob stored under key. Blobs are kept apart
+// from rows and are not part of the mutation log.
+func (dt *DataTable[K, V]) CreateBlob(key K) Result[*BlobWriter[K, V]] {
+	return Result[*BlobWriter[K, V]]{Value: &BlobWriter[K, V]{key: key, w: chainWriter[K, V]{dt: dt}}}
+}
+
+func (b *BlobWriter[K, V]) Write(p []byte) (int, error) {
+	if b.closed {
+		return 0, os.ErrClosed
+	}
+	return b.w.Write(p)
+}
+
+// Close stores the blob.
+func (b *BlobWriter[K, V]) Close() error {
+	if b.closed {
+		return os.ErrClosed
+	}
+	b.closed = true
+	first, err := b.w.finish()
+	if err != nil {
+		b.w.abort()
+		return err
+	}
+
+	dt := b.w.dt
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	old, replaced := dt.overflow.blobs[b.key]
+	dt.overflow.blobs[b.key] = blobRef{First: first, Size: b.w.size}
+	if replaced {
+		if err := dt.releaseChain(old.First); err != nil {
+			return err
+		}
+	}
+	return dt.saveOverflow()
+}
+
+// Abort drops what was written without storing the blob.
+func (b *BlobWriter[K, V]) Abort() error {
+	if b.closed {
+		return os.ErrClosed
+	}
+	b.closed = true
+	return b.w.abort()
+}
+
+// BlobReader streams a stored blob. It sees the blob as it was when opened,
+// even if it is replaced or deleted meanwhile, until it is closed.
+type BlobReader[K comparable, V any] struct {
+	r      chainReader[K, V]
+	size   int64
+	closed bool
+}
+
+// OpenBlob opens the blob stored under key for reading.
+func (dt *DataTable[K, V]) OpenBlob(key K) Result[*BlobReader[K, V]] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	ref, found := dt.overflow.blobs[key]
+	if !found {
+		return Result[*BlobReader[K, V]]{Err: fmt.Errorf("%w: blob %v", ErrKeyNotFound, key)}
+	}
+	dt.overflow.mu.Lock()
+	dt.overflow.readers++
+	dt.overflow.mu.Unlock()
+	return Result[*BlobReader[K, V]]{Value: &BlobReader[K, V]{r: chainReader[K, V]{dt: dt, next: ref.First}, size: ref.Size}}
+}
+
+func (b *BlobReader[K, V]) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, os.ErrClosed
+	}
+	return b.r.Read(p)
+}
+
+// Size is the length of the blob in bytes.
+func (b *BlobReader[K, V]) Size() int64 {
+	return b.size
+}
+
+func (b *BlobReader[K, V]) Close() error {
+	if b.closed {
+		return os.ErrClosed
+	}
+	b.closed = true
+
+	dt := b.r.dt
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	dt.overflow.mu.Lock()
+	dt.overflow.readers--
+	dt.overflow.mu.Unlock()
+	return dt.releaseParked()
+}
+
+// DeleteBlob removes the blob stored under key.
+func (dt *DataTable[K, V]) DeleteBlob(key K) Result[any] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	ref, found := dt.overflow.blobs[key]
+	if !found {
+		return Result[any]{Err: fmt.Errorf("%w: blob %v", ErrKeyNotFound, key)}
+	}
+	delete(dt.overflow.blobs, key)
+	if err := dt.releaseChain(ref.First); err != nil {
+		return Result[any]{Err: err}
+	}
+	return Result[any]{Err: dt.saveOverflow()}
+}
+
+// BlobKeys returns the keys that have a blob, in key order.
+func (dt *DataTable[K, V]) BlobKeys() []K {
+	dt.mu.RLock()
+	defer dt.mu.RUnlock()
+
+	keys := make([]K, 0, len(dt.overflow.blobs))
+	for k := range dt.overflow.blobs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return dt.Compare(keys[i], keys[j]) < 0 })
+	return keys
+}
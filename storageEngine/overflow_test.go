@@ -0,0 +1,253 @@
+package storageEngine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// bigName is a row name spanning n chunks and part of another.
+func bigName(c string, n int) string {
+	return strings.Repeat(c, n*chunkSize+100)
+}
+
+// chainLen returns how many chunks the row under key overflows into.
+func chainLen(t *testing.T, dt *DataTable[int, logRow], key int) int {
+	t.Helper()
+	offset, found := dt.IndexTable.Search(key)
+	if !found {
+		t.Fatalf("key %d is not indexed", key)
+	}
+	first, err := dt.overflowOf(offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == 0 {
+		return 0
+	}
+	ids, err := dt.chainIDs(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(ids)
+}
+
+func wantName(t *testing.T, dt *DataTable[int, logRow], key int, name string) {
+	t.Helper()
+	res := dt.Search(key)
+	if res.Err != nil {
+		t.Fatalf("Search(%d): %v", key, res.Err)
+	}
+	if got := res.Value.Data.Name; got != name {
+		t.Fatalf("Search(%d) returned %d bytes, want %d", key, len(got), len(name))
+	}
+}
+
+func TestOverflowRowRoundTrip(t *testing.T) {
+	dt := newRowTable(t, WithOverflowThreshold(1024))
+	big := bigName("x", 3)
+	if res := dt.Insert(1, logRow{big}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res := dt.Insert(2, logRow{"small"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if n := chainLen(t, dt, 1); n != 4 {
+		t.Fatalf("a row of three chunks and a bit overflows into %d chunks", n)
+	}
+	if n := chainLen(t, dt, 2); n != 0 {
+		t.Fatalf("a small row overflows into %d chunks", n)
+	}
+	wantName(t, dt, 1, big)
+	wantName(t, dt, 2, "small")
+
+	if res := dt.SaveIndex(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	name := dt.name()
+	dt.Close()
+	dt, err := reopenSealed(t, name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantName(t, dt, 1, big)
+	wantName(t, dt, 2, "small")
+}
+
+func TestOverflowUpdateReusesChunks(t *testing.T) {
+	dt := newRowTable(t, WithOverflowThreshold(1024))
+	if res := dt.Insert(1, logRow{bigName("a", 2)}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	chunks := dt.overflow.chunks
+
+	if res := dt.Upsert(1, logRow{"inline"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	wantName(t, dt, 1, "inline")
+	if n := chainLen(t, dt, 1); n != 0 {
+		t.Fatalf("the updated row still overflows into %d chunks", n)
+	}
+	if free := len(dt.overflow.free); free != int(chunks) {
+		t.Fatalf("%d of %d chunks freed", free, chunks)
+	}
+
+	big := bigName("b", 2)
+	if res := dt.Upsert(1, logRow{big}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	wantName(t, dt, 1, big)
+	if dt.overflow.chunks != chunks || len(dt.overflow.free) != 0 {
+		t.Fatalf("overflowing again grew the file to %d chunks with %d free, want the %d freed reused",
+			dt.overflow.chunks, len(dt.overflow.free), chunks)
+	}
+
+	if res := dt.Delete(1); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if free := len(dt.overflow.free); free != int(chunks) {
+		t.Fatalf("deleting the row freed %d of %d chunks", free, chunks)
+	}
+}
+
+func writeBlob(t *testing.T, dt *DataTable[int, logRow], key int, data []byte) {
+	t.Helper()
+	w := dt.CreateBlob(key)
+	if w.Err != nil {
+		t.Fatal(w.Err)
+	}
+	// in pieces smaller than a chunk, as a stream would arrive
+	for rest := data; len(rest) > 0; {
+		n := min(len(rest), 10000)
+		if _, err := w.Value.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Value.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readBlob(t *testing.T, r *BlobReader[int, logRow]) []byte {
+	t.Helper()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(data)) != r.Size() {
+		t.Fatalf("read %d bytes of a blob of %d", len(data), r.Size())
+	}
+	return data
+}
+
+func TestBlobs(t *testing.T) {
+	dt := newRowTable(t)
+	first := bytes.Repeat([]byte("first "), 30000)
+	writeBlob(t, dt, 1, first)
+	writeBlob(t, dt, 2, []byte("kept"))
+
+	r := dt.OpenBlob(1)
+	if r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	if got := readBlob(t, r.Value); !bytes.Equal(got, first) {
+		t.Fatal("blob read back differs")
+	}
+
+	// a reader opened before a replacement keeps reading the old blob
+	old := dt.OpenBlob(1).Value
+	second := bytes.Repeat([]byte("second "), 20000)
+	writeBlob(t, dt, 1, second)
+	if got := readBlob(t, old); !bytes.Equal(got, first) {
+		t.Fatal("an open reader saw the replacement")
+	}
+	current := dt.OpenBlob(1).Value
+	if got := readBlob(t, current); !bytes.Equal(got, second) {
+		t.Fatal("replaced blob read back differs")
+	}
+	current.Close()
+	if len(dt.overflow.parked) == 0 {
+		t.Fatal("the replaced chain was freed under open readers")
+	}
+	r.Value.Close()
+	old.Close()
+
+	if res := dt.DeleteBlob(1); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res := dt.OpenBlob(1); !errors.Is(res.Err, ErrKeyNotFound) {
+		t.Fatalf("OpenBlob of a deleted blob = %v, want ErrKeyNotFound", res.Err)
+	}
+	if res := dt.DeleteBlob(1); !errors.Is(res.Err, ErrKeyNotFound) {
+		t.Fatalf("deleting a deleted blob = %v, want ErrKeyNotFound", res.Err)
+	}
+	// the two chains of blob 1 are free; blob 2 holds the remaining chunk
+	if free := len(dt.overflow.free); free != int(dt.overflow.chunks)-1 {
+		t.Fatalf("%d of %d chunks free, want all but one", free, dt.overflow.chunks)
+	}
+
+	if res := dt.SaveIndex(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	name := dt.name()
+	dt.Close()
+	dt, err := reopenSealed(t, name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := dt.BlobKeys(); len(keys) != 1 || keys[0] != 2 {
+		t.Fatalf("BlobKeys after reopening = %v, want [2]", keys)
+	}
+	kept := dt.OpenBlob(2).Value
+	defer kept.Close()
+	if got := readBlob(t, kept); string(got) != "kept" {
+		t.Fatalf("blob after reopening = %q", got)
+	}
+}
+
+func TestCompactKeepsOverflowRows(t *testing.T) {
+	dt := newRowTable(t, WithOverflowThreshold(1024))
+	want := map[int]string{}
+	for key := 1; key <= 6; key++ {
+		name := "small"
+		if key%2 == 1 {
+			name = bigName(string(rune('a'+key)), 1)
+		}
+		if res := dt.Insert(key, logRow{name}); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		want[key] = name
+	}
+	for _, key := range []int{3, 4} {
+		if res := dt.Delete(key); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		delete(want, key)
+	}
+
+	if res := dt.Compact(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	for key, name := range want {
+		wantName(t, dt, key, name)
+	}
+	// the chains read before compacting are free, and only the two big rows
+	// left hold chunks
+	used := chainLen(t, dt, 1) + chainLen(t, dt, 5)
+	if used != 4 || int(dt.overflow.chunks)-len(dt.overflow.free) != used {
+		t.Fatalf("%d chunks with %d free for %d in use", dt.overflow.chunks, len(dt.overflow.free), used)
+	}
+
+	name := dt.name()
+	dt.Close()
+	dt, err := reopenSealed(t, name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, name := range want {
+		wantName(t, dt, key, name)
+	}
+}
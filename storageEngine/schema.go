@@ -0,0 +1,286 @@
+package storageEngine
+
+import (
+	"ZeroStore/helper"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrConstraint   = errors.New("constraint violation")
+	ErrNoPrimaryKey = errors.New(`no field is tagged zerostore:"pk"`)
+)
+
+// Field is a struct field and what its zerostore tag declares, for example
+// `zerostore:"index,notnull,check=>0"`. Zero values stand in for null:
+// default fills them, notnull rejects them and unique ignores them.
+type Field struct {
+	Name       string
+	PrimaryKey bool
+	Index      bool
+	Unique     bool
+	NotNull    bool
+	// Default is nil when the field has none
+	Default any
+	Check   string
+
+	position int
+	check    func(value any) bool
+}
+
+type Schema struct {
+	Fields []Field
+	pk     int
+}
+
+// PrimaryKey returns the field tagged pk, if any.
+func (s *Schema) PrimaryKey() (Field, bool) {
+	if s.pk < 0 {
+		return Field{}, false
+	}
+	return s.Fields[s.pk], true
+}
+
+func (s *Schema) constrained() bool {
+	for _, f := range s.Fields {
+		if f.PrimaryKey || f.Index || f.Unique || f.NotNull || f.Default != nil || f.check != nil {
+			return true
+		}
+	}
+	return false
+}
+
+type parsedSchema struct {
+	schema *Schema
+	err    error
+}
+
+// schemas caches SchemaOf by type
+var schemas sync.Map
+
+// SchemaOf parses the zerostore tags of V once and returns the cached result
+// after that. Types other than structs have an empty schema.
+func SchemaOf[V any]() (*Schema, error) {
+	t := reflect.TypeOf((*V)(nil)).Elem()
+	if cached, ok := schemas.Load(t); ok {
+		p := cached.(parsedSchema)
+		return p.schema, p.err
+	}
+
+	s, err := parseSchema(t)
+	schemas.Store(t, parsedSchema{s, err})
+	return s, err
+}
+
+func parseSchema(t reflect.Type) (*Schema, error) {
+	s := &Schema{pk: -1}
+	if t.Kind() != reflect.Struct {
+		return s, nil
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f, err := parseField(t.Field(i))
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", t.Name(), t.Field(i).Name, err)
+		}
+		f.position = i
+		if f.PrimaryKey {
+			if s.pk >= 0 {
+				return nil, fmt.Errorf("%s: both %s and %s are tagged pk", t.Name(), s.Fields[s.pk].Name, f.Name)
+			}
+			s.pk = len(s.Fields)
+		}
+		s.Fields = append(s.Fields, f)
+	}
+	return s, nil
+}
+
+func parseField(sf reflect.StructField) (Field, error) {
+	f := Field{Name: sf.Name}
+	tag, ok := sf.Tag.Lookup("zerostore")
+	if !ok {
+		return f, nil
+	}
+	if !sf.IsExported() {
+		return f, errors.New("zerostore tags need an exported field")
+	}
+
+	for _, opt := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(opt), "=")
+		switch name {
+		case "pk":
+			f.PrimaryKey = true
+		case "index":
+			f.Index = true
+		case "unique":
+			f.Unique = true
+		case "notnull":
+			f.NotNull = true
+		case "default":
+			value, err := helper.ConvertValue(arg, sf.Type)
+			if err != nil {
+				return f, fmt.Errorf("default %q: %w", arg, err)
+			}
+			f.Default = value.Interface()
+		case "check":
+			check, err := parseCheck(arg, sf.Type)
+			if err != nil {
+				return f, err
+			}
+			f.Check, f.check = arg, check
+		case "":
+		default:
+			return f, fmt.Errorf("unknown zerostore tag option %q", name)
+		}
+	}
+	// indexed values are map keys, which must be comparable
+	if (f.Index || f.Unique) && !sf.Type.Comparable() {
+		return f, fmt.Errorf("index and unique need a comparable type, not %v", sf.Type)
+	}
+	return f, nil
+}
+
+// parseCheck turns an expression such as ">=18" or "!=admin" into a test of
+// the field's value.
+func parseCheck(expr string, t reflect.Type) (func(value any) bool, error) {
+	for _, op := range []string{">=", "<=", "!=", "==", ">", "<", "="} {
+		rest, ok := strings.CutPrefix(expr, op)
+		if !ok {
+			continue
+		}
+		operand, err := helper.ConvertValue(strings.TrimSpace(rest), t)
+		if err != nil {
+			return nil, fmt.Errorf("check %q: %w", expr, err)
+		}
+		want := operand.Interface()
+		return func(value any) bool {
+			cmp, err := helper.CompareValues(value, want)
+			if err != nil {
+				return false
+			}
+			switch op {
+			case ">=":
+				return cmp >= 0
+			case "<=":
+				return cmp <= 0
+			case "!=":
+				return cmp != 0
+			case ">":
+				return cmp > 0
+			case "<":
+				return cmp < 0
+			}
+			return cmp == 0
+		}, nil
+	}
+	return nil, fmt.Errorf("check %q: expected a comparison such as >0", expr)
+}
+
+func (dt *DataTable[K, V]) Schema() *Schema {
+	return dt.schema
+}
+
+// KeyOf returns the value of the field tagged pk.
+func (dt *DataTable[K, V]) KeyOf(data V) (K, error) {
+	pk, ok := dt.schema.PrimaryKey()
+	if !ok {
+		var zero K
+		return zero, ErrNoPrimaryKey
+	}
+	return reflect.ValueOf(data).Field(pk.position).Interface().(K), nil
+}
+
+// InsertData inserts data under the key held in its pk field.
+func (dt *DataTable[K, V]) InsertData(data V) Result[K] {
+	key, err := dt.KeyOf(data)
+	if err != nil {
+		return Result[K]{Err: err}
+	}
+	return Result[K]{Value: key, Err: dt.Insert(key, data).Err}
+}
+
+// useSchema checks the pk field has the key's type, creates the tagged
+// indexes and enforces the constraints through the write hooks.
+func (dt *DataTable[K, V]) useSchema(s *Schema) error {
+	dt.schema = s
+	if !s.constrained() {
+		return nil
+	}
+
+	t := reflect.TypeOf((*V)(nil)).Elem()
+	for _, f := range s.Fields {
+		if f.PrimaryKey && t.Field(f.position).Type != reflect.TypeOf((*K)(nil)).Elem() {
+			return fmt.Errorf("%s.%s is tagged pk but the table's keys are %v", t.Name(), f.Name, reflect.TypeOf((*K)(nil)).Elem())
+		}
+		if f.Index || f.Unique {
+			position := f.position
+			idx := &secondaryIndex[K, V]{
+				extract: func(data V) any { return reflect.ValueOf(data).Field(position).Interface() },
+				rate:    dt.options.bloomRate,
+			}
+			if err := dt.buildIndex(idx); err != nil {
+				return err
+			}
+			dt.indexes[f.Name] = idx
+		}
+	}
+
+	dt.hooks.beforeInsert = append(dt.hooks.beforeInsert, dt.applySchema)
+	dt.hooks.beforeUpdate = append(dt.hooks.beforeUpdate, func(key K, old, data V) (V, error) {
+		return dt.applySchema(key, data)
+	})
+	return nil
+}
+
+// applySchema copies the key into the pk field, fills defaults and checks
+// the row against the constraints.
+func (dt *DataTable[K, V]) applySchema(key K, data V) (V, error) {
+	v := reflect.ValueOf(&data).Elem()
+	for _, f := range dt.schema.Fields {
+		fv := v.Field(f.position)
+		if f.PrimaryKey {
+			fv.Set(reflect.ValueOf(key))
+			continue
+		}
+		if f.Default != nil && fv.IsZero() {
+			fv.Set(reflect.ValueOf(f.Default))
+		}
+		if f.NotNull && fv.IsZero() {
+			return data, fmt.Errorf("%w: %s is required", ErrConstraint, f.Name)
+		}
+		if f.check != nil && !f.check(fv.Interface()) {
+			return data, fmt.Errorf("%w: %s %v fails check %s", ErrConstraint, f.Name, fv.Interface(), f.Check)
+		}
+		if f.Unique && !fv.IsZero() {
+			for other := range dt.indexes[f.Name].keys[fv.Interface()] {
+				if other != key {
+					return data, fmt.Errorf("%w: %s %v is already used by key %v", ErrConstraint, f.Name, fv.Interface(), other)
+				}
+			}
+		}
+	}
+	return data, nil
+}
+
+// checkBatchUnique catches unique values repeated inside one batch, which
+// the indexes only see once the batch is written.
+func (dt *DataTable[K, V]) checkBatchUnique(seen map[string]map[any]bool, data V) error {
+	v := reflect.ValueOf(data)
+	for _, f := range dt.schema.Fields {
+		if !f.Unique || v.Field(f.position).IsZero() {
+			continue
+		}
+		value := v.Field(f.position).Interface()
+		if seen[f.Name] == nil {
+			seen[f.Name] = map[any]bool{}
+		}
+		if seen[f.Name][value] {
+			return fmt.Errorf("%w: %s %v appears twice in the batch", ErrConstraint, f.Name, value)
+		}
+		seen[f.Name][value] = true
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package storageEngine
+
+import (
+	"cmp"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type taggedRow struct {
+	Name string `zerostore:"index"`
+	Mail string `zerostore:"unique"`
+}
+
+func TestSchemaIndexesHaveBloomFilter(t *testing.T) {
+	dt, err := NewDataTable[int, taggedRow](cmp.Compare[int], filepath.Join(t.TempDir(), "tagged"), 8, WithBloomFilter(0.01))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dt.Close()
+	for key, name := range []string{"ada", "bob", "cy"} {
+		if res := dt.Insert(key, taggedRow{Name: name, Mail: name + "@example.com"}); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+
+	for _, index := range []string{"Name", "Mail"} {
+		if f := dt.indexes[index].filter; f == nil {
+			t.Fatalf("index %s has no Bloom filter", index)
+		}
+	}
+	if res := dt.Lookup("Name", "bob"); res.Err != nil || len(res.Value) != 1 || res.Value[0] != 1 {
+		t.Fatalf("Lookup bob = %+v", res)
+	}
+	before := dt.Stats().Value.BloomRejects
+	if res := dt.Lookup("Name", "nobody"); res.Err != nil || len(res.Value) != 0 {
+		t.Fatalf("Lookup nobody = %+v", res)
+	}
+	if after := dt.Stats().Value.BloomRejects; after != before+1 {
+		t.Fatalf("a missing value was not rejected by the filter: %d rejects, want %d", after, before+1)
+	}
+}
+
+func TestSchemaRejectsIncomparableIndex(t *testing.T) {
+	type tags struct {
+		Tags []string `zerostore:"index"`
+	}
+	type labels struct {
+		Labels map[string]string `zerostore:"unique"`
+	}
+	type fine struct {
+		Point [2]int `zerostore:"index"`
+		Tags  []string
+	}
+
+	if _, err := SchemaOf[tags](); err == nil || !strings.Contains(err.Error(), "tags.Tags") {
+		t.Fatalf("SchemaOf with an indexed slice = %v", err)
+	}
+	if _, err := SchemaOf[labels](); err == nil || !strings.Contains(err.Error(), "labels.Labels") {
+		t.Fatalf("SchemaOf with a unique map = %v", err)
+	}
+	if _, err := SchemaOf[fine](); err != nil {
+		t.Fatalf("SchemaOf with an indexed array = %v", err)
+	}
+	if _, err := NewDataTable[int, tags](cmp.Compare[int], filepath.Join(t.TempDir(), "tags"), 4); err == nil {
+		t.Fatal("NewDataTable accepted an indexed slice")
+	}
+}
@@ -0,0 +1,133 @@
+package storageEngine
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+var ErrIndexNotFound = errors.New("index not found")
+
+// A secondary index maps a value taken from each row to the keys of the rows
+// holding it. It lives in memory: CreateIndex builds it with one scan and
+// every write keeps it current from then on.
+type secondaryIndex[K comparable, V any] struct {
+	extract func(data V) any
+	keys    map[any]map[K]struct{}
+	// rows is the number of keys across all values
+	rows int
+	// filter holds every value indexed since the last build when the table
+	// has WithBloomFilter
+	filter *bloomFilter
+	rate   float64
+}
+
+// CreateIndex indexes the table by the value extract returns for each row.
+// The value must be comparable. Creating an index that exists is a no-op.
+func (dt *DataTable[K, V]) CreateIndex(name string, extract func(data V) any) Result[any] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if _, ok := dt.indexes[name]; ok {
+		return Result[any]{}
+	}
+
+	idx := &secondaryIndex[K, V]{extract: extract, rate: dt.options.bloomRate}
+	if err := dt.buildIndex(idx); err != nil {
+		return Result[any]{Err: err}
+	}
+	dt.indexes[name] = idx
+	return Result[any]{}
+}
+
+func (dt *DataTable[K, V]) buildIndex(idx *secondaryIndex[K, V]) error {
+	idx.keys = map[any]map[K]struct{}{}
+	idx.rows = 0
+	if idx.rate > 0 {
+		idx.filter = newBloomFilter(dt.IndexTable.Len(), idx.rate)
+	}
+	for _, item := range dt.IndexTable.GetAll() {
+		res := dt.UnserializeData(item.Value)
+		if res.Err != nil {
+			return res.Err
+		}
+		idx.add(item.Key, res.Value.Data)
+	}
+	return nil
+}
+
+// Lookup returns the keys of the rows whose indexed value equals value, in
+// key order.
+func (dt *DataTable[K, V]) Lookup(name string, value any) Result[[]K] {
+	dt.mu.RLock()
+	defer dt.mu.RUnlock()
+
+	idx, ok := dt.indexes[name]
+	if !ok {
+		return Result[[]K]{Err: fmt.Errorf("%w: %s", ErrIndexNotFound, name)}
+	}
+	if !idx.filter.mayContain(value) {
+		atomic.AddUint64(&dt.bloomRejects, 1)
+		return Result[[]K]{Value: []K{}}
+	}
+
+	keys := make([]K, 0, len(idx.keys[value]))
+	for key := range idx.keys[value] {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return dt.Compare(keys[i], keys[j]) < 0
+	})
+	return Result[[]K]{Value: keys}
+}
+
+// IndexStats is the size of a secondary index, which the query planner uses
+// to estimate how many rows a lookup returns.
+type IndexStats struct {
+	Values int
+	Rows   int
+}
+
+// IndexStats returns the size of every secondary index by name.
+func (dt *DataTable[K, V]) IndexStats() map[string]IndexStats {
+	dt.mu.RLock()
+	defer dt.mu.RUnlock()
+
+	stats := make(map[string]IndexStats, len(dt.indexes))
+	for name, idx := range dt.indexes {
+		stats[name] = IndexStats{Values: len(idx.keys), Rows: idx.rows}
+	}
+	return stats
+}
+
+func (dt *DataTable[K, V]) indexAdd(key K, data V) {
+	for _, idx := range dt.indexes {
+		idx.add(key, data)
+	}
+}
+
+func (dt *DataTable[K, V]) indexRemove(key K, data V) {
+	for _, idx := range dt.indexes {
+		value := idx.extract(data)
+		if _, ok := idx.keys[value][key]; ok {
+			idx.rows--
+		}
+		delete(idx.keys[value], key)
+		if len(idx.keys[value]) == 0 {
+			delete(idx.keys, value)
+		}
+	}
+}
+
+func (idx *secondaryIndex[K, V]) add(key K, data V) {
+	value := idx.extract(data)
+	if idx.keys[value] == nil {
+		idx.keys[value] = map[K]struct{}{}
+	}
+	if _, ok := idx.keys[value][key]; !ok {
+		idx.rows++
+	}
+	idx.keys[value][key] = struct{}{}
+	idx.filterAdd(value)
+}
@@ -0,0 +1,232 @@
+package storageEngine
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrNoAutoKey = errors.New("keys of this type cannot be generated")
+
+// sequenceBlock is how many integer keys are reserved on disk at a time. A
+// crash skips the rest of the block rather than handing its keys out again.
+const sequenceBlock = 1024
+
+// sequence hands out integer keys. reserved is the first key not yet
+// covered by <dbName>_seq.bin.
+type sequence struct {
+	loaded   bool
+	next     uint64
+	reserved uint64
+	// ULID state, so keys made in the same millisecond still sort
+	ulidTime uint64
+	ulidRand [10]byte
+}
+
+func sequenceFilePath(dbName string) string {
+	return dbName + "_seq.bin"
+}
+
+// WithULIDKeys makes InsertAuto generate ULIDs instead of UUIDv7s for
+// string keys.
+func WithULIDKeys() Option {
+	return func(o *tableOptions) {
+		o.ulidKeys = true
+	}
+}
+
+// InsertAuto inserts data under a generated key and returns it. Integer
+// keys count up from one past the largest key; string keys are UUIDv7s, or
+// ULIDs with WithULIDKeys. Both sort in the order they were generated.
+func (dt *DataTable[K, V]) InsertAuto(data V) Result[K] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	key, err := dt.nextKey()
+	if err != nil {
+		return Result[K]{Err: err}
+	}
+	return Result[K]{Value: key, Err: dt.insertNew(key, data).Err}
+}
+
+func (dt *DataTable[K, V]) nextKey() (K, error) {
+	var key K
+	v := reflect.ValueOf(&key).Elem()
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := dt.nextInt()
+		if err != nil {
+			return key, err
+		}
+		v.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := dt.nextInt()
+		if err != nil {
+			return key, err
+		}
+		v.SetUint(n)
+	case reflect.String:
+		if dt.options.ulidKeys {
+			id, err := dt.nextULID()
+			if err != nil {
+				return key, err
+			}
+			v.SetString(id)
+			break
+		}
+		id, err := uuid.NewV7()
+		if err != nil {
+			return key, err
+		}
+		v.SetString(id.String())
+	default:
+		return key, ErrNoAutoKey
+	}
+	return key, nil
+}
+
+// nextInt returns the next integer key, reserving another block on disk
+// before the current one runs out.
+func (dt *DataTable[K, V]) nextInt() (uint64, error) {
+	seq := &dt.sequence
+	if !seq.loaded {
+		if err := dt.loadSequence(); err != nil {
+			return 0, err
+		}
+	}
+
+	for {
+		n := seq.next
+		if n >= seq.reserved {
+			if err := dt.reserve(n + sequenceBlock); err != nil {
+				return 0, err
+			}
+		}
+		seq.next++
+		// keys inserted by hand may already hold the next value
+		if _, taken := dt.IndexTable.Search(dt.intKey(n)); !taken {
+			return n, nil
+		}
+	}
+}
+
+func (dt *DataTable[K, V]) intKey(n uint64) K {
+	var key K
+	v := reflect.ValueOf(&key).Elem()
+	if v.CanInt() {
+		v.SetInt(int64(n))
+	} else {
+		v.SetUint(n)
+	}
+	return key
+}
+
+func (dt *DataTable[K, V]) loadSequence() error {
+	seq := &dt.sequence
+	seq.next = 1
+
+	data, err := os.ReadFile(sequenceFilePath(dt.name()))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(data) == 8 {
+		seq.reserved = binary.BigEndian.Uint64(data)
+		seq.next = max(seq.next, seq.reserved)
+	}
+
+	if last, ok := dt.IndexTable.Max(); ok {
+		v := reflect.ValueOf(last)
+		if v.CanInt() && v.Int() >= 0 {
+			seq.next = max(seq.next, uint64(v.Int())+1)
+		} else if v.CanUint() {
+			seq.next = max(seq.next, v.Uint()+1)
+		}
+	}
+	seq.loaded = true
+	return nil
+}
+
+// reserve records on disk that keys below limit may have been handed out.
+func (dt *DataTable[K, V]) reserve(limit uint64) error {
+	f, err := os.OpenFile(sequenceFilePath(dt.name()), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], limit)
+	if _, err := f.WriteAt(buf[:], 0); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	dt.sequence.reserved = limit
+	return nil
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// nextULID returns a 26 character ULID: 48 bits of Unix milliseconds and 80
+// random bits, incremented instead of redrawn within a millisecond so keys
+// generated by this table keep increasing.
+func (dt *DataTable[K, V]) nextULID() (string, error) {
+	seq := &dt.sequence
+	now := uint64(time.Now().UnixMilli())
+
+	if now <= seq.ulidTime {
+		// bump the random part; on the rare overflow borrow the next millisecond
+		i := len(seq.ulidRand) - 1
+		for ; i >= 0; i-- {
+			seq.ulidRand[i]++
+			if seq.ulidRand[i] != 0 {
+				break
+			}
+		}
+		if i < 0 {
+			seq.ulidTime++
+		}
+	} else {
+		if _, err := io.ReadFull(rand.Reader, seq.ulidRand[:]); err != nil {
+			return "", err
+		}
+		seq.ulidTime = now
+	}
+
+	var raw [16]byte
+	for i := 0; i < 6; i++ {
+		raw[i] = byte(seq.ulidTime >> (40 - 8*i))
+	}
+	copy(raw[6:], seq.ulidRand[:])
+
+	// 128 bits in 26 base32 digits, the first holding only the top 3 bits
+	var sb strings.Builder
+	sb.Grow(26)
+	for i := 0; i < 26; i++ {
+		bit := 128 - 5*(25-i) - 5
+		sb.WriteByte(crockford[bitsAt(raw, bit)])
+	}
+	return sb.String(), nil
+}
+
+// bitsAt reads the 5 bits of b starting at bit (counted from the most
+// significant); bits before the start of b read as zero.
+func bitsAt(b [16]byte, bit int) byte {
+	var v byte
+	for i := 0; i < 5; i++ {
+		v <<= 1
+		if pos := bit + i; pos >= 0 && b[pos/8]&(0x80>>(pos%8)) != 0 {
+			v |= 1
+		}
+	}
+	return v
+}
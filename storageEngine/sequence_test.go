@@ -0,0 +1,112 @@
+package storageEngine
+
+import (
+	"cmp"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func insertAuto(t *testing.T, dt *DataTable[int, logRow]) int {
+	t.Helper()
+	res := dt.InsertAuto(logRow{"auto"})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	return res.Value
+}
+
+func TestInsertAutoSkipsTakenKeys(t *testing.T) {
+	dt := newRowTable(t)
+	for want := 1; want <= 3; want++ {
+		if key := insertAuto(t, dt); key != want {
+			t.Fatalf("InsertAuto = %d, want %d", key, want)
+		}
+	}
+	if res := dt.Insert(5, logRow{"by hand"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if key := insertAuto(t, dt); key != 4 {
+		t.Fatalf("InsertAuto = %d, want 4", key)
+	}
+	if key := insertAuto(t, dt); key != 6 {
+		t.Fatalf("InsertAuto after a key inserted by hand = %d, want 6", key)
+	}
+	wantRow(t, dt, 5, "by hand")
+}
+
+func TestInsertAutoNeverReusesKeys(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "auto")
+	dt, err := NewDataTable[int, logRow](cmp.Compare[int], name, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := 0
+	for i := 0; i < sequenceBlock+10; i++ {
+		key := insertAuto(t, dt)
+		if key <= last {
+			t.Fatalf("InsertAuto = %d after %d", key, last)
+		}
+		last = key
+	}
+	if res := dt.SaveIndex(); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	// keys handed out after the index was saved, then a crash
+	insertAuto(t, dt)
+	last = insertAuto(t, dt)
+	if res := dt.Delete(last); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	dt.Close()
+
+	dt, err = reopenSealed(t, name, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dt.Len() != sequenceBlock+10 {
+		t.Fatalf("%d rows after reopening, want the %d saved", dt.Len(), sequenceBlock+10)
+	}
+	next := insertAuto(t, dt)
+	if next <= last {
+		t.Fatalf("InsertAuto after a crash = %d, reusing a key up to %d", next, last)
+	}
+	if again := insertAuto(t, dt); again <= next {
+		t.Fatalf("InsertAuto = %d after %d", again, next)
+	}
+}
+
+func TestInsertAutoStringKeys(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithULIDKeys()}} {
+		dt, err := NewDataTable[string, logRow](strings.Compare, filepath.Join(t.TempDir(), "ids"), 4, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dt.Close()
+		want := 36
+		if len(opts) > 0 {
+			want = 26
+		}
+		last := ""
+		for i := 0; i < 500; i++ {
+			res := dt.InsertAuto(logRow{"auto"})
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+			if len(res.Value) != want || res.Value <= last {
+				t.Fatalf("InsertAuto = %q after %q", res.Value, last)
+			}
+			last = res.Value
+		}
+	}
+
+	floats, err := NewDataTable[float64, logRow](cmp.Compare[float64], filepath.Join(t.TempDir(), "floats"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer floats.Close()
+	if res := floats.InsertAuto(logRow{"auto"}); !errors.Is(res.Err, ErrNoAutoKey) {
+		t.Fatalf("InsertAuto with float keys = %v, want ErrNoAutoKey", res.Err)
+	}
+}
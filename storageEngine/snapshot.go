@@ -0,0 +1,252 @@
+package storageEngine
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+var ErrSnapshotActive = errors.New("snapshot still open")
+
+// version is the state a key had before the commit numbered end replaced
+// it. offset is -1 when the key did not exist.
+type version struct {
+	offset int
+	end    uint64
+}
+
+// retiredSlot is a row superseded by commit end whose space cannot be reused
+// while a snapshot older than end may still read it.
+type retiredSlot struct {
+	node FreeNode
+	end  uint64
+}
+
+// Snapshot is a read-only view of the table as of one commit sequence
+// number. It keeps superseded rows on disk until Release is called.
+type Snapshot[K comparable, V any] struct {
+	dt       *DataTable[K, V]
+	seq      uint64
+	released bool
+}
+
+func (dt *DataTable[K, V]) Snapshot() *Snapshot[K, V] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	return &Snapshot[K, V]{dt: dt, seq: dt.pin()}
+}
+
+func (s *Snapshot[K, V]) Seq() uint64 {
+	return s.seq
+}
+
+func (s *Snapshot[K, V]) Search(primaryKey K) Result[DataRow[K, V]] {
+	s.dt.mu.RLock()
+	defer s.dt.mu.RUnlock()
+
+	offset, found := s.dt.visible(primaryKey, s.seq)
+	if !found {
+		return Result[DataRow[K, V]]{Err: ErrKeyNotFound}
+	}
+	res := s.dt.UnserializeData(offset)
+	if res.Err == nil && s.dt.expired(res.Value) {
+		return Result[DataRow[K, V]]{Err: ErrKeyNotFound}
+	}
+	return res
+}
+
+func (s *Snapshot[K, V]) Keys() []K {
+	s.dt.mu.RLock()
+	defer s.dt.mu.RUnlock()
+
+	pairs := s.dt.visibleRows(s.seq)
+	keys := make([]K, len(pairs))
+	for i, p := range pairs {
+		keys[i] = p.key
+	}
+	return keys
+}
+
+// GetAll streams the rows visible to the snapshot in key order. The
+// snapshot must not be released before the channel is drained.
+func (s *Snapshot[K, V]) GetAll() <-chan Result[DataRow[K, V]] {
+	s.dt.mu.RLock()
+	pairs := s.dt.visibleRows(s.seq)
+	s.dt.mu.RUnlock()
+
+	return s.dt.readRows(context.Background(), pairs, false, nil)
+}
+
+func (s *Snapshot[K, V]) Release() Result[any] {
+	s.dt.mu.Lock()
+	defer s.dt.mu.Unlock()
+
+	if s.released {
+		return Result[any]{Value: nil}
+	}
+	s.released = true
+	return Result[any]{Err: s.dt.unpin(s.seq)}
+}
+
+type keyOffset[K comparable] struct {
+	key    K
+	offset int
+}
+
+func (dt *DataTable[K, V]) pin() uint64 {
+	dt.snapshots[dt.seq]++
+	return dt.seq
+}
+
+// unpin drops one reference to the snapshot at seq and frees every row
+// that no remaining snapshot can see.
+func (dt *DataTable[K, V]) unpin(seq uint64) error {
+	if dt.snapshots[seq]--; dt.snapshots[seq] <= 0 {
+		delete(dt.snapshots, seq)
+	}
+
+	oldest, pinned := uint64(0), false
+	for s := range dt.snapshots {
+		if !pinned || s < oldest {
+			oldest, pinned = s, true
+		}
+	}
+	stale := func(end uint64) bool {
+		return !pinned || end <= oldest
+	}
+
+	for key, vs := range dt.versions {
+		i := 0
+		for i < len(vs) && stale(vs[i].end) {
+			i++
+		}
+		if i == len(vs) {
+			delete(dt.versions, key)
+		} else {
+			dt.versions[key] = vs[i:]
+		}
+	}
+
+	kept := dt.retired[:0]
+	freed := false
+	for _, r := range dt.retired {
+		if !stale(r.end) {
+			kept = append(kept, r)
+			continue
+		}
+		if err := dt.invalidate(int(r.node.Offset)); err != nil {
+			return err
+		}
+		dt.addFree(r.node)
+		freed = true
+	}
+	dt.retired = kept
+
+	if freed {
+		if err := dt.saveFreeList(); err != nil {
+			return err
+		}
+	}
+	return dt.releaseParked()
+}
+
+// track remembers the state key had before the commit numbered end, so
+// snapshots taken earlier keep seeing it. Only the first change of a key
+// within one commit is recorded.
+func (dt *DataTable[K, V]) track(key K, offset int, end uint64) {
+	if len(dt.snapshots) == 0 {
+		return
+	}
+	vs := dt.versions[key]
+	if n := len(vs); n > 0 && vs[n-1].end == end {
+		return
+	}
+	dt.versions[key] = append(vs, version{offset: offset, end: end})
+}
+
+func (dt *DataTable[K, V]) trackInsert(key K, end uint64) {
+	if len(dt.snapshots) == 0 {
+		return
+	}
+	offset, found := dt.IndexTable.Search(key)
+	if !found {
+		offset = -1
+	}
+	dt.track(key, offset, end)
+}
+
+func (dt *DataTable[K, V]) visible(key K, seq uint64) (int, bool) {
+	for _, v := range dt.versions[key] {
+		if v.end > seq {
+			return v.offset, v.offset >= 0
+		}
+	}
+	return dt.IndexTable.Search(key)
+}
+
+func (dt *DataTable[K, V]) visibleRows(seq uint64) []keyOffset[K] {
+	var rows []keyOffset[K]
+	for _, p := range dt.IndexTable.GetAll() {
+		if offset, found := dt.visible(p.Key, seq); found {
+			rows = append(rows, keyOffset[K]{key: p.Key, offset: offset})
+		}
+	}
+
+	// keys deleted after the snapshot are no longer in the index
+	n := len(rows)
+	for key := range dt.versions {
+		if _, live := dt.IndexTable.Search(key); live {
+			continue
+		}
+		if offset, found := dt.visible(key, seq); found {
+			rows = append(rows, keyOffset[K]{key: key, offset: offset})
+		}
+	}
+	if len(rows) > n {
+		sort.Slice(rows, func(i, j int) bool {
+			return dt.Compare(rows[i].key, rows[j].key) < 0
+		})
+	}
+	return rows
+}
+
+// readRows reads rows one at a time under the read lock and calls done,
+// if set, once the scan ends, either because every row was read or because
+// ctx is done. Expired rows are skipped unless includeExpired is set.
+func (dt *DataTable[K, V]) readRows(ctx context.Context, rows []keyOffset[K], includeExpired bool, done func()) <-chan Result[DataRow[K, V]] {
+	resultsChan := make(chan Result[DataRow[K, V]])
+
+	go func() {
+		defer close(resultsChan)
+		if done != nil {
+			defer done()
+		}
+		for _, row := range rows {
+			dt.mu.RLock()
+			res := dt.UnserializeData(row.offset)
+			dt.mu.RUnlock()
+			if res.Err == nil && !includeExpired && dt.expired(res.Value) {
+				continue
+			}
+			select {
+			case resultsChan <- res:
+			case <-ctx.Done():
+				return
+			}
+			if res.Err != nil {
+				return
+			}
+		}
+	}()
+
+	return resultsChan
+}
+
+func (dt *DataTable[K, V]) invalidate(offset int) error {
+	res := dt.UnserializeData(offset)
+	if res.Err != nil {
+		return res.Err
+	}
+	return dt.freeRow(res.Value, offset)
+}
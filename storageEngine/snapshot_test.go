@@ -0,0 +1,62 @@
+package storageEngine
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetAllContextReleasesSnapshot(t *testing.T) {
+	dt, err := NewDataTable[int, logRow](cmp.Compare[int], filepath.Join(t.TempDir(), "scan"), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dt.Close()
+	for key := 1; key <= 100; key++ {
+		if res := dt.Insert(key, logRow{"row"}); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rows := dt.GetAllContext(ctx)
+	if res := <-rows; res.Err != nil || res.Value.PrimaryKey != 1 {
+		t.Fatalf("first row = %+v", res)
+	}
+	if res := dt.Compact(); !errors.Is(res.Err, ErrSnapshotActive) {
+		t.Fatalf("Compact during the scan = %v, want ErrSnapshotActive", res.Err)
+	}
+
+	cancel()
+	read := 1
+	for range rows {
+		read++
+	}
+	if read == 100 {
+		t.Fatalf("cancelled scan still read every row")
+	}
+	if res := dt.Compact(); res.Err != nil {
+		t.Fatalf("Compact after the scan stopped: %v", res.Err)
+	}
+}
+
+func TestRangeContextStops(t *testing.T) {
+	dt, err := NewDataTable[int, logRow](cmp.Compare[int], filepath.Join(t.TempDir(), "range"), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dt.Close()
+	for key := 1; key <= 50; key++ {
+		dt.Insert(key, logRow{"row"})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for range dt.RangeContext(ctx, 10, 40) {
+	}
+	if res := dt.Compact(); res.Err != nil {
+		t.Fatalf("Compact after a cancelled range: %v", res.Err)
+	}
+}
@@ -0,0 +1,397 @@
+package storageEngine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// An SSTable is an immutable file of rows sorted by key. Rows are grouped
+// into blocks of about sstBlockSize bytes, each record being the uvarint
+// length of a gob-encoded DataRow followed by it. The blocks are followed by
+// a gob-encoded sstMeta holding the first key of every block, which is the
+// sparse index, and a Bloom filter over the keys. The file ends with the
+// offset of the meta and sstMagic.
+const (
+	sstBlockSize   = 4 << 10
+	sstFooterSize  = 8 + 8 // meta offset and magic
+	defaultSSTRate = 0.01
+)
+
+var (
+	sstMagic = []byte("ZSSTABLE")
+
+	ErrCorruptTable = errors.New("corrupt sstable")
+)
+
+type sstBlock[K comparable] struct {
+	First  K
+	Offset int64
+	Size   int64
+}
+
+type sstMeta[K comparable] struct {
+	Blocks []sstBlock[K]
+	Rows   int
+	Min    K
+	Max    K
+	Filter *bloomFilter
+}
+
+type sstable[K comparable, V any] struct {
+	num  uint64
+	path string
+	file *os.File
+	size int64
+	meta sstMeta[K]
+
+	// refs counts the scans reading the table; an obsolete table is removed
+	// once the last one is done
+	refs     int
+	obsolete bool
+}
+
+func sstFilePath(name string, num uint64) string {
+	return fmt.Sprintf("%s_%06d.sst", name, num)
+}
+
+// sstWriter writes rows, which must come in key order, to a new table.
+type sstWriter[K comparable, V any] struct {
+	num    uint64
+	path   string
+	file   *os.File
+	w      *bufio.Writer
+	enc    *rowEncoder[K, V]
+	block  bytes.Buffer
+	offset int64
+	meta   sstMeta[K]
+	keys   []K
+	rate   float64
+}
+
+func newSSTWriter[K comparable, V any](name string, num uint64, rate float64) (*sstWriter[K, V], error) {
+	path := sstFilePath(name, num)
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &sstWriter[K, V]{num: num, path: path, file: file, w: bufio.NewWriter(file), enc: newRowEncoder[K, V](), rate: rate}, nil
+}
+
+func (sw *sstWriter[K, V]) add(row DataRow[K, V]) error {
+	record, err := sw.enc.encode(row)
+	if err != nil {
+		return err
+	}
+	if sw.block.Len() == 0 {
+		sw.meta.Blocks = append(sw.meta.Blocks, sstBlock[K]{First: row.PrimaryKey, Offset: sw.offset})
+	}
+	if sw.meta.Rows == 0 {
+		sw.meta.Min = row.PrimaryKey
+	}
+	sw.meta.Max = row.PrimaryKey
+	sw.meta.Rows++
+	sw.keys = append(sw.keys, row.PrimaryKey)
+
+	sw.block.Write(binary.AppendUvarint(nil, uint64(len(record))))
+	sw.block.Write(record)
+	if sw.block.Len() >= sstBlockSize {
+		return sw.flushBlock()
+	}
+	return nil
+}
+
+func (sw *sstWriter[K, V]) flushBlock() error {
+	if sw.block.Len() == 0 {
+		return nil
+	}
+	n, err := sw.w.Write(sw.block.Bytes())
+	if err != nil {
+		return err
+	}
+	sw.meta.Blocks[len(sw.meta.Blocks)-1].Size = int64(n)
+	sw.offset += int64(n)
+	sw.block.Reset()
+	return nil
+}
+
+// size is the number of bytes written so far.
+func (sw *sstWriter[K, V]) size() int64 {
+	return sw.offset + int64(sw.block.Len())
+}
+
+// finish writes the meta and footer and opens the table for reading.
+func (sw *sstWriter[K, V]) finish() (*sstable[K, V], error) {
+	if err := sw.flushBlock(); err != nil {
+		sw.abort()
+		return nil, err
+	}
+	sw.meta.Filter = newBloomFilter(len(sw.keys), sw.rate)
+	for _, key := range sw.keys {
+		sw.meta.Filter.add(key)
+	}
+
+	var meta bytes.Buffer
+	if err := gob.NewEncoder(&meta).Encode(sw.meta); err != nil {
+		sw.abort()
+		return nil, err
+	}
+	footer := binary.BigEndian.AppendUint64(nil, uint64(sw.offset))
+	footer = append(footer, sstMagic...)
+	for _, b := range [][]byte{meta.Bytes(), footer} {
+		if _, err := sw.w.Write(b); err != nil {
+			sw.abort()
+			return nil, err
+		}
+	}
+	if err := sw.w.Flush(); err != nil {
+		sw.abort()
+		return nil, err
+	}
+	if err := sw.file.Sync(); err != nil {
+		sw.abort()
+		return nil, err
+	}
+	sw.file.Close()
+	return openSSTable[K, V](sw.path, sw.num)
+}
+
+func (sw *sstWriter[K, V]) abort() {
+	sw.file.Close()
+	os.Remove(sw.path)
+}
+
+func openSSTable[K comparable, V any](path string, num uint64) (*sstable[K, V], error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &sstable[K, V]{num: num, path: path, file: file}
+	if err := t.readMeta(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%w: %s: %v", ErrCorruptTable, path, err)
+	}
+	return t, nil
+}
+
+func (t *sstable[K, V]) readMeta() error {
+	info, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+	t.size = info.Size()
+	if t.size < int64(sstFooterSize) {
+		return errors.New("file too short")
+	}
+	footer := make([]byte, sstFooterSize)
+	if _, err := t.file.ReadAt(footer, t.size-int64(sstFooterSize)); err != nil {
+		return err
+	}
+	if !bytes.Equal(footer[8:], sstMagic) {
+		return errors.New("bad magic")
+	}
+	metaOffset := int64(binary.BigEndian.Uint64(footer))
+	if metaOffset > t.size-int64(sstFooterSize) {
+		return errors.New("bad meta offset")
+	}
+	meta := make([]byte, t.size-int64(sstFooterSize)-metaOffset)
+	if _, err := t.file.ReadAt(meta, metaOffset); err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(meta)).Decode(&t.meta)
+}
+
+// readBlock decodes every row of block i.
+func (t *sstable[K, V]) readBlock(i int) ([]DataRow[K, V], error) {
+	block := t.meta.Blocks[i]
+	buf := make([]byte, block.Size)
+	if _, err := t.file.ReadAt(buf, block.Offset); err != nil {
+		return nil, err
+	}
+	var rows []DataRow[K, V]
+	for len(buf) > 0 {
+		n, k := binary.Uvarint(buf)
+		if k <= 0 || uint64(len(buf)-k) < n {
+			return nil, fmt.Errorf("%w: %s: block at offset %d", ErrCorruptTable, t.path, block.Offset)
+		}
+		var row DataRow[K, V]
+		if err := gob.NewDecoder(bytes.NewReader(buf[k : k+int(n)])).Decode(&row); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+		buf = buf[k+int(n):]
+	}
+	return rows, nil
+}
+
+// blockFor returns the last block whose first key is not after key.
+func (t *sstable[K, V]) blockFor(key K, compare func(a, b K) int) int {
+	i := sort.Search(len(t.meta.Blocks), func(i int) bool {
+		return compare(t.meta.Blocks[i].First, key) > 0
+	})
+	return max(i-1, 0)
+}
+
+// get returns the newest entry for key in the table, which may be a
+// tombstone.
+func (t *sstable[K, V]) get(key K, compare func(a, b K) int) (DataRow[K, V], bool, error) {
+	if t.meta.Rows == 0 || compare(key, t.meta.Min) < 0 || compare(key, t.meta.Max) > 0 {
+		return DataRow[K, V]{}, false, nil
+	}
+	if !t.meta.Filter.mayContain(key) {
+		return DataRow[K, V]{}, false, nil
+	}
+	rows, err := t.readBlock(t.blockFor(key, compare))
+	if err != nil {
+		return DataRow[K, V]{}, false, err
+	}
+	i := sort.Search(len(rows), func(i int) bool {
+		return compare(rows[i].PrimaryKey, key) >= 0
+	})
+	if i < len(rows) && compare(rows[i].PrimaryKey, key) == 0 {
+		return rows[i], true, nil
+	}
+	return DataRow[K, V]{}, false, nil
+}
+
+func (t *sstable[K, V]) overlaps(min, max K, compare func(a, b K) int) bool {
+	return compare(t.meta.Max, min) >= 0 && compare(t.meta.Min, max) <= 0
+}
+
+func (t *sstable[K, V]) close() {
+	t.file.Close()
+}
+
+// rowIterator yields rows in key order.
+type rowIterator[K comparable, V any] interface {
+	next() (DataRow[K, V], bool, error)
+}
+
+// sliceIterator iterates rows held in memory.
+type sliceIterator[K comparable, V any] struct {
+	rows []DataRow[K, V]
+}
+
+func (it *sliceIterator[K, V]) next() (DataRow[K, V], bool, error) {
+	if len(it.rows) == 0 {
+		return DataRow[K, V]{}, false, nil
+	}
+	row := it.rows[0]
+	it.rows = it.rows[1:]
+	return row, true, nil
+}
+
+// levelIterator reads the tables of a level, or a single table, one block
+// at a time, starting at the first row not before start when seek is set.
+type levelIterator[K comparable, V any] struct {
+	tables  []*sstable[K, V]
+	compare func(a, b K) int
+	block   int
+	rows    []DataRow[K, V]
+	start   *K
+}
+
+func newLevelIterator[K comparable, V any](tables []*sstable[K, V], compare func(a, b K) int, start *K) *levelIterator[K, V] {
+	it := &levelIterator[K, V]{tables: tables, compare: compare, start: start}
+	if start != nil {
+		// skip the tables that end before start
+		for len(it.tables) > 0 && compare(it.tables[0].meta.Max, *start) < 0 {
+			it.tables = it.tables[1:]
+		}
+		if len(it.tables) > 0 {
+			it.block = it.tables[0].blockFor(*start, compare)
+		}
+	}
+	return it
+}
+
+func (it *levelIterator[K, V]) next() (DataRow[K, V], bool, error) {
+	for len(it.rows) == 0 {
+		if len(it.tables) == 0 {
+			return DataRow[K, V]{}, false, nil
+		}
+		t := it.tables[0]
+		if it.block >= len(t.meta.Blocks) {
+			it.tables = it.tables[1:]
+			it.block = 0
+			continue
+		}
+		rows, err := t.readBlock(it.block)
+		if err != nil {
+			return DataRow[K, V]{}, false, err
+		}
+		it.block++
+		if it.start != nil {
+			start := *it.start
+			i := sort.Search(len(rows), func(i int) bool {
+				return it.compare(rows[i].PrimaryKey, start) >= 0
+			})
+			rows = rows[i:]
+		}
+		it.rows = rows
+	}
+	row := it.rows[0]
+	it.rows = it.rows[1:]
+	return row, true, nil
+}
+
+// mergeIterator merges sources given newest first. Of the rows sharing a
+// key only the one from the newest source is returned.
+type mergeIterator[K comparable, V any] struct {
+	sources []rowIterator[K, V]
+	heads   []*DataRow[K, V]
+	compare func(a, b K) int
+	started bool
+}
+
+func newMergeIterator[K comparable, V any](compare func(a, b K) int, sources ...rowIterator[K, V]) *mergeIterator[K, V] {
+	return &mergeIterator[K, V]{sources: sources, heads: make([]*DataRow[K, V], len(sources)), compare: compare}
+}
+
+func (it *mergeIterator[K, V]) advance(i int) error {
+	row, ok, err := it.sources[i].next()
+	if err != nil {
+		return err
+	}
+	if ok {
+		it.heads[i] = &row
+	} else {
+		it.heads[i] = nil
+	}
+	return nil
+}
+
+func (it *mergeIterator[K, V]) next() (DataRow[K, V], bool, error) {
+	if !it.started {
+		it.started = true
+		for i := range it.sources {
+			if err := it.advance(i); err != nil {
+				return DataRow[K, V]{}, false, err
+			}
+		}
+	}
+
+	newest := -1
+	for i, head := range it.heads {
+		if head != nil && (newest < 0 || it.compare(head.PrimaryKey, it.heads[newest].PrimaryKey) < 0) {
+			newest = i
+		}
+	}
+	if newest < 0 {
+		return DataRow[K, V]{}, false, nil
+	}
+	row := *it.heads[newest]
+	for i, head := range it.heads {
+		if head != nil && it.compare(head.PrimaryKey, row.PrimaryKey) == 0 {
+			if err := it.advance(i); err != nil {
+				return DataRow[K, V]{}, false, err
+			}
+		}
+	}
+	return row, true, nil
+}
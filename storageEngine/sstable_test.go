@@ -0,0 +1,89 @@
+package storageEngine
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSST writes the even keys in [from, to) to table num, padding the rows
+// so that they span several blocks.
+func writeSST(t *testing.T, name string, num uint64, from, to int) *sstable[int, logRow] {
+	t.Helper()
+	sw, err := newSSTWriter[int, logRow](name, num, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key := from; key < to; key += 2 {
+		row := DataRow[int, logRow]{PrimaryKey: key, Data: logRow{fmt.Sprintf("%0100d", key)}, IsValid: true}
+		if err := sw.add(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	table, err := sw.finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(table.close)
+	return table
+}
+
+func TestSSTableGet(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "sst")
+	table := writeSST(t, name, 1, 0, 2000)
+	if len(table.meta.Blocks) < 2 {
+		t.Fatalf("table has %d blocks, want several", len(table.meta.Blocks))
+	}
+
+	reopened, err := openSSTable[int, logRow](sstFilePath(name, 1), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.close()
+	for _, key := range []int{0, 2, 500, 1000, 1998} {
+		row, ok, err := reopened.get(key, cmp.Compare[int])
+		if err != nil || !ok || row.Data.Name != fmt.Sprintf("%0100d", key) {
+			t.Fatalf("get(%d) = %+v %v %v", key, row, ok, err)
+		}
+	}
+	for _, key := range []int{-1, 1, 999, 2000} {
+		if _, ok, err := reopened.get(key, cmp.Compare[int]); ok || err != nil {
+			t.Fatalf("get(%d) found a missing key: %v", key, err)
+		}
+	}
+
+	os.WriteFile(sstFilePath(name, 2), []byte("not a table"), 0644)
+	if _, err := openSSTable[int, logRow](sstFilePath(name, 2), 2); !errors.Is(err, ErrCorruptTable) {
+		t.Fatalf("opening a bad file = %v, want ErrCorruptTable", err)
+	}
+}
+
+func TestLevelIteratorStartsMidTable(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "sst")
+	tables := []*sstable[int, logRow]{
+		writeSST(t, name, 1, 0, 1000),
+		writeSST(t, name, 2, 1000, 2000),
+	}
+	start := 901
+	it := newLevelIterator(tables, cmp.Compare[int], &start)
+	want := 902
+	for {
+		row, ok, err := it.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		if row.PrimaryKey != want {
+			t.Fatalf("next = %d, want %d", row.PrimaryKey, want)
+		}
+		want += 2
+	}
+	if want != 2000 {
+		t.Fatalf("iterator stopped before key %d", want)
+	}
+}
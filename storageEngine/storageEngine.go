@@ -3,11 +3,14 @@ package storageEngine
 import (
 	"ZeroStore/datastructure/btree"
 	"ZeroStore/helper"
+	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
-	"sort"
+	"sync"
+	"sync/atomic"
 )
 
 type Result[T any] struct {
@@ -19,6 +22,20 @@ type DataRow[K comparable, V any] struct {
 	PrimaryKey K
 	Data       V
 	IsValid    bool
+	// Version starts at 1 and grows by one with every update of the key
+	Version uint64
+	// ExpiresAt is the expiry in Unix nanoseconds, or 0 for rows that never
+	// expire
+	ExpiresAt int64
+	// SchemaVersion is the schema version the row was written in; see
+	// WithMigrations
+	SchemaVersion int
+
+	// size is the number of bytes the row takes in the data file, known
+	// for rows read from it
+	size int64
+	// raw is the size of the row's encoding before compression
+	raw int64
 }
 
 type FreeNode struct {
@@ -26,6 +43,22 @@ type FreeNode struct {
 	Size   int64
 }
 
+type TableStats struct {
+	Rows          int
+	DataFileSize  int64
+	IndexFileSize int64
+	FreeNodes     int
+	FreeBytes     int64
+	// row cache counters; zero unless the table has WithRowCache
+	CacheHits      uint64
+	CacheMisses    uint64
+	CacheEvictions uint64
+	CacheBytes     int64
+	// BloomRejects counts lookups answered by a Bloom filter; see
+	// WithBloomFilter
+	BloomRejects uint64
+}
+
 type DataTable[K comparable, V any] struct {
 	Columns     []string
 	IndexTable  btree.BTree[K, int]
@@ -35,13 +68,44 @@ type DataTable[K comparable, V any] struct {
 	freeFile    *os.File
 	BtreeDegree int
 	FreeList    []FreeNode
+	mu          sync.RWMutex
+	options     tableOptions
+	logFile     *os.File
+	seq         uint64
+	seqTime     int64
+	backups     int
+	// open snapshots by sequence number; while any is open, replaced rows
+	// are remembered in versions and their slots parked in retired
+	snapshots map[uint64]int
+	versions  map[K][]version
+	retired   []retiredSlot
+
+	subscribers []*Subscription[K, V]
+	hooks       tableHooks[K, V]
+	// expiries holds the expiry of every row that has one; see expireKey
+	expiries map[K]int64
+	indexes  map[string]*secondaryIndex[K, V]
+	schema   *Schema
+	history  history
+	sequence sequence
+	crypt    *crypter
+	overflow overflowStore[K]
+	cache    *rowCache[K, V]
+	bloom    *bloomFilter
+	// bloomRejects is updated under the read lock
+	bloomRejects uint64
 }
 
+var (
+	ErrKeyNotFound = errors.New("key not found")
+	ErrKeyExists   = errors.New("key already exists")
+)
+
 func NewResult[T any](value T, err error) Result[T] {
 	return Result[T]{Value: value, Err: err}
 }
 
-func NewDataTable[K comparable, V any](compare func(a, b K) int, dbName string, btreeDegree int) (*DataTable[K, V], error) {
+func NewDataTable[K comparable, V any](compare func(a, b K) int, dbName string, btreeDegree int, opts ...Option) (*DataTable[K, V], error) {
 
 	var dataFile *os.File
 	var indexFile *os.File
@@ -54,6 +118,11 @@ func NewDataTable[K comparable, V any](compare func(a, b K) int, dbName string,
 	freeFilePath := dbName + "_free.bin"
 
 	if cols, err = helper.GetFieldNames[V](); err != nil {
+		// non-struct values such as []byte are stored whole and have no columns
+		cols = nil
+	}
+	schema, err := SchemaOf[V]()
+	if err != nil {
 		return nil, err
 	}
 
@@ -75,9 +144,18 @@ func NewDataTable[K comparable, V any](compare func(a, b K) int, dbName string,
 		return nil, err
 	}
 
+	options := tableOptions{clock: systemClock{}, overflowThreshold: DefaultOverflowThreshold}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	crypt := newCrypter(options.keys)
+
 	if info.Size() > 0 {
-		decoder := gob.NewDecoder(freeFile)
-		if err := decoder.Decode(&freeList); err != nil {
+		r, err := crypt.reader(freeFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := gob.NewDecoder(r).Decode(&freeList); err != nil {
 			return nil, err
 		}
 	}
@@ -85,7 +163,7 @@ func NewDataTable[K comparable, V any](compare func(a, b K) int, dbName string,
 	gob.Register(DataRow[K, V]{})
 
 	bt := btree.NewBTree[K, int](btreeDegree, compare)
-	return &DataTable[K, V]{
+	dt := &DataTable[K, V]{
 		Columns:     cols,
 		IndexTable:  *bt,
 		Compare:     compare,
@@ -94,119 +172,323 @@ func NewDataTable[K comparable, V any](compare func(a, b K) int, dbName string,
 		freeFile:    freeFile,
 		BtreeDegree: btreeDegree,
 		FreeList:    freeList,
-	}, nil
+		options:     options,
+		crypt:       crypt,
+		cache:       newRowCache[K, V](options.cacheBytes),
+		snapshots:   make(map[uint64]int),
+		versions:    make(map[K][]version),
+		expiries:    make(map[K]int64),
+		indexes:     make(map[string]*secondaryIndex[K, V]),
+	}
+	if err := dt.useSchema(schema); err != nil {
+		return nil, err
+	}
+	if err := dt.loadHistory(dbName); err != nil {
+		return nil, err
+	}
+	if err := dt.openOverflow(dbName); err != nil {
+		return nil, err
+	}
+	dt.rebuildBloom(0)
+
+	if options.mutationLog {
+		if err := dt.openLog(dbName); err != nil {
+			return nil, err
+		}
+	}
+	return dt, nil
 }
 
+// GetAll streams the rows as of the moment it is called. The scan holds a
+// snapshot so rows replaced meanwhile are neither skipped nor read twice.
+// The snapshot is released when the scan ends, so the channel must be read
+// to the end; GetAllContext lets a caller stop early.
 func (dt *DataTable[K, V]) GetAll() <-chan Result[DataRow[K, V]] {
-	resultsChan := make(chan Result[DataRow[K, V]])
+	return dt.GetAllContext(context.Background())
+}
 
-	go func() {
-		defer close(resultsChan)
-		for _, offset := range dt.IndexTable.GetAll() {
-			res := dt.UnserializeData(offset.Value)
-			if res.Err != nil {
-				resultsChan <- Result[DataRow[K, V]]{Err: res.Err}
-				return
-			}
-			resultsChan <- Result[DataRow[K, V]]{Value: res.Value}
-		}
-	}()
+// GetAllContext is GetAll that stops, closing the channel and releasing the
+// snapshot, once ctx is done.
+func (dt *DataTable[K, V]) GetAllContext(ctx context.Context) <-chan Result[DataRow[K, V]] {
+	return dt.scanPairs(ctx, dt.IndexTable.GetAll, false)
+}
 
-	return resultsChan
+func (dt *DataTable[K, V]) scan(includeExpired bool) <-chan Result[DataRow[K, V]] {
+	return dt.scanPairs(context.Background(), dt.IndexTable.GetAll, includeExpired)
+}
+
+// scanPairs reads the rows listed by pairs, which runs under the lock
+// together with pinning the snapshot the rows are read from.
+func (dt *DataTable[K, V]) scanPairs(ctx context.Context, pairs func() []btree.KVPair[K, int], includeExpired bool) <-chan Result[DataRow[K, V]] {
+	dt.mu.Lock()
+	seq := dt.pin()
+	listed := pairs()
+	dt.mu.Unlock()
+
+	rows := make([]keyOffset[K], len(listed))
+	for i, p := range listed {
+		rows[i] = keyOffset[K]{key: p.Key, offset: p.Value}
+	}
+
+	return dt.readRows(ctx, rows, includeExpired, func() {
+		dt.mu.Lock()
+		defer dt.mu.Unlock()
+		dt.unpin(seq)
+	})
+}
+
+// Range streams the rows with start <= key < end in key order, holding a
+// snapshot like GetAll.
+func (dt *DataTable[K, V]) Range(start, end K) <-chan Result[DataRow[K, V]] {
+	return dt.RangeContext(context.Background(), start, end)
+}
+
+// RangeContext is Range that stops once ctx is done.
+func (dt *DataTable[K, V]) RangeContext(ctx context.Context, start, end K) <-chan Result[DataRow[K, V]] {
+	return dt.scanPairs(ctx, func() []btree.KVPair[K, int] {
+		return dt.IndexTable.Range(start, end)
+	}, false)
+}
+
+// Len returns the number of rows in the table.
+func (dt *DataTable[K, V]) Len() int {
+	dt.mu.RLock()
+	defer dt.mu.RUnlock()
+	return dt.IndexTable.Len()
+}
+
+func (dt *DataTable[K, V]) Keys() []K {
+	dt.mu.RLock()
+	defer dt.mu.RUnlock()
+
+	pairs := dt.IndexTable.GetAll()
+	keys := make([]K, len(pairs))
+	for i, p := range pairs {
+		keys[i] = p.Key
+	}
+	return keys
+}
+
+// KeysFrom returns up to limit keys >= start in key order.
+func (dt *DataTable[K, V]) KeysFrom(start K, limit int) []K {
+	dt.mu.RLock()
+	defer dt.mu.RUnlock()
+
+	pairs := dt.IndexTable.From(start, limit)
+	keys := make([]K, len(pairs))
+	for i, p := range pairs {
+		keys[i] = p.Key
+	}
+	return keys
 }
 
 func (dt *DataTable[K, V]) Search(primaryKey K) Result[DataRow[K, V]] {
+	dt.mu.RLock()
+	defer dt.mu.RUnlock()
+
+	return dt.search(primaryKey)
+}
+
+func (dt *DataTable[K, V]) search(primaryKey K) Result[DataRow[K, V]] {
+	if !dt.keyMayExist(primaryKey) {
+		return Result[DataRow[K, V]]{Err: ErrKeyNotFound}
+	}
+	if row, ok := dt.cache.get(primaryKey); ok {
+		if dt.expired(row) {
+			return Result[DataRow[K, V]]{Err: ErrKeyNotFound}
+		}
+		return Result[DataRow[K, V]]{Value: row}
+	}
 	if offset, found := dt.IndexTable.Search(primaryKey); found {
 		res := dt.UnserializeData(offset)
-		return Result[DataRow[K, V]]{Value: res.Value, Err: res.Err}
+		if res.Err != nil {
+			return res
+		}
+		dt.cache.put(res.Value, res.Value.raw)
+		if dt.expired(res.Value) {
+			return Result[DataRow[K, V]]{Err: ErrKeyNotFound}
+		}
+		return Result[DataRow[K, V]]{Value: res.Value}
 	}
-	return Result[DataRow[K, V]]{Err: fmt.Errorf("key not found")}
+	return Result[DataRow[K, V]]{Err: ErrKeyNotFound}
 }
 
 func (dt *DataTable[K, V]) Insert(primaryKey K, data V) Result[any] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	return dt.insertNew(primaryKey, data)
+}
+
+func (dt *DataTable[K, V]) insertNew(primaryKey K, data V) Result[any] {
+	if err := dt.expireKey(primaryKey); err != nil {
+		return Result[any]{Err: err}
+	}
+	if _, found := dt.IndexTable.Search(primaryKey); found {
+		return Result[any]{Err: fmt.Errorf("%w: %v", ErrKeyExists, primaryKey)}
+	}
+	data, err := dt.beforeInsert(primaryKey, data)
+	if err != nil {
+		return Result[any]{Err: err}
+	}
+	if res := dt.insert(primaryKey, data, 1); res.Err != nil {
+		return res
+	}
+	var zero V
+	err = dt.commit(OpInsert, primaryKey, zero, data)
+	dt.afterInsert(primaryKey, data)
+	return Result[any]{Err: err}
+}
+
+func (dt *DataTable[K, V]) insert(primaryKey K, data V, version uint64) Result[any] {
 	dataRow := newRow(primaryKey, data)
-	reqSize := int64(helper.RealSizeOf(dataRow))
-	offset := -1
-	var err error
+	dataRow.Version = version
+	return dt.insertRow(dataRow)
+}
 
-	for i, f := range dt.FreeList {
-		if reqSize <= f.Size {
-			offset = int(f.Offset)
-			if f.Size-reqSize > 0 {
-				dt.FreeList[i] = FreeNode{Offset: int64(offset) + reqSize, Size: f.Size - reqSize}
-			} else {
-				dt.FreeList = dt.FreeList[1:]
-			}
-			if err := gob.NewEncoder(dt.freeFile).Encode(dt.FreeList); err != nil {
-				return Result[any]{Err: err}
-			}
-			break
+// replace writes the next version of a row deleted by the same commit,
+// keeping its expiry.
+func (dt *DataTable[K, V]) replace(old DataRow[K, V], data V) Result[any] {
+	dataRow := newRow(old.PrimaryKey, data)
+	dataRow.Version = old.Version + 1
+	dataRow.ExpiresAt = old.ExpiresAt
+	return dt.insertRow(dataRow)
+}
+
+func (dt *DataTable[K, V]) insertRow(dataRow DataRow[K, V]) Result[any] {
+	primaryKey := dataRow.PrimaryKey
+	dataRow.SchemaVersion = dt.history.version
+	record, err := dt.encodeRow(dataRow)
+	if err != nil {
+		return Result[any]{Err: err}
+	}
+	dt.trackInsert(primaryKey, dt.seq+1)
+
+	offset := dt.allocate(int64(len(record)))
+	if offset >= 0 {
+		if err := dt.saveFreeList(); err != nil {
+			return Result[any]{Err: err}
 		}
 	}
 
-	res := dt.SerializeData(dataRow, offset)
+	res := dt.writeRecord(record, offset)
 	if res.Err != nil {
-		return Result[any]{Err: err}
+		return Result[any]{Err: res.Err}
 	}
 
 	dt.IndexTable.Insert(primaryKey, res.Value)
+	dt.trackExpiry(primaryKey, dataRow.ExpiresAt)
+	dt.indexAdd(primaryKey, dataRow.Data)
+	dt.cache.remove(primaryKey)
+	dt.bloomAdd(primaryKey)
 
 	return Result[any]{Value: nil}
 }
 
 func (dt *DataTable[K, V]) UpdateWithData(primaryKey K, data V) Result[any] {
-	if res := dt.Delete(primaryKey); res.Err != nil {
-		return Result[any]{Err: res.Err}
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if err := dt.expireKey(primaryKey); err != nil {
+		return Result[any]{Err: err}
+	}
+	data, err := dt.beforeUpdate(primaryKey, data)
+	if err != nil {
+		return Result[any]{Err: err}
+	}
+	deleteResult := dt.delete(primaryKey)
+	if deleteResult.Err != nil {
+		return Result[any]{Err: deleteResult.Err}
 	}
 
-	if res := dt.Insert(primaryKey, data); res.Err != nil {
+	if res := dt.replace(deleteResult.Value, data); res.Err != nil {
 		return Result[any]{Err: res.Err}
 	}
 
-	return Result[any]{Value: nil}
+	return Result[any]{Err: dt.commit(OpUpdate, primaryKey, deleteResult.Value.Data, data)}
 }
 
 func (dt *DataTable[K, V]) UpdateWithFunc(primaryKey K, updateFunc func(data V) V) Result[any] {
-	deleteResult := dt.Delete(primaryKey)
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if err := dt.expireKey(primaryKey); err != nil {
+		return Result[any]{Err: err}
+	}
+	current := dt.search(primaryKey)
+	if current.Err != nil {
+		return Result[any]{Err: current.Err}
+	}
+	data, err := dt.runBeforeUpdate(primaryKey, current.Value.Data, updateFunc(current.Value.Data))
+	if err != nil {
+		return Result[any]{Err: err}
+	}
+
+	deleteResult := dt.delete(primaryKey)
 	if deleteResult.Err != nil {
 		return Result[any]{Err: deleteResult.Err}
 	}
 
 	oldDr := deleteResult.Value
 
-	data := updateFunc(oldDr.Data)
-
-	insertResult := dt.Insert(primaryKey, data)
+	insertResult := dt.replace(oldDr, data)
 	if insertResult.Err != nil {
 		return Result[any]{Err: insertResult.Err}
 	}
 
-	return Result[any]{Value: nil}
+	return Result[any]{Err: dt.commit(OpUpdate, primaryKey, oldDr.Data, data)}
 }
 
 func (dt *DataTable[K, V]) Delete(primaryKey K) Result[DataRow[K, V]] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
 
-	offset, found := dt.IndexTable.Delete(primaryKey)
+	if err := dt.expireKey(primaryKey); err != nil {
+		return Result[DataRow[K, V]]{Err: err}
+	}
+	if err := dt.beforeDelete(primaryKey); err != nil {
+		return Result[DataRow[K, V]]{Err: err}
+	}
+	res := dt.delete(primaryKey)
+	if res.Err != nil {
+		return res
+	}
+	var zero V
+	res.Err = dt.commit(OpDelete, primaryKey, res.Value.Data, zero)
+	return res
+}
+
+func (dt *DataTable[K, V]) delete(primaryKey K) Result[DataRow[K, V]] {
+	offset, found := dt.IndexTable.Search(primaryKey)
 	if !found {
-		return Result[DataRow[K, V]]{Err: fmt.Errorf("key not found")}
+		return Result[DataRow[K, V]]{Err: ErrKeyNotFound}
 	}
+	// a row that cannot be read, such as one a migration fails to upgrade,
+	// stays in the index
 	res := dt.UnserializeData(offset)
 	if res.Err != nil {
 		return Result[DataRow[K, V]]{Err: res.Err}
 	}
-	res.Value.IsValid = false
-	resOffset := dt.SerializeData(res.Value, offset)
-	if resOffset.Err != nil {
-		return Result[DataRow[K, V]]{Err: resOffset.Err}
+	dt.IndexTable.Delete(primaryKey)
+	delete(dt.expiries, primaryKey)
+	dt.cache.remove(primaryKey)
+	dt.track(primaryKey, offset, dt.seq+1)
+	dt.indexRemove(primaryKey, res.Value.Data)
+	freed := FreeNode{Offset: int64(offset), Size: res.Value.size}
+	if len(dt.snapshots) > 0 {
+		dt.retired = append(dt.retired, retiredSlot{node: freed, end: dt.seq + 1})
+		res.Value.IsValid = false
+		return Result[DataRow[K, V]]{Value: res.Value}
 	}
 
-	dt.FreeList = append(dt.FreeList, FreeNode{Offset: int64(offset), Size: int64(helper.RealSizeOf(res.Value))})
+	if err := dt.freeRow(res.Value, offset); err != nil {
+		return Result[DataRow[K, V]]{Err: err}
+	}
+	res.Value.IsValid = false
 
-	sort.Slice(dt.FreeList, func(i, j int) bool {
-		return dt.FreeList[i].Size < dt.FreeList[j].Size
-	})
+	dt.addFree(freed)
 
-	if err := gob.NewEncoder(dt.freeFile).Encode(dt.FreeList); err != nil {
+	if err := dt.saveFreeList(); err != nil {
 		return Result[DataRow[K, V]]{Err: err}
 	}
 
@@ -271,23 +553,29 @@ func (dt *DataTable[K, V]) Select(keys []K, resultType interface{}) chan Result[
 }
 
 func (dt *DataTable[K, V]) SerializeData(dataRow DataRow[K, V], location int) Result[int] {
+	record, err := dt.encodeRow(dataRow)
+	if err != nil {
+		return Result[int]{Err: err}
+	}
+	return dt.writeRecord(record, location)
+}
+
+// writeRecord writes an encoded row at location, or appends it when location
+// is -1.
+func (dt *DataTable[K, V]) writeRecord(record []byte, location int) Result[int] {
 	var offset int64
-	var err error
 
 	if location == -1 {
-		offset, err = dt.DataFile.Seek(0, os.SEEK_END)
+		info, err := dt.DataFile.Stat()
 		if err != nil {
 			return Result[int]{Err: err}
 		}
+		offset = info.Size()
 	} else if location >= 0 {
-		offset, err = dt.DataFile.Seek(int64(location), os.SEEK_SET)
-		if err != nil {
-			return Result[int]{Err: err}
-		}
+		offset = int64(location)
 	}
 
-	encoder := gob.NewEncoder(dt.DataFile)
-	if err := encoder.Encode(dataRow); err != nil {
+	if _, err := dt.DataFile.WriteAt(record, offset); err != nil {
 		return Result[int]{Err: err}
 	}
 
@@ -295,44 +583,146 @@ func (dt *DataTable[K, V]) SerializeData(dataRow DataRow[K, V], location int) Re
 }
 
 func (dt *DataTable[K, V]) UnserializeData(offset int) Result[DataRow[K, V]] {
-	_, err := dt.DataFile.Seek(int64(offset), os.SEEK_SET)
+	var dataRow DataRow[K, V]
+
+	// rows in older layouts are upgraded on the way out
+	if dt.history.legacy != nil {
+		version, err := dt.storedVersion(offset)
+		if err != nil {
+			return Result[DataRow[K, V]]{Err: err}
+		}
+		if version != dt.history.version {
+			if dt.history.legacy[version] == nil {
+				return Result[DataRow[K, V]]{Err: fmt.Errorf("%w: row at offset %d has unknown schema version %d", ErrSchemaMismatch, offset, version)}
+			}
+			row, err := dt.readLegacy(offset, version)
+			return Result[DataRow[K, V]]{Value: row, Err: err}
+		}
+	}
+
+	size, raw, err := dt.decodeRecord(offset, &dataRow)
 	if err != nil {
 		return Result[DataRow[K, V]]{Err: err}
 	}
+	dataRow.size = size
+	dataRow.raw = raw
 
-	var dataRow DataRow[K, V]
+	return Result[DataRow[K, V]]{Value: dataRow}
+}
 
-	decoder := gob.NewDecoder(dt.DataFile)
-	if err := decoder.Decode(&dataRow); err != nil {
-		return Result[DataRow[K, V]]{Err: err}
+// freeRow tombstones a row and releases the overflow chunks it uses.
+func (dt *DataTable[K, V]) freeRow(row DataRow[K, V], offset int) error {
+	first, err := dt.overflowOf(offset)
+	if err != nil {
+		return err
+	}
+	if err := dt.writeTombstone(row, offset); err != nil {
+		return err
+	}
+	if first == 0 {
+		return nil
+	}
+	if err := dt.releaseChain(first); err != nil {
+		return err
 	}
+	return dt.saveOverflow()
+}
 
-	return Result[DataRow[K, V]]{Value: dataRow}
+// writeTombstone marks a stored row invalid in place. A row read from an
+// older layout, compressed differently or not yet encrypted can be longer
+// once re-encoded; it is left as it is, since its slot is freed either way,
+// unless the table is encrypted, in which case the slot is zeroed.
+func (dt *DataTable[K, V]) writeTombstone(row DataRow[K, V], offset int) error {
+	row.IsValid = false
+	record, err := dt.encodeTombstone(row)
+	if err != nil {
+		return err
+	}
+	if row.size > 0 && int64(len(record)) > row.size {
+		record = nil
+	}
+	// the freed slot of an encrypted table must not keep plaintext
+	if dt.crypt != nil && int64(len(record)) < row.size {
+		record = append(record, make([]byte, row.size-int64(len(record)))...)
+	}
+	if len(record) == 0 {
+		return nil
+	}
+	_, err = dt.DataFile.WriteAt(record, int64(offset))
+	return err
 }
 
 func (dt *DataTable[K, V]) SaveIndex() Result[any] {
-	err := dt.IndexTable.Save(dt.IndexFile)
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	return dt.saveIndex()
+}
+
+func (dt *DataTable[K, V]) saveIndex() Result[any] {
+	indexFile, err := os.Create(dt.IndexFile.Name())
 	if err != nil {
 		return Result[any]{Err: err}
 	}
-	return Result[any]{Value: nil}
+
+	defer indexFile.Close()
+
+	w, finish := dt.crypt.writer(indexFile)
+	if err := dt.IndexTable.SaveTo(w); err != nil {
+		return Result[any]{Err: err}
+	}
+	if err := finish(); err != nil {
+		return Result[any]{Err: err}
+	}
+	if err := dt.saveExpiries(indexFile.Name()); err != nil {
+		return Result[any]{Err: err}
+	}
+	return Result[any]{Err: dt.saveBloom(indexFile.Name())}
 }
 
 func (dt *DataTable[K, V]) LoadIndex(indexFilePath string) Result[any] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
 	indexFile, err := os.Open(indexFilePath)
 	if err != nil {
 		return Result[any]{Err: err}
 	}
 	defer indexFile.Close()
 
-	err = dt.IndexTable.Load(indexFile)
+	r, err := dt.crypt.reader(indexFile)
 	if err != nil {
 		return Result[any]{Err: err}
 	}
+	if err := dt.IndexTable.LoadFrom(r); err != nil {
+		return Result[any]{Err: err}
+	}
+	dt.cache.clear()
+	if err := dt.loadExpiries(indexFilePath); err != nil {
+		return Result[any]{Err: err}
+	}
+	if err := dt.loadBloom(indexFilePath); err != nil {
+		return Result[any]{Err: err}
+	}
+	for _, idx := range dt.indexes {
+		if err := dt.buildIndex(idx); err != nil {
+			return Result[any]{Err: err}
+		}
+	}
 	return Result[any]{Value: nil}
 }
 
 func (dt *DataTable[K, V]) Compact() Result[any] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if dt.backups > 0 {
+		return Result[any]{Err: ErrBackupInProgress}
+	}
+	if len(dt.snapshots) > 0 {
+		return Result[any]{Err: ErrSnapshotActive}
+	}
+
 	tempDataFilePath := dt.DataFile.Name() + ".tmp"
 	tempDataFile, err := os.Create(tempDataFilePath)
 	if err != nil {
@@ -340,6 +730,7 @@ func (dt *DataTable[K, V]) Compact() Result[any] {
 	}
 
 	newOffsets := make(map[K]int)
+	var chains []uint64
 	for _, item := range dt.IndexTable.GetAll() {
 		oldOffset := item.Value
 		dataRowResult := dt.UnserializeData(oldOffset)
@@ -347,6 +738,13 @@ func (dt *DataTable[K, V]) Compact() Result[any] {
 			return Result[any]{Err: dataRowResult.Err}
 		}
 		dataRow := dataRowResult.Value
+		first, err := dt.overflowOf(oldOffset)
+		if err != nil {
+			return Result[any]{Err: err}
+		}
+		if first != 0 {
+			chains = append(chains, first)
+		}
 
 		newOffsetResult := dt.serializeDataToFile(dataRow, tempDataFile)
 		if newOffsetResult.Err != nil {
@@ -369,31 +767,124 @@ func (dt *DataTable[K, V]) Compact() Result[any] {
 	}
 
 	dt.IndexTable.Clear()
+	dt.cache.clear()
 	for key, newOffset := range newOffsets {
 		dt.IndexTable.Insert(key, newOffset)
 	}
+	// dropping the keys deleted since the last build
+	dt.rebuildBloom(0)
+	for _, idx := range dt.indexes {
+		if err := dt.buildIndex(idx); err != nil {
+			return Result[any]{Err: err}
+		}
+	}
 
-	saveIndexResult := dt.SaveIndex()
+	saveIndexResult := dt.saveIndex()
 	if saveIndexResult.Err != nil {
 		return Result[any]{Err: saveIndexResult.Err}
 	}
 
-	err = dt.freeFile.Truncate(0)
-	if err != nil {
+	dt.FreeList = nil
+	if err := dt.saveFreeList(); err != nil {
 		return Result[any]{Err: err}
 	}
+	// rewritten rows got new chains
+	for _, first := range chains {
+		if err := dt.releaseChain(first); err != nil {
+			return Result[any]{Err: err}
+		}
+	}
+	if len(chains) > 0 {
+		if err := dt.saveOverflow(); err != nil {
+			return Result[any]{Err: err}
+		}
+	}
 
+	// every row was rewritten in the current layout
+	return Result[any]{Err: dt.forgetLayouts()}
+}
+
+func (dt *DataTable[K, V]) Stats() Result[TableStats] {
+	dt.mu.RLock()
+	defer dt.mu.RUnlock()
+
+	stats := TableStats{Rows: dt.IndexTable.Len(), FreeNodes: len(dt.FreeList)}
+	for _, f := range dt.FreeList {
+		stats.FreeBytes += f.Size
+	}
+
+	info, err := dt.DataFile.Stat()
+	if err != nil {
+		return Result[TableStats]{Err: err}
+	}
+	stats.DataFileSize = info.Size()
+
+	info, err = os.Stat(dt.IndexFile.Name())
+	if err != nil {
+		return Result[TableStats]{Err: err}
+	}
+	stats.IndexFileSize = info.Size()
+	dt.cache.fill(&stats)
+	stats.BloomRejects = atomic.LoadUint64(&dt.bloomRejects)
+
+	return Result[TableStats]{Value: stats}
+}
+
+func (dt *DataTable[K, V]) Close() Result[any] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if err := dt.DataFile.Close(); err != nil {
+		return Result[any]{Err: err}
+	}
+	if err := dt.freeFile.Close(); err != nil {
+		return Result[any]{Err: err}
+	}
+	if err := dt.closeOverflow(); err != nil {
+		return Result[any]{Err: err}
+	}
+	for _, s := range dt.subscribers {
+		s.stop()
+	}
+	dt.subscribers = nil
+	if dt.logFile != nil {
+		if err := dt.logFile.Close(); err != nil {
+			return Result[any]{Err: err}
+		}
+	}
+	dt.IndexFile.Close()
 	return Result[any]{Value: nil}
 }
 
+func (dt *DataTable[K, V]) saveFreeList() error {
+	if err := dt.freeFile.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := dt.freeFile.Seek(0, os.SEEK_SET); err != nil {
+		return err
+	}
+	if len(dt.FreeList) == 0 {
+		return nil
+	}
+	w, finish := dt.crypt.writer(dt.freeFile)
+	if err := gob.NewEncoder(w).Encode(dt.FreeList); err != nil {
+		return err
+	}
+	return finish()
+}
+
 func (dt *DataTable[K, V]) serializeDataToFile(dataRow DataRow[K, V], file *os.File) Result[int] {
 	offset, err := file.Seek(0, os.SEEK_END)
 	if err != nil {
 		return Result[int]{Err: err}
 	}
 
-	encoder := gob.NewEncoder(file)
-	if err := encoder.Encode(dataRow); err != nil {
+	dataRow.SchemaVersion = dt.history.version
+	record, err := dt.encodeRow(dataRow)
+	if err != nil {
+		return Result[int]{Err: err}
+	}
+	if _, err := file.Write(record); err != nil {
 		return Result[int]{Err: err}
 	}
 
@@ -405,6 +896,7 @@ func newRow[K comparable, V any](primaryKey K, data V) DataRow[K, V] {
 	p.PrimaryKey = primaryKey
 	p.Data = data
 	p.IsValid = true
+	p.Version = 1
 	return p
 }
 
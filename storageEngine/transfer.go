@@ -0,0 +1,526 @@
+package storageEngine
+
+import (
+	"ZeroStore/helper"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+const (
+	ExportKeyColumn    = "_key"
+	columnarMagic      = "ZSCOL1\n"
+	columnarGroupSize  = 4096
+	maxImportLineBytes = 16 << 20
+)
+
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+type ImportReport struct {
+	Imported int
+	Errors   []LineError
+}
+
+// fieldMap resolves input column names to fields of V. A column matches a
+// field's json tag name or its Go name, ignoring case.
+type fieldMap struct {
+	names  []string
+	fields map[string]reflect.StructField
+}
+
+func newFieldMap[V any]() (fieldMap, error) {
+	var v V
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Struct {
+		return fieldMap{}, fmt.Errorf("provided Data type is not a struct")
+	}
+
+	fm := fieldMap{fields: make(map[string]reflect.StructField)}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+			fm.fields[strings.ToLower(f.Name)] = f
+		}
+		fm.names = append(fm.names, name)
+		fm.fields[strings.ToLower(name)] = f
+	}
+	return fm, nil
+}
+
+func (fm fieldMap) lookup(column string) (reflect.StructField, bool) {
+	f, ok := fm.fields[strings.ToLower(column)]
+	return f, ok
+}
+
+func setColumn(dst reflect.Value, value interface{}) error {
+	if s, ok := value.(string); ok {
+		switch dst.Kind() {
+		case reflect.Struct, reflect.Slice, reflect.Map, reflect.Array, reflect.Pointer:
+			if dst.Kind() == reflect.Slice && dst.Type().Elem().Kind() == reflect.Uint8 {
+				dst.SetBytes([]byte(s))
+				return nil
+			}
+			return json.Unmarshal([]byte(s), dst.Addr().Interface())
+		}
+	}
+	if raw, ok := value.(json.RawMessage); ok {
+		return json.Unmarshal(raw, dst.Addr().Interface())
+	}
+
+	converted, err := helper.ConvertValue(value, dst.Type())
+	if err != nil {
+		return err
+	}
+	dst.Set(converted)
+	return nil
+}
+
+func parseKey[K comparable](value interface{}) (K, error) {
+	var k K
+	if raw, ok := value.(json.RawMessage); ok {
+		err := json.Unmarshal(raw, &k)
+		return k, err
+	}
+	converted, err := helper.ConvertValue(value, reflect.TypeOf(k))
+	if err != nil {
+		return k, err
+	}
+	return converted.Interface().(K), nil
+}
+
+// importRow stores one decoded record; it is the only place imports touch
+// the table so every format shares the duplicate check and Insert path.
+func (dt *DataTable[K, V]) importRow(key K, data V) error {
+	return dt.Insert(key, data).Err
+}
+
+func (dt *DataTable[K, V]) finishImport(report ImportReport) Result[ImportReport] {
+	if report.Imported > 0 {
+		if res := dt.SaveIndex(); res.Err != nil {
+			return Result[ImportReport]{Value: report, Err: res.Err}
+		}
+	}
+	return Result[ImportReport]{Value: report}
+}
+
+// ImportCSV reads a header line followed by records. keyColumn names the
+// column holding the primary key; it is also copied into a matching field.
+// Bad records are reported in the result and skipped.
+func (dt *DataTable[K, V]) ImportCSV(r io.Reader, keyColumn string) Result[ImportReport] {
+	var report ImportReport
+	fm, err := newFieldMap[V]()
+	if err != nil {
+		return Result[ImportReport]{Err: err}
+	}
+	if keyColumn == "" {
+		keyColumn = ExportKeyColumn
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return Result[ImportReport]{Err: fmt.Errorf("reading header: %w", err)}
+	}
+
+	keyIndex := -1
+	for i, col := range header {
+		if strings.EqualFold(col, keyColumn) {
+			keyIndex = i
+		}
+	}
+	if keyIndex < 0 {
+		return Result[ImportReport]{Err: fmt.Errorf("key column %s not in header", keyColumn)}
+	}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return Result[ImportReport]{Value: report, Err: err}
+			}
+			report.Errors = append(report.Errors, LineError{Line: parseErr.Line, Err: parseErr.Err})
+			continue
+		}
+
+		line, _ := cr.FieldPos(0)
+		if err := dt.importCSVRecord(fm, header, keyIndex, record); err != nil {
+			report.Errors = append(report.Errors, LineError{Line: line, Err: err})
+			continue
+		}
+		report.Imported++
+	}
+	return dt.finishImport(report)
+}
+
+func (dt *DataTable[K, V]) importCSVRecord(fm fieldMap, header []string, keyIndex int, record []string) error {
+	if len(record) != len(header) {
+		return fmt.Errorf("expected %d fields, got %d", len(header), len(record))
+	}
+
+	key, err := parseKey[K](record[keyIndex])
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+
+	var data V
+	val := reflect.ValueOf(&data).Elem()
+	for i, col := range header {
+		f, ok := fm.lookup(col)
+		if !ok {
+			if i == keyIndex {
+				continue
+			}
+			return fmt.Errorf("unknown column %s", col)
+		}
+		if err := setColumn(val.FieldByIndex(f.Index), record[i]); err != nil {
+			return fmt.Errorf("column %s: %w", col, err)
+		}
+	}
+	return dt.importRow(key, data)
+}
+
+// ImportJSONLines reads one JSON object per line. Objects are decoded with
+// encoding/json, so json tags on V apply; keyColumn names the key property.
+func (dt *DataTable[K, V]) ImportJSONLines(r io.Reader, keyColumn string) Result[ImportReport] {
+	var report ImportReport
+	if keyColumn == "" {
+		keyColumn = ExportKeyColumn
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportLineBytes)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if err := dt.importJSONLine(text, keyColumn); err != nil {
+			report.Errors = append(report.Errors, LineError{Line: line, Err: err})
+			continue
+		}
+		report.Imported++
+	}
+	if err := scanner.Err(); err != nil {
+		return Result[ImportReport]{Value: report, Err: err}
+	}
+	return dt.finishImport(report)
+}
+
+func (dt *DataTable[K, V]) importJSONLine(text []byte, keyColumn string) error {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(text, &object); err != nil {
+		return err
+	}
+
+	var rawKey json.RawMessage
+	for name, value := range object {
+		if strings.EqualFold(name, keyColumn) {
+			rawKey = value
+		}
+	}
+	if rawKey == nil {
+		return fmt.Errorf("missing key property %s", keyColumn)
+	}
+	key, err := parseKey[K](rawKey)
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+
+	var data V
+	if err := json.Unmarshal(text, &data); err != nil {
+		return err
+	}
+	return dt.importRow(key, data)
+}
+
+func (dt *DataTable[K, V]) ExportCSV(w io.Writer) Result[int] {
+	fm, err := newFieldMap[V]()
+	if err != nil {
+		return Result[int]{Err: err}
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{ExportKeyColumn}, fm.names...)); err != nil {
+		return Result[int]{Err: err}
+	}
+
+	n := 0
+	record := make([]string, len(fm.names)+1)
+	rows := dt.GetAll()
+	defer drain(rows)
+	for res := range rows {
+		if res.Err != nil {
+			return Result[int]{Value: n, Err: res.Err}
+		}
+		record[0] = fmt.Sprint(res.Value.PrimaryKey)
+		val := reflect.ValueOf(res.Value.Data)
+		for i, name := range fm.names {
+			f, _ := fm.lookup(name)
+			if record[i+1], err = formatColumn(val.FieldByIndex(f.Index)); err != nil {
+				return Result[int]{Value: n, Err: err}
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return Result[int]{Value: n, Err: err}
+		}
+		n++
+	}
+	cw.Flush()
+	return Result[int]{Value: n, Err: cw.Error()}
+}
+
+func formatColumn(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Array, reflect.Pointer, reflect.Interface:
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+	default:
+		return fmt.Sprint(v.Interface()), nil
+	}
+	b, err := json.Marshal(v.Interface())
+	return string(b), err
+}
+
+func (dt *DataTable[K, V]) ExportJSONLines(w io.Writer) Result[int] {
+	bw := bufio.NewWriter(w)
+	n := 0
+	rows := dt.GetAll()
+	defer drain(rows)
+	for res := range rows {
+		if res.Err != nil {
+			return Result[int]{Value: n, Err: res.Err}
+		}
+		key, err := json.Marshal(res.Value.PrimaryKey)
+		if err != nil {
+			return Result[int]{Value: n, Err: err}
+		}
+		data, err := json.Marshal(res.Value.Data)
+		if err != nil {
+			return Result[int]{Value: n, Err: err}
+		}
+		if len(data) == 0 || data[0] != '{' {
+			return Result[int]{Value: n, Err: fmt.Errorf("data for key %s is not a JSON object", key)}
+		}
+
+		// splice the key in front so the remaining properties keep their order
+		fmt.Fprintf(bw, "{%q:%s", ExportKeyColumn, key)
+		if len(data) > 2 {
+			bw.WriteByte(',')
+		}
+		bw.Write(data[1:])
+		bw.WriteByte('\n')
+		n++
+	}
+	return Result[int]{Value: n, Err: bw.Flush()}
+}
+
+// The columnar format stores rows in groups; inside a group each column is
+// a separately gob-encoded slice, so readers can decode only the columns
+// they need.
+type columnarHeader struct {
+	Columns []columnarColumn
+}
+
+type columnarColumn struct {
+	Name string
+	Type string
+}
+
+type columnarGroup struct {
+	Rows    int
+	Keys    []byte
+	Columns [][]byte
+}
+
+func (dt *DataTable[K, V]) ExportColumnar(w io.Writer) Result[int] {
+	var v V
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Struct {
+		return Result[int]{Err: fmt.Errorf("provided Data type is not a struct")}
+	}
+
+	var header columnarHeader
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			header.Columns = append(header.Columns, columnarColumn{Name: t.Field(i).Name, Type: t.Field(i).Type.String()})
+			fields = append(fields, i)
+		}
+	}
+
+	if _, err := io.WriteString(w, columnarMagic); err != nil {
+		return Result[int]{Err: err}
+	}
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return Result[int]{Err: err}
+	}
+
+	var keys []K
+	columns := make([]reflect.Value, len(fields))
+	reset := func() {
+		keys = keys[:0]
+		for i, f := range fields {
+			columns[i] = reflect.MakeSlice(reflect.SliceOf(t.Field(f).Type), 0, columnarGroupSize)
+		}
+	}
+	flush := func() error {
+		group := columnarGroup{Rows: len(keys)}
+		var err error
+		if group.Keys, err = gobBytes(keys); err != nil {
+			return err
+		}
+		for _, col := range columns {
+			b, err := gobBytes(col.Interface())
+			if err != nil {
+				return err
+			}
+			group.Columns = append(group.Columns, b)
+		}
+		return enc.Encode(group)
+	}
+
+	n := 0
+	reset()
+	rows := dt.GetAll()
+	defer drain(rows)
+	for res := range rows {
+		if res.Err != nil {
+			return Result[int]{Value: n, Err: res.Err}
+		}
+		keys = append(keys, res.Value.PrimaryKey)
+		val := reflect.ValueOf(res.Value.Data)
+		for i, f := range fields {
+			columns[i] = reflect.Append(columns[i], val.Field(f))
+		}
+		if n++; len(keys) == columnarGroupSize {
+			if err := flush(); err != nil {
+				return Result[int]{Value: n, Err: err}
+			}
+			reset()
+		}
+	}
+	if len(keys) > 0 {
+		if err := flush(); err != nil {
+			return Result[int]{Value: n, Err: err}
+		}
+	}
+	// an empty group marks the end of the file
+	return Result[int]{Value: n, Err: enc.Encode(columnarGroup{})}
+}
+
+func (dt *DataTable[K, V]) ImportColumnar(r io.Reader) Result[ImportReport] {
+	var report ImportReport
+	var v V
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Struct {
+		return Result[ImportReport]{Err: fmt.Errorf("provided Data type is not a struct")}
+	}
+
+	magic := make([]byte, len(columnarMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != columnarMagic {
+		return Result[ImportReport]{Err: fmt.Errorf("not a columnar export")}
+	}
+
+	dec := gob.NewDecoder(r)
+	var header columnarHeader
+	if err := dec.Decode(&header); err != nil {
+		return Result[ImportReport]{Err: err}
+	}
+
+	// columns missing from V are skipped; that is what lets old exports load
+	// into a struct that has since dropped a field
+	targets := make([]reflect.StructField, len(header.Columns))
+	present := make([]bool, len(header.Columns))
+	for i, col := range header.Columns {
+		if f, ok := t.FieldByName(col.Name); ok && f.Type.String() == col.Type {
+			targets[i], present[i] = f, true
+		}
+	}
+
+	row := 0
+	for {
+		var group columnarGroup
+		if err := dec.Decode(&group); err != nil {
+			return Result[ImportReport]{Value: report, Err: err}
+		}
+		if group.Rows == 0 {
+			break
+		}
+
+		var keys []K
+		if err := gob.NewDecoder(bytes.NewReader(group.Keys)).Decode(&keys); err != nil {
+			return Result[ImportReport]{Value: report, Err: err}
+		}
+		columns := make([]reflect.Value, len(group.Columns))
+		for i, raw := range group.Columns {
+			if !present[i] {
+				continue
+			}
+			slice := reflect.New(reflect.SliceOf(targets[i].Type))
+			if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(slice.Interface()); err != nil {
+				return Result[ImportReport]{Value: report, Err: fmt.Errorf("column %s: %w", header.Columns[i].Name, err)}
+			}
+			columns[i] = slice.Elem()
+		}
+
+		for j, key := range keys {
+			row++
+			var data V
+			val := reflect.ValueOf(&data).Elem()
+			for i, col := range columns {
+				if present[i] && j < col.Len() {
+					val.FieldByIndex(targets[i].Index).Set(col.Index(j))
+				}
+			}
+			if err := dt.importRow(key, data); err != nil {
+				report.Errors = append(report.Errors, LineError{Line: row, Err: err})
+				continue
+			}
+			report.Imported++
+		}
+	}
+	return dt.finishImport(report)
+}
+
+func gobBytes(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drain lets an abandoned scan finish so the snapshot it holds is released.
+func drain[T any](ch <-chan T) {
+	for range ch {
+	}
+}
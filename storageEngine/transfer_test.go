@@ -0,0 +1,286 @@
+package storageEngine
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type transferRow struct {
+	Name   string `json:"name"`
+	Age    int
+	Tags   []string `json:"tags"`
+	Secret string   `json:"-"`
+}
+
+func newTransferTable[V any](t *testing.T, name string) *DataTable[int, V] {
+	t.Helper()
+	dt, err := NewDataTable[int, V](cmp.Compare[int], filepath.Join(t.TempDir(), name), 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dt.Close() })
+	return dt
+}
+
+func transferRows() map[int]transferRow {
+	return map[int]transferRow{
+		1: {Name: "ada", Age: 36, Tags: []string{"math", "engines"}},
+		2: {Name: `quoted "name", with a comma`, Age: 0},
+		3: {Name: "two\nlines", Age: -4},
+	}
+}
+
+func fillTransfer(t *testing.T, dt *DataTable[int, transferRow], rows map[int]transferRow) {
+	t.Helper()
+	for key, row := range rows {
+		if res := dt.Insert(key, row); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+}
+
+func wantTransferRows(t *testing.T, dt *DataTable[int, transferRow], want map[int]transferRow) {
+	t.Helper()
+	got := map[int]transferRow{}
+	for res := range dt.GetAll() {
+		if res.Err != nil {
+			t.Fatal(res.Err)
+		}
+		got[res.Value.PrimaryKey] = res.Value.Data
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("rows = %+v, want %+v", got, want)
+	}
+}
+
+func wantLines(t *testing.T, report ImportReport, imported int, lines ...int) {
+	t.Helper()
+	var got []int
+	for _, e := range report.Errors {
+		got = append(got, e.Line)
+	}
+	if report.Imported != imported || !reflect.DeepEqual(got, lines) {
+		t.Fatalf("imported %d with errors %v, want %d with errors on lines %v", report.Imported, report.Errors, imported, lines)
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	src := newTransferTable[transferRow](t, "src")
+	rows := transferRows()
+	fillTransfer(t, src, rows)
+	src.Upsert(4, transferRow{Name: "secret kept out", Secret: "x"})
+
+	var buf bytes.Buffer
+	if res := src.ExportCSV(&buf); res.Err != nil || res.Value != 4 {
+		t.Fatalf("ExportCSV = %+v", res)
+	}
+	if header, _, _ := strings.Cut(buf.String(), "\n"); header != "_key,name,Age,tags" {
+		t.Fatalf("header = %q", header)
+	}
+
+	dst := newTransferTable[transferRow](t, "dst")
+	res := dst.ImportCSV(&buf, "")
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	wantLines(t, res.Value, 4)
+	rows[4] = transferRow{Name: "secret kept out"}
+	wantTransferRows(t, dst, rows)
+}
+
+func TestJSONLinesRoundTrip(t *testing.T) {
+	src := newTransferTable[transferRow](t, "src")
+	rows := transferRows()
+	fillTransfer(t, src, rows)
+
+	var buf bytes.Buffer
+	if res := src.ExportJSONLines(&buf); res.Err != nil || res.Value != 3 {
+		t.Fatalf("ExportJSONLines = %+v", res)
+	}
+	if first, _, _ := strings.Cut(buf.String(), "\n"); first != `{"_key":1,"name":"ada","Age":36,"tags":["math","engines"]}` {
+		t.Fatalf("first line = %s", first)
+	}
+
+	dst := newTransferTable[transferRow](t, "dst")
+	res := dst.ImportJSONLines(&buf, "")
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	wantLines(t, res.Value, 3)
+	wantTransferRows(t, dst, rows)
+}
+
+func TestImportMatchesJSONTagsAndGoNames(t *testing.T) {
+	dt := newTransferTable[transferRow](t, "rows")
+	csv := "ID,NAME,age,Tags\n" +
+		"1,by go name,1,\"[\"\"x\"\"]\"\n"
+	if res := dt.ImportCSV(strings.NewReader(csv), "id"); res.Err != nil {
+		t.Fatal(res.Err)
+	} else {
+		wantLines(t, res.Value, 1)
+	}
+	csv = "id,name,Age\n" +
+		"2,by tag,2\n"
+	if res := dt.ImportCSV(strings.NewReader(csv), "id"); res.Err != nil {
+		t.Fatal(res.Err)
+	} else {
+		wantLines(t, res.Value, 1)
+	}
+	// a field tagged json:"-" is not a column
+	csv = "id,name,Secret\n" +
+		"3,hidden,x\n"
+	if res := dt.ImportCSV(strings.NewReader(csv), "id"); res.Err != nil {
+		t.Fatal(res.Err)
+	} else if wantLines(t, res.Value, 0, 2); !strings.Contains(res.Value.Errors[0].Error(), "unknown column Secret") {
+		t.Fatalf("error = %v", res.Value.Errors[0])
+	}
+	if res := dt.ImportCSV(strings.NewReader("name\nx\n"), "id"); res.Err == nil {
+		t.Fatal("a header without the key column was accepted")
+	}
+
+	jsonl := `{"id":4,"name":"by tag","Age":4}` + "\n" +
+		`{"ID":5,"NAME":"folded","age":5}` + "\n"
+	if res := dt.ImportJSONLines(strings.NewReader(jsonl), "id"); res.Err != nil {
+		t.Fatal(res.Err)
+	} else {
+		wantLines(t, res.Value, 2)
+	}
+
+	wantTransferRows(t, dt, map[int]transferRow{
+		1: {Name: "by go name", Age: 1, Tags: []string{"x"}},
+		2: {Name: "by tag", Age: 2},
+		4: {Name: "by tag", Age: 4},
+		5: {Name: "folded", Age: 5},
+	})
+}
+
+func TestImportLineErrors(t *testing.T) {
+	dt := newTransferTable[transferRow](t, "rows")
+	csv := strings.Join([]string{
+		"_key,name,Age",
+		"1,ada,36",
+		"x,bad key,1",
+		"3,short",
+		"4,bare \"quote,1",
+		"1,duplicate,2",
+		"7,\"two",
+		"lines\",3",
+		"9,bad age,old",
+		"10,last,1",
+	}, "\n") + "\n"
+	res := dt.ImportCSV(strings.NewReader(csv), "")
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	wantLines(t, res.Value, 3, 3, 4, 5, 6, 9)
+	if err := res.Value.Errors[3].Err; !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("duplicate key error = %v, want ErrKeyExists", err)
+	}
+	named := func(key int, name string) {
+		t.Helper()
+		if res := dt.Search(key); res.Err != nil || res.Value.Data.Name != name {
+			t.Fatalf("Search(%d) = %+v, want %q", key, res, name)
+		}
+	}
+	named(1, "ada")
+	named(7, "two\nlines")
+
+	jsonl := strings.Join([]string{
+		`{"_key":20,"name":"ok"}`,
+		``,
+		`not json`,
+		`{"name":"no key"}`,
+		`{"_key":20,"name":"duplicate"}`,
+		`{"_key":"twenty"}`,
+		`{"_key":27,"Age":"old"}`,
+		`{"_key":28,"name":"ok"}`,
+	}, "\n")
+	res = dt.ImportJSONLines(strings.NewReader(jsonl), "")
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	wantLines(t, res.Value, 2, 3, 4, 5, 6, 7)
+	if err := res.Value.Errors[2].Err; !errors.Is(err, ErrKeyExists) {
+		t.Fatalf("duplicate key error = %v, want ErrKeyExists", err)
+	}
+	named(20, "ok")
+}
+
+func TestColumnarRoundTrip(t *testing.T) {
+	src := newTransferTable[transferRow](t, "src")
+	total := 2*columnarGroupSize + 10
+	want := map[int]transferRow{}
+	for key := 0; key < total; key++ {
+		row := transferRow{Name: fmt.Sprint("row ", key), Age: key % 90}
+		if key%3 == 0 {
+			row.Tags = []string{fmt.Sprint(key)}
+		}
+		want[key] = row
+	}
+	fillTransfer(t, src, want)
+
+	var buf bytes.Buffer
+	if res := src.ExportColumnar(&buf); res.Err != nil || res.Value != total {
+		t.Fatalf("ExportColumnar = %+v", res)
+	}
+	export := buf.Bytes()
+
+	dst := newTransferTable[transferRow](t, "dst")
+	res := dst.ImportColumnar(bytes.NewReader(export))
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	wantLines(t, res.Value, total)
+	wantTransferRows(t, dst, want)
+
+	// importing again hits every key through importRow; rows are numbered
+	// across groups
+	res = dst.ImportColumnar(bytes.NewReader(export))
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	errs := res.Value.Errors
+	if res.Value.Imported != 0 || len(errs) != total || errs[columnarGroupSize].Line != columnarGroupSize+1 {
+		t.Fatalf("second import: %d imported, %d errors", res.Value.Imported, len(errs))
+	}
+	if !errors.Is(errs[0].Err, ErrKeyExists) {
+		t.Fatalf("duplicate key error = %v, want ErrKeyExists", errs[0].Err)
+	}
+
+	if res := dst.ImportColumnar(strings.NewReader("key,name\n")); res.Err == nil {
+		t.Fatal("a CSV file was imported as columnar")
+	}
+}
+
+func TestColumnarImportIntoChangedStruct(t *testing.T) {
+	src := newTransferTable[transferRow](t, "src")
+	fillTransfer(t, src, transferRows())
+	var buf bytes.Buffer
+	if res := src.ExportColumnar(&buf); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	// Tags is dropped, Age changed type and Nick is new
+	type trimmed struct {
+		Name string
+		Age  int64
+		Nick string
+	}
+	dst := newTransferTable[trimmed](t, "dst")
+	res := dst.ImportColumnar(&buf)
+	if res.Err != nil || res.Value.Imported != 3 || len(res.Value.Errors) != 0 {
+		t.Fatalf("ImportColumnar = %+v", res)
+	}
+	for key, row := range transferRows() {
+		got := dst.Search(key)
+		if got.Err != nil || got.Value.Data != (trimmed{Name: row.Name}) {
+			t.Fatalf("Search(%d) = %+v", key, got)
+		}
+	}
+}
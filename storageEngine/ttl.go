@@ -0,0 +1,245 @@
+package storageEngine
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InsertWithTTL inserts a row that reads treat as missing once ttl has
+// passed on the table's clock. Updates keep the expiry.
+func (dt *DataTable[K, V]) InsertWithTTL(primaryKey K, data V, ttl time.Duration) Result[any] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if err := dt.expireKey(primaryKey); err != nil {
+		return Result[any]{Err: err}
+	}
+	if _, found := dt.IndexTable.Search(primaryKey); found {
+		return Result[any]{Err: fmt.Errorf("%w: %v", ErrKeyExists, primaryKey)}
+	}
+
+	data, err := dt.beforeInsert(primaryKey, data)
+	if err != nil {
+		return Result[any]{Err: err}
+	}
+	row := newRow(primaryKey, data)
+	row.ExpiresAt = dt.options.clock.Now().Add(ttl).UnixNano()
+	if res := dt.insertRow(row); res.Err != nil {
+		return res
+	}
+	err = dt.commitRecord(LogRecord[K, V]{Op: OpInsert, Key: primaryKey, Data: data, ExpiresAt: row.ExpiresAt})
+	dt.afterInsert(primaryKey, data)
+	return Result[any]{Err: err}
+}
+
+func (dt *DataTable[K, V]) expired(row DataRow[K, V]) bool {
+	return row.ExpiresAt != 0 && row.ExpiresAt <= dt.options.clock.Now().UnixNano()
+}
+
+// expireKey deletes key if its row has expired, so the mutation that
+// follows sees the key as missing. The expiry comes from dt.expiries, so
+// rows are read only once they have expired, and the delete runs the
+// BeforeDelete hooks like Delete does; a hook that refuses it fails the
+// mutation.
+func (dt *DataTable[K, V]) expireKey(primaryKey K) error {
+	expiresAt, ok := dt.expiries[primaryKey]
+	if !ok || expiresAt > dt.options.clock.Now().UnixNano() {
+		return nil
+	}
+	if len(dt.hooks.beforeDelete) > 0 {
+		offset, _ := dt.IndexTable.Search(primaryKey)
+		res := dt.UnserializeData(offset)
+		if res.Err != nil {
+			return res.Err
+		}
+		if err := dt.runBeforeDelete(primaryKey, res.Value.Data); err != nil {
+			return err
+		}
+	}
+	res := dt.delete(primaryKey)
+	if res.Err != nil {
+		return res.Err
+	}
+	var zero V
+	return dt.commit(OpDelete, primaryKey, res.Value.Data, zero)
+}
+
+func (dt *DataTable[K, V]) trackExpiry(primaryKey K, expiresAt int64) {
+	if expiresAt == 0 {
+		delete(dt.expiries, primaryKey)
+		return
+	}
+	dt.expiries[primaryKey] = expiresAt
+}
+
+type savedExpiries[K comparable] struct {
+	// Keys is the number of keys in the index the expiries were saved with
+	Keys      int
+	ExpiresAt map[K]int64
+}
+
+func expiryFilePath(indexPath string) string {
+	return strings.TrimSuffix(indexPath, "_index.bin") + "_ttl.bin"
+}
+
+// saveExpiries writes dt.expiries next to the index at indexPath.
+func (dt *DataTable[K, V]) saveExpiries(indexPath string) error {
+	f, err := os.Create(expiryFilePath(indexPath))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, finish := dt.crypt.writer(f)
+	saved := savedExpiries[K]{Keys: dt.IndexTable.Len(), ExpiresAt: dt.expiries}
+	if err := gob.NewEncoder(w).Encode(saved); err != nil {
+		return err
+	}
+	return finish()
+}
+
+// loadExpiries reads the expiries saved with the index at indexPath, or
+// rebuilds them from the rows when there are none or they do not match the
+// index.
+func (dt *DataTable[K, V]) loadExpiries(indexPath string) error {
+	f, err := os.Open(expiryFilePath(indexPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return dt.rebuildExpiries()
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return dt.rebuildExpiries()
+	}
+
+	r, err := dt.crypt.reader(f)
+	if err != nil {
+		return err
+	}
+	var saved savedExpiries[K]
+	if err := gob.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+	if saved.Keys != dt.IndexTable.Len() {
+		return dt.rebuildExpiries()
+	}
+	dt.expiries = saved.ExpiresAt
+	if dt.expiries == nil {
+		dt.expiries = make(map[K]int64)
+	}
+	return nil
+}
+
+func (dt *DataTable[K, V]) rebuildExpiries() error {
+	dt.expiries = make(map[K]int64)
+	for _, item := range dt.IndexTable.GetAll() {
+		res := dt.UnserializeData(item.Value)
+		if res.Err != nil {
+			return res.Err
+		}
+		dt.trackExpiry(item.Key, res.Value.ExpiresAt)
+	}
+	return nil
+}
+
+// ReapExpired deletes every expired row, taking the write lock for at most
+// batch rows at a time so other writers are not starved. Rows are deleted
+// through the BeforeDelete hooks, as Delete does, and freed space goes back
+// to the free list. A row a hook refuses to delete is left in place and the
+// first such error is returned once the other rows are reaped.
+func (dt *DataTable[K, V]) ReapExpired(batch int) Result[int] {
+	if batch <= 0 {
+		batch = 1
+	}
+
+	dt.mu.RLock()
+	now := dt.options.clock.Now().UnixNano()
+	var keys []K
+	for key, expiresAt := range dt.expiries {
+		if expiresAt <= now {
+			keys = append(keys, key)
+		}
+	}
+	dt.mu.RUnlock()
+	slices.SortFunc(keys, dt.Compare)
+
+	reaped := 0
+	var firstErr error
+	for start := 0; start < len(keys); start += batch {
+		n, err := dt.reapBatch(keys[start:min(start+batch, len(keys))])
+		reaped += n
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return Result[int]{Value: reaped, Err: firstErr}
+}
+
+func (dt *DataTable[K, V]) reapBatch(keys []K) (int, error) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	before := dt.IndexTable.Len()
+	var firstErr error
+	for _, key := range keys {
+		// the row may have been replaced since its expiry was read
+		if err := dt.expireKey(key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	reaped := before - dt.IndexTable.Len()
+	if reaped == 0 {
+		return 0, firstErr
+	}
+	if res := dt.saveIndex(); res.Err != nil {
+		return reaped, res.Err
+	}
+	return reaped, firstErr
+}
+
+// StartReaper runs ReapExpired every interval until the returned stop
+// function is called. stop waits for a running pass to finish and returns
+// the last error the reaper hit.
+func (dt *DataTable[K, V]) StartReaper(interval time.Duration, batch int) (stop func() error) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	var lastErr error
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if res := dt.ReapExpired(batch); res.Err != nil {
+					lastErr = res.Err
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() error {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+		return lastErr
+	}
+}
@@ -0,0 +1,161 @@
+package storageEngine
+
+import (
+	"cmp"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpiredRowsAreHiddenAndReaped(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	dt := newRowTable(t, WithClock(clock))
+
+	if res := dt.InsertWithTTL(1, logRow{"short"}, time.Minute); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res := dt.InsertWithTTL(2, logRow{"long"}, time.Hour); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res := dt.Insert(3, logRow{"forever"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	visible := func() []int {
+		var keys []int
+		for res := range dt.GetAll() {
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+			keys = append(keys, res.Value.PrimaryKey)
+		}
+		return keys
+	}
+	if keys := visible(); len(keys) != 3 {
+		t.Fatalf("GetAll before expiry = %v", keys)
+	}
+
+	clock.Advance(time.Minute)
+	if res := dt.Search(1); !errors.Is(res.Err, ErrKeyNotFound) {
+		t.Fatalf("Search of an expired row = %+v, want ErrKeyNotFound", res)
+	}
+	wantRow(t, dt, 2, "long")
+	if keys := visible(); len(keys) != 2 || keys[0] != 2 || keys[1] != 3 {
+		t.Fatalf("GetAll after the first expiry = %v, want [2 3]", keys)
+	}
+	// still on disk until reaped
+	if n := dt.Len(); n != 3 {
+		t.Fatalf("Len before reaping = %d, want 3", n)
+	}
+
+	clock.Advance(time.Hour)
+	if res := dt.ReapExpired(1); res.Err != nil || res.Value != 2 {
+		t.Fatalf("ReapExpired = %+v, want 2", res)
+	}
+	if n := dt.Len(); n != 1 {
+		t.Fatalf("Len after reaping = %d, want 1", n)
+	}
+	wantRow(t, dt, 3, "forever")
+	if res := dt.ReapExpired(1); res.Err != nil || res.Value != 0 {
+		t.Fatalf("second ReapExpired = %+v, want 0", res)
+	}
+
+	// an expired key is free for a new row
+	if res := dt.Insert(1, logRow{"again"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	wantRow(t, dt, 1, "again")
+}
+
+func TestExpiryRunsDeleteHooks(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	dt := newRowTable(t, WithClock(clock))
+	for key := 1; key <= 2; key++ {
+		if res := dt.InsertWithTTL(key, logRow{"expiring"}, time.Minute); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	kept := errors.New("kept")
+	var deleted []logRow
+	dt.BeforeDelete(func(key int, data logRow) error {
+		if key == 2 {
+			return kept
+		}
+		deleted = append(deleted, data)
+		return nil
+	})
+	sub := subscribe(t, dt, dt.seq)
+
+	clock.Advance(time.Minute)
+	if res := dt.Insert(1, logRow{"new"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if len(deleted) != 1 || deleted[0].Name != "expiring" {
+		t.Fatalf("BeforeDelete saw %+v, want the expired row", deleted)
+	}
+	if event := nextEvent(t, sub); event.Op != OpDelete || event.Key != 1 {
+		t.Fatalf("event = %+v, want the expiry", event)
+	}
+	wantRow(t, dt, 1, "new")
+
+	// a hook that refuses the expiry fails the write that triggered it
+	if res := dt.Upsert(2, logRow{"new"}); !errors.Is(res.Err, kept) {
+		t.Fatalf("Upsert over a row its hook keeps = %v", res.Err)
+	}
+	if _, found := dt.IndexTable.Search(2); !found {
+		t.Fatal("row deleted although its hook refused")
+	}
+}
+
+func TestExpiriesSurviveReopen(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1700000000, 0))
+	name := filepath.Join(t.TempDir(), "ttl")
+	open := func() *DataTable[int, logRow] {
+		t.Helper()
+		dt, err := NewDataTable[int, logRow](cmp.Compare[int], name, 4, WithClock(clock))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info, _ := os.Stat(dt.IndexFile.Name()); info.Size() > 0 {
+			if res := dt.LoadIndex(dt.IndexFile.Name()); res.Err != nil {
+				t.Fatal(res.Err)
+			}
+		}
+		return dt
+	}
+
+	dt := open()
+	dt.InsertWithTTL(1, logRow{"short"}, time.Minute)
+	dt.InsertWithTTL(2, logRow{"long"}, time.Hour)
+	dt.Insert(3, logRow{"forever"})
+	want := map[int]int64{1: clock.Now().Add(time.Minute).UnixNano(), 2: clock.Now().Add(time.Hour).UnixNano()}
+	dt.SaveIndex()
+	dt.Close()
+
+	for _, remove := range []bool{false, true} {
+		if remove {
+			// without the saved expiries they are read back from the rows
+			if err := os.Remove(name + "_ttl.bin"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dt = open()
+		if len(dt.expiries) != len(want) || dt.expiries[1] != want[1] || dt.expiries[2] != want[2] {
+			t.Fatalf("expiries after reopen = %v, want %v", dt.expiries, want)
+		}
+		dt.Close()
+	}
+
+	dt = open()
+	defer dt.Close()
+	clock.Advance(time.Minute)
+	if res := dt.Insert(1, logRow{"again"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	wantRow(t, dt, 1, "again")
+	if _, ok := dt.expiries[1]; ok {
+		t.Fatal("a row inserted without a TTL kept the old expiry")
+	}
+}
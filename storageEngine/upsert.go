@@ -0,0 +1,62 @@
+package storageEngine
+
+// Upsert inserts the row, or replaces it when the key already exists.
+func (dt *DataTable[K, V]) Upsert(primaryKey K, data V) Result[any] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if err := dt.expireKey(primaryKey); err != nil {
+		return Result[any]{Err: err}
+	}
+	if _, found := dt.IndexTable.Search(primaryKey); !found {
+		data, err := dt.beforeInsert(primaryKey, data)
+		if err != nil {
+			return Result[any]{Err: err}
+		}
+		if res := dt.insert(primaryKey, data, 1); res.Err != nil {
+			return res
+		}
+		var zero V
+		err = dt.commit(OpInsert, primaryKey, zero, data)
+		dt.afterInsert(primaryKey, data)
+		return Result[any]{Err: err}
+	}
+
+	data, err := dt.beforeUpdate(primaryKey, data)
+	if err != nil {
+		return Result[any]{Err: err}
+	}
+	deleteResult := dt.delete(primaryKey)
+	if deleteResult.Err != nil {
+		return Result[any]{Err: deleteResult.Err}
+	}
+	if res := dt.replace(deleteResult.Value, data); res.Err != nil {
+		return res
+	}
+	return Result[any]{Err: dt.commit(OpUpdate, primaryKey, deleteResult.Value.Data, data)}
+}
+
+// InsertIfAbsent inserts the row unless the key exists, reporting whether
+// it did.
+func (dt *DataTable[K, V]) InsertIfAbsent(primaryKey K, data V) Result[bool] {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	if err := dt.expireKey(primaryKey); err != nil {
+		return Result[bool]{Err: err}
+	}
+	if _, found := dt.IndexTable.Search(primaryKey); found {
+		return Result[bool]{Value: false}
+	}
+	data, err := dt.beforeInsert(primaryKey, data)
+	if err != nil {
+		return Result[bool]{Err: err}
+	}
+	if res := dt.insert(primaryKey, data, 1); res.Err != nil {
+		return Result[bool]{Err: res.Err}
+	}
+	var zero V
+	err = dt.commit(OpInsert, primaryKey, zero, data)
+	dt.afterInsert(primaryKey, data)
+	return Result[bool]{Value: true, Err: err}
+}
@@ -0,0 +1,70 @@
+package storageEngine
+
+import (
+	"cmp"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func newRowTable(t *testing.T, opts ...Option) *DataTable[int, logRow] {
+	t.Helper()
+	dt, err := NewDataTable[int, logRow](cmp.Compare[int], filepath.Join(t.TempDir(), "rows"), 4, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dt.Close() })
+	return dt
+}
+
+// wantRow fails unless key holds a row named name.
+func wantRow(t *testing.T, dt *DataTable[int, logRow], key int, name string) {
+	t.Helper()
+	res := dt.Search(key)
+	if res.Err != nil {
+		t.Fatalf("Search(%d): %v", key, res.Err)
+	}
+	if res.Value.Data.Name != name {
+		t.Fatalf("Search(%d) = %q, want %q", key, res.Value.Data.Name, name)
+	}
+}
+
+func TestInsertRejectsDuplicate(t *testing.T) {
+	dt := newRowTable(t)
+	if res := dt.Insert(1, logRow{"first"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res := dt.Insert(1, logRow{"second"}); !errors.Is(res.Err, ErrKeyExists) {
+		t.Fatalf("second Insert = %v, want ErrKeyExists", res.Err)
+	}
+	wantRow(t, dt, 1, "first")
+	if n := dt.Len(); n != 1 {
+		t.Fatalf("Len = %d, want 1", n)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	dt := newRowTable(t)
+	if res := dt.Upsert(1, logRow{"first"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	wantRow(t, dt, 1, "first")
+	if res := dt.Upsert(1, logRow{"second"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	wantRow(t, dt, 1, "second")
+	if n := dt.Len(); n != 1 {
+		t.Fatalf("Len = %d, want 1", n)
+	}
+}
+
+func TestInsertIfAbsent(t *testing.T) {
+	dt := newRowTable(t)
+	if res := dt.InsertIfAbsent(1, logRow{"first"}); res.Err != nil || !res.Value {
+		t.Fatalf("InsertIfAbsent on a new key = %+v, want true", res)
+	}
+	if res := dt.InsertIfAbsent(1, logRow{"second"}); res.Err != nil || res.Value {
+		t.Fatalf("InsertIfAbsent on an existing key = %+v, want false", res)
+	}
+	wantRow(t, dt, 1, "first")
+}
@@ -0,0 +1,188 @@
+package storageEngine
+
+import (
+	"ZeroStore/datastructure/btree"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+type LogOp uint8
+
+const (
+	OpInsert LogOp = iota + 1
+	OpUpdate
+	OpDelete
+)
+
+func (op LogOp) String() string {
+	switch op {
+	case OpInsert:
+		return "insert"
+	case OpUpdate:
+		return "update"
+	case OpDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+type LogRecord[K comparable, V any] struct {
+	Seq  uint64
+	Time int64
+	Op   LogOp
+	Key  K
+	Data V
+	// Old is the value the mutation replaced or deleted
+	Old       V
+	ExpiresAt int64
+}
+
+// Each record is framed as a 4-byte length and a CRC32 of the gob payload,
+// so a record torn by a crash is detected and ignored on the next read.
+const logHeaderSize = 8
+
+func logFilePath(dbName string) string {
+	return dbName + "_wal.bin"
+}
+
+// commit assigns the next sequence number to a mutation that has already
+// been applied and appends it to the log when one is configured.
+func (dt *DataTable[K, V]) commit(op LogOp, key K, old, data V) error {
+	return dt.commitRecord(LogRecord[K, V]{Op: op, Key: key, Old: old, Data: data})
+}
+
+func (dt *DataTable[K, V]) commitRecord(record LogRecord[K, V]) error {
+	dt.seq++
+	dt.seqTime = time.Now().UnixNano()
+	record.Seq, record.Time = dt.seq, dt.seqTime
+	defer dt.publish(record)
+
+	if dt.logFile == nil {
+		return nil
+	}
+
+	frame, err := encodeLogRecord(record, dt.crypt)
+	if err != nil {
+		return err
+	}
+	_, err = dt.logFile.Write(frame)
+	return err
+}
+
+func (dt *DataTable[K, V]) commitInserts(rows []btree.KVPair[K, V]) error {
+	var zero V
+	for _, row := range rows {
+		if err := dt.commit(OpInsert, row.Key, zero, row.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeLogRecord frames a record for the log, encrypting it when crypt is
+// set.
+func encodeLogRecord[K comparable, V any](record LogRecord[K, V], crypt *crypter) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, logHeaderSize))
+	if err := gob.NewEncoder(&buf).Encode(record); err != nil {
+		return nil, err
+	}
+	frame := buf.Bytes()
+	if crypt != nil {
+		sealed, err := crypt.sealRecord(frame[logHeaderSize:])
+		if err != nil {
+			return nil, err
+		}
+		frame = append(frame[:logHeaderSize], sealed...)
+	}
+	payload := frame[logHeaderSize:]
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.ChecksumIEEE(payload))
+	return frame, nil
+}
+
+// readLog calls fn for every intact record in the log at path, stopping at
+// the first torn or corrupt frame. A missing file is an empty log.
+func readLog[K comparable, V any](path string, crypt *crypter, fn func(LogRecord[K, V]) error) error {
+	_, err := scanLog(path, crypt, fn)
+	return err
+}
+
+// scanLog reads the log up to the first torn frame and returns the offset
+// just past the last intact one.
+func scanLog[K comparable, V any](path string, crypt *crypter, fn func(LogRecord[K, V]) error) (int64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var end int64
+	header := make([]byte, logHeaderSize)
+	for {
+		if _, err := io.ReadFull(f, header); err != nil {
+			return end, nil
+		}
+		size := binary.BigEndian.Uint32(header[0:4])
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(f, payload); err != nil {
+			return end, nil
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+			return end, nil
+		}
+		end += int64(logHeaderSize) + int64(size)
+
+		if len(payload) > 0 && payload[0] == frameSealed {
+			if crypt == nil {
+				return end, ErrEncrypted
+			}
+			if payload, err = crypt.open(bytes.NewReader(payload[1:]), nil); err != nil {
+				return end, err
+			}
+		}
+
+		var record LogRecord[K, V]
+		if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&record); err != nil {
+			return end, err
+		}
+		if err := fn(record); err != nil {
+			return end, err
+		}
+	}
+}
+
+func (dt *DataTable[K, V]) openLog(dbName string) error {
+	path := logFilePath(dbName)
+	end, err := scanLog(path, dt.crypt, func(r LogRecord[K, V]) error {
+		dt.seq, dt.seqTime = r.Seq, r.Time
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// cut off a frame torn by a crash, or new records would land behind it
+	// where no reader gets to them
+	if info, err := os.Stat(path); err == nil && info.Size() > end {
+		if err := os.Truncate(path, end); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	dt.logFile = f
+	return nil
+}
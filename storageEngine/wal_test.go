@@ -0,0 +1,74 @@
+package storageEngine
+
+import (
+	"cmp"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type logRow struct {
+	Name string
+}
+
+func openLogged(t *testing.T, name string) *DataTable[int, logRow] {
+	t.Helper()
+	dt, err := NewDataTable[int, logRow](cmp.Compare[int], name, 8, WithMutationLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dt
+}
+
+func TestOpenLogTruncatesTornFrame(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "logged")
+
+	dt := openLogged(t, name)
+	for key := 1; key <= 2; key++ {
+		if res := dt.Insert(key, logRow{"row"}); res.Err != nil {
+			t.Fatal(res.Err)
+		}
+	}
+	dt.Close()
+
+	// a crash in the middle of a write leaves a header without its payload
+	f, err := os.OpenFile(logFilePath(name), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 0xde, 0xad, 0xbe, 0xef, 1, 2, 3})
+	f.Close()
+
+	dt = openLogged(t, name)
+	if res := dt.Insert(3, logRow{"after crash"}); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	dt.Close()
+
+	dt = openLogged(t, name)
+	defer dt.Close()
+	if dt.seq != 3 {
+		t.Fatalf("seq after reopen = %d, want 3", dt.seq)
+	}
+
+	var seqs []uint64
+	if err := readLog(logFilePath(name), dt.crypt, func(r LogRecord[int, logRow]) error {
+		seqs = append(seqs, r.Seq)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(seqs, []uint64{1, 2, 3}) {
+		t.Fatalf("logged seqs = %v, want [1 2 3]", seqs)
+	}
+
+	sub := dt.Subscribe(2)
+	if sub.Err != nil {
+		t.Fatal(sub.Err)
+	}
+	defer sub.Value.Close()
+	if event := <-sub.Value.Events(); event.Seq != 3 || event.New.Name != "after crash" {
+		t.Fatalf("replayed %+v, want seq 3", event)
+	}
+}
@@ -1,6 +1,7 @@
 package test
 
 import (
+	"ZeroStore/storageEngine"
 	"encoding/binary"
 	"fmt"
 	"math/rand"
@@ -51,7 +52,7 @@ func getFileSize(filePath string) (int64, error) {
 	return fileInfo.Size(), nil
 }
 
-func CalculateEfficiencyPercentage(dataFile string, numRows int, textLength int) error {
+func CalculateEfficiencyPercentage(dataFile string, numRows int, textLength int, compression storageEngine.CompressionStats) error {
 	dataSize, err := getFileSize(dataFile)
 	if err != nil {
 		return err
@@ -75,6 +76,10 @@ func CalculateEfficiencyPercentage(dataFile string, numRows int, textLength int)
 	fmt.Printf("Expected Total File Size for %d rows: %d bytes\n", numRows, totalFileSize)
 	fmt.Printf("Actual Data File Size: %d bytes\n", dataSize)
 	fmt.Printf("Efficiency Percentage: %.2f%%\n", efficiency)
+	fmt.Printf("Compressed Rows: %d of %d\n", compression.Compressed, compression.Rows)
+	fmt.Printf("Uncompressed Row Bytes: %d bytes\n", compression.RawBytes)
+	fmt.Printf("Stored Row Bytes: %d bytes\n", compression.StoredBytes)
+	fmt.Printf("Compression Ratio: %.2fx\n", compression.Ratio())
 
 	return nil
 }
@@ -120,3 +125,30 @@ func Disp() {
 	fmt.Printf("Total Row Size: %d bytes\n", totalRowSize)
 	fmt.Printf("Total File Size for %d rows: %d bytes\n", NumberOfRows, totalFileSize)
 }
+
+// ZipfLookups searches dt for lookups keys in [1, numRows) drawn from a Zipf
+// distribution, so a few hot keys take most of the reads, and reports the
+// time taken and the table's row cache counters.
+func ZipfLookups(dt *storageEngine.DataTable[int, Row], numRows, lookups int) (time.Duration, storageEngine.TableStats, error) {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, uint64(numRows-2))
+
+	start := time.Now()
+	for i := 0; i < lookups; i++ {
+		if res := dt.Search(int(zipf.Uint64()) + 1); res.Err != nil {
+			return 0, storageEngine.TableStats{}, res.Err
+		}
+	}
+	elapsed := time.Since(start)
+
+	stats := dt.Stats()
+	return elapsed, stats.Value, stats.Err
+}
+
+func PrintLookups(name string, lookups int, elapsed time.Duration, stats storageEngine.TableStats) {
+	hitRate := 0.0
+	if total := stats.CacheHits + stats.CacheMisses; total > 0 {
+		hitRate = float64(stats.CacheHits) / float64(total) * 100
+	}
+	fmt.Printf("%s: %d lookups in %v (%v/op), cache hit rate %.2f%%, %d bytes cached\n",
+		name, lookups, elapsed, elapsed/time.Duration(lookups), hitRate, stats.CacheBytes)
+}